@@ -1,40 +1,417 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/dityuiri/UserServiceTest/config"
 	"github.com/dityuiri/UserServiceTest/generated"
 	"github.com/dityuiri/UserServiceTest/handler"
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/lifecycle"
+	"github.com/dityuiri/UserServiceTest/metrics"
+	"github.com/dityuiri/UserServiceTest/migrations"
+	"github.com/dityuiri/UserServiceTest/passwordcheck"
+	"github.com/dityuiri/UserServiceTest/ratelimit"
 	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/revocation"
+	"github.com/dityuiri/UserServiceTest/sms"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 )
 
+// Levels of the log_level setting
+var logLevels = map[string]log.Lvl{
+	"debug": log.DEBUG,
+	"info":  log.INFO,
+	"warn":  log.WARN,
+	"error": log.ERROR,
+	"off":   log.OFF,
+}
+
 func main() {
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err != nil {
+		exit(err)
+	}
+
+	if len(args) > 0 && args[0] == "migrate" {
+		if err = runMigrate(args[1:], cfg, os.Stdout); err != nil {
+			exit(err)
+		}
+
+		return
+	}
+
+	// The service doesn't start half configured, e.g. signing tokens with an empty secret
+	if err = cfg.Validate(); err != nil {
+		exit(err)
+	}
+
 	e := echo.New()
-	e.Validator = &handler.UserRegistrationValidator{Validator: setupValidator()}
+	e.Logger.SetLevel(logLevels[cfg.LogLevel])
+
+	trustedProxies, err := cfg.TrustedProxyNetworks()
+	if err != nil {
+		exit(err)
+	}
+	e.IPExtractor = setupIPExtractor(trustedProxies)
+
+	passwordPolicy, err := setupPasswordPolicy(cfg.Password)
+	if err != nil {
+		exit(err)
+	}
+
+	passwordChecker, err := setupPasswordChecker(cfg.Password, func(err error) {
+		// The password is accepted, only the breached passwords can't be looked up
+		e.Logger.Errorf("password corpus error: %s", err.Error())
+	})
+	if err != nil {
+		exit(err)
+	}
+
+	validate, err := setupValidator(passwordPolicy, passwordChecker)
+	if err != nil {
+		exit(err)
+	}
+	e.Validator = &handler.UserRegistrationValidator{Validator: validate}
+
+	repo := repository.NewRepository(repository.NewRepositoryOptions{
+		Dsn:                  cfg.Database.URL,
+		MaxOpenConns:         cfg.Database.MaxOpenConns,
+		MaxIdleConns:         cfg.Database.MaxIdleConns,
+		ConnMaxLifetime:      cfg.Database.ConnMaxLifetime,
+		ConnMaxIdleTime:      cfg.Database.ConnMaxIdleTime,
+		PasswordHistoryDepth: cfg.Password.HistoryDepth,
+	})
+
+	// Exposed on /metrics, along with the Go runtime and process statistics
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	appMetrics := metrics.NewMetrics(metrics.NewMetricsOptions{Registry: registry, Db: repo.Db})
+
+	// Everything runs until the process is told to stop
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	// Starting along with the database, e.g. in a fresh docker-compose, shouldn't fail the first requests
+	if cfg.Database.WaitTimeout > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, cfg.Database.WaitTimeout)
+		err = repo.WaitForDatabase(waitCtx, func(err error, delay time.Duration) {
+			e.Logger.Errorf("database unreachable, retrying in %s: %s", delay, err.Error())
+		})
+		cancel()
+
+		if err != nil {
+			exit(fmt.Errorf("database unreachable: %w", err))
+		}
+	}
+
+	// Set up along with the server, whose readiness depends on it
+	var runner *lifecycle.Runner
+
+	migrator, err := migrations.NewMigrator(migrations.NewMigratorOptions{Db: repo.Db})
+	if err != nil {
+		exit(err)
+	}
+
+	server, err := newServer(cfg, repo, appMetrics, passwordPolicy, map[string]handler.ReadinessCheck{
+		"migrations": migrator.Verify,
+		"shutdown": func(_ context.Context) error {
+			if !runner.Ready() {
+				return errors.New("shutting down")
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		exit(err)
+	}
+
+	runner = lifecycle.NewRunner(lifecycle.NewRunnerOptions{
+		Echo:            e,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+		DrainDelay:      cfg.ShutdownDelay,
+		// The server finishes what it left running after the responses before the database pool goes away
+		Closers: []io.Closer{server, repo.Db},
+	})
 
-	var server generated.ServerInterface = newServer()
+	limiter, err := newLimiter(cfg.RateLimit, server, repo.Db, func(err error) {
+		// The request goes through, the limits just aren't enforced while the store is failing
+		e.Logger.Errorf("rate limit store error: %s", err.Error())
+	})
+	if err != nil {
+		exit(err)
+	}
+
+	// Measured first, so the requests turned away by the limits are counted too
+	e.Use(appMetrics.Middleware())
+	e.Use(limiter.Middleware())
 	generated.RegisterHandlers(e, server)
-	e.Logger.Fatal(e.Start(":1323"))
-}
 
-func newServer() *handler.Server {
-	dbDsn := os.Getenv("DATABASE_URL")
-	var repo repository.RepositoryInterface = repository.NewRepository(repository.NewRepositoryOptions{
-		Dsn: dbDsn,
+	// Periodically clean up revoked tokens that have expired anyway
+	go lifecycle.RunPruner(ctx, time.Minute, server.RevocationStore.PruneExpired, func(err error) {
+		e.Logger.Errorf("PruneExpired error: %s", err.Error())
 	})
+
+	// Same for the rate limits
+	go lifecycle.RunPruner(ctx, time.Minute, limiter.Store.PruneExpired, func(err error) {
+		e.Logger.Errorf("PruneExpired error: %s", err.Error())
+	})
+
+	if err = runner.Run(ctx, cfg.ListenAddress); err != nil {
+		e.Logger.Fatal(err)
+	}
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+func newServer(cfg config.Config, repo *repository.Repository, appMetrics *metrics.Metrics, passwordPolicy handler.PasswordPolicy, readinessChecks map[string]handler.ReadinessCheck) (*handler.Server, error) {
+	signingKeys, err := setupSigningKeys(cfg.JWT)
+	if err != nil {
+		return nil, err
+	}
+
+	mfaEncryptionKey, err := setupMFAEncryptionKey(cfg.MFA)
+	if err != nil {
+		return nil, err
+	}
+
+	smsSender, err := setupSMSSender(cfg.SMS)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordHasher, err := setupPasswordHasher(cfg.Password, appMetrics.ObservePasswordHash)
+	if err != nil {
+		return nil, err
+	}
+
 	opts := handler.NewServerOptions{
-		JWTSecretKey: os.Getenv("JWT_SECRET_KEY"),
-		Repository:   repo,
+		JWTSecretKey:     cfg.JWT.SecretKey,
+		SigningKeys:      signingKeys,
+		Repository:       metrics.InstrumentRepository(repo, appMetrics),
+		RevocationStore:  revocation.NewPostgresStore(repo.Db),
+		AccessTokenTTL:   cfg.JWT.AccessTokenTTL,
+		RefreshTokenTTL:  cfg.JWT.RefreshTokenTTL,
+		MFAEncryptionKey: mfaEncryptionKey,
+		MFAIssuer:        cfg.MFA.Issuer,
+		SMSSender:        smsSender,
+		PasswordHasher:   passwordHasher,
+		PasswordPolicy:   passwordPolicy,
+
+		CodeHashKey: []byte(cfg.SMS.CodeHashKey),
+
+		LoginLockoutThreshold: cfg.Login.LockoutThreshold,
+		LoginLockoutWindow:    cfg.Login.LockoutWindow,
+		LoginLockoutDuration:  cfg.Login.LockoutDuration,
+		LoginRetryDelay:       cfg.Login.RetryDelay,
+
+		EnumerationSafe: cfg.Login.EnumerationSafe,
+
+		ReadinessChecks: readinessChecks,
+
+		Metrics: appMetrics,
+	}
+	return handler.NewServer(opts), nil
+}
+
+// setupIPExtractor tells where the client IP is read from, the IP rate limits and the login history rely on it.
+// Anyone can set the forwarded headers, so they're only read from the trusted proxies, the address of the
+// connection being the client IP otherwise.
+func setupIPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// Echo trusts the loopback, link-local and private addresses by default, only the configured proxies are
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, network := range trustedProxies {
+		options = append(options, echo.TrustIPRange(network))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// newLimiter sets up the rate limits, see ratelimit.ParseRules for the format.
+// The limits are kept in the database, so they hold across instances, unless the store is "memory".
+func newLimiter(cfg config.RateLimitConfig, server *handler.Server, db *sql.DB, onError func(error)) (*ratelimit.Limiter, error) {
+	rules, err := ratelimit.ParseRules(cfg.Rules, map[string]ratelimit.KeyFunc{
+		"ip":           ratelimit.ByIP(),
+		"phone_number": ratelimit.ByPhoneNumber(),
+		"user":         ratelimit.ByUser(server.UserIdFromRequest),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var store ratelimit.Store
+	if cfg.Store == "memory" {
+		store = ratelimit.NewMemoryStore()
+	} else {
+		store = ratelimit.NewPostgresStore(db)
 	}
-	return handler.NewServer(opts)
+
+	return ratelimit.NewLimiter(ratelimit.NewLimiterOptions{
+		Store:   store,
+		Rules:   rules,
+		OnError: onError,
+	}), nil
+}
+
+// setupMFAEncryptionKey decodes the key encrypting the TOTP secrets at rest, its size is checked by the validation.
+// Two-factor enrollment is unavailable without it.
+func setupMFAEncryptionKey(cfg config.MFAConfig) ([]byte, error) {
+	if cfg.EncryptionKey == "" {
+		return nil, nil
+	}
+
+	return base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+}
+
+// setupSigningKeys loads the asymmetric keys for signing access tokens, if configured.
+// The signing key file is the PEM private key used for signing, the verification key files the PEM keys
+// that are still accepted, e.g. the key before a rotation.
+// Keys without an explicit ID are identified by their JWK thumbprint.
+func setupSigningKeys(cfg config.JWTConfig) (*handler.KeySet, error) {
+	if cfg.SigningKeyFile == "" {
+		return nil, nil
+	}
+
+	signingKey, err := loadSigningKey(config.KeyFile{Id: cfg.SigningKeyId, Path: cfg.SigningKeyFile})
+	if err != nil {
+		return nil, err
+	}
+
+	var verificationKeys []handler.SigningKey
+	for _, file := range cfg.VerificationKeys() {
+		verificationKey, err := loadSigningKey(file)
+		if err != nil {
+			return nil, err
+		}
+
+		verificationKeys = append(verificationKeys, verificationKey)
+	}
+
+	return handler.NewKeySet(signingKey, verificationKeys...)
 }
 
-func setupValidator() *validator.Validate {
+func loadSigningKey(file config.KeyFile) (handler.SigningKey, error) {
+	pemBytes, err := os.ReadFile(file.Path)
+	if err != nil {
+		return handler.SigningKey{}, err
+	}
+
+	key, err := handler.ParseSigningKey(file.Id, pemBytes)
+	if err != nil {
+		return handler.SigningKey{}, fmt.Errorf("%s: %w", file.Path, err)
+	}
+
+	return key, nil
+}
+
+// setupPasswordHasher configures how new passwords are hashed, Argon2id with the recommended parameters by default.
+// Existing hashes keep working and are upgraded on login.
+//
+// Hashing runs on a bounded number of goroutines, with a bounded queue of requests waiting for them. Past that,
+// requests are turned away with a 503 so a login flood can't starve the rest of the API.
+func setupPasswordHasher(cfg config.PasswordConfig, observe hasher.ObserveFunc) (hasher.PasswordHasher, error) {
+	passwordHasher, err := hasher.NewHasher(hasher.NewHasherOptions{
+		Algorithm:           cfg.HashAlgorithm,
+		BcryptCost:          cfg.BcryptCost,
+		Argon2idMemory:      uint32(cfg.Argon2idMemory),
+		Argon2idIterations:  uint32(cfg.Argon2idIterations),
+		Argon2idParallelism: uint8(cfg.Argon2idParallelism),
+		Observe:             observe,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hasher.NewPool(passwordHasher, hasher.NewPoolOptions{
+		Workers:   cfg.HashWorkers,
+		QueueSize: cfg.HashQueueSize,
+	}), nil
+}
+
+// setupSMSSender picks where text messages go. There's no SMS gateway integration yet, so the messages are
+// appended to the outbox file when it's set, or written to the standard output otherwise.
+func setupSMSSender(cfg config.SMSConfig) (sms.SMSSender, error) {
+	if cfg.OutboxFile == "" {
+		return sms.NewWriterSender(os.Stdout), nil
+	}
+
+	return sms.NewFileSender(cfg.OutboxFile)
+}
+
+func setupValidator(passwordPolicy handler.PasswordPolicy, checker *passwordcheck.Checker) (*validator.Validate, error) {
 	validate := validator.New()
-	_ = validate.RegisterValidation("password", handler.ValidatePassword)
+	if err := handler.RegisterPasswordValidation(validate, passwordPolicy, checker); err != nil {
+		return nil, err
+	}
+
+	return validate, nil
+}
+
+// setupPasswordPolicy loads the rules new passwords must follow from the JSON policy file,
+// e.g. {"min_length": 12, "require_lowercase": true, "max_repeated_characters": 3, "min_entropy_bits": 50}.
+// The fields it doesn't set keep the historical rules, which apply as a whole when there's no file.
+func setupPasswordPolicy(cfg config.PasswordConfig) (handler.PasswordPolicy, error) {
+	if cfg.PolicyFile == "" {
+		return handler.DefaultPasswordPolicy(), nil
+	}
+
+	return handler.LoadPasswordPolicy(cfg.PolicyFile)
+}
+
+// setupPasswordChecker loads the passwords users can't choose. A short list of the most common ones is embedded,
+// the common passwords file replaces it with a longer one, one password per line. The pwned passwords directory adds
+// an offline copy of the Have I Been Pwned range files, ignoring the passwords seen fewer than the minimum count.
+func setupPasswordChecker(cfg config.PasswordConfig, onError func(err error)) (*passwordcheck.Checker, error) {
+	var commonPasswords passwordcheck.Corpus = passwordcheck.DefaultListCorpus()
+	if cfg.CommonPasswordsFile != "" {
+		listCorpus, err := passwordcheck.LoadListCorpus(cfg.CommonPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		commonPasswords = listCorpus
+	}
+
+	corpora := []passwordcheck.Corpus{commonPasswords}
+	if cfg.PwnedPasswordsDir != "" {
+		hibpCorpus, err := passwordcheck.NewHIBPCorpus(passwordcheck.NewHIBPCorpusOptions{
+			Dir:      cfg.PwnedPasswordsDir,
+			MinCount: cfg.PwnedPasswordsMinCount,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		corpora = append(corpora, hibpCorpus)
+	}
 
-	return validate
+	return passwordcheck.NewChecker(passwordcheck.NewCheckerOptions{Corpora: corpora, OnError: onError}), nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dityuiri/UserServiceTest/config"
+	"github.com/dityuiri/UserServiceTest/migrations"
+)
+
+const migrateUsage = "usage: main migrate up | down | status | to <version>"
+
+// runMigrate manages the schema of the configured database:
+//
+//	migrate up            applies every pending migration
+//	migrate down          reverts the latest applied migration
+//	migrate status        lists the migrations and whether they're applied
+//	migrate to <version>  applies or reverts the migrations until the schema is at the version, 0 reverting all
+//
+// Instances migrating at the same time wait for each other, so it's safe to run on every deployment.
+func runMigrate(args []string, cfg config.Config, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	// Only the database matters here, the rest doesn't have to be valid
+	if cfg.Database.URL == "" {
+		return errors.New("database.url (DATABASE_URL) is required")
+	}
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrations.NewMigrator(migrations.NewMigratorOptions{Db: db})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		err = migrator.Up(ctx)
+	case args[0] == "down" && len(args) == 1:
+		err = migrator.Down(ctx)
+	case args[0] == "to" && len(args) == 2:
+		version, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		err = migrator.To(ctx, version)
+	case args[0] == "status" && len(args) == 1:
+		// Only prints the status below
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return printMigrationStatus(ctx, migrator, out)
+}
+
+func printMigrationStatus(ctx context.Context, migrator *migrations.Migrator, out io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied at " + status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+
+		if _, err = fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,68 @@
 // Package common errors: Error variables that can be shared across layer
 package common
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
+// Outcomes the repository reports by design, declared with newExpectedError so IsExpected recognizes them
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound            = newExpectedError("user not found")
+	ErrUserVersionMismatch     = newExpectedError("user has been modified")
+	ErrRefreshTokenNotFound    = newExpectedError("refresh token not found")
+	ErrRefreshTokenAlreadyUsed = newExpectedError("refresh token already used")
+	ErrSessionNotFound         = newExpectedError("session not found")
+	ErrMFANotFound             = newExpectedError("two-factor authentication is not enrolled")
+	ErrMFAAlreadyEnabled       = newExpectedError("two-factor authentication is already enabled")
+	ErrMFACodeAlreadyUsed      = newExpectedError("one-time code has already been used")
+	ErrMFARecoveryCodeNotFound = newExpectedError("recovery code not found")
+
+	ErrPhoneVerificationNotFound         = newExpectedError("phone verification not found")
+	ErrPhoneVerificationCooldown         = newExpectedError("verification code was sent too recently")
+	ErrPhoneVerificationAttemptsExceeded = newExpectedError("too many verification attempts")
+
+	ErrPasswordResetNotFound         = newExpectedError("password reset not found")
+	ErrPasswordResetCooldown         = newExpectedError("password reset code was sent too recently")
+	ErrPasswordResetAttemptsExceeded = newExpectedError("too many password reset attempts")
 )
+
+// errExpected marks the outcomes the repository reports by design, as opposed to the database failing
+var errExpected = errors.New("expected error")
+
+// expectedError is an error marked as expected, see IsExpected
+type expectedError struct {
+	msg string
+}
+
+func newExpectedError(msg string) error {
+	return &expectedError{msg: msg}
+}
+
+func (e *expectedError) Error() string {
+	return e.msg
+}
+
+func (e *expectedError) Is(target error) bool {
+	return target == errExpected
+}
+
+// UniqueViolationError is returned when a write is rejected because the value is already taken, e.g. a phone number
+// registered to another user. Constraint names the violated unique constraint.
+type UniqueViolationError struct {
+	Constraint string
+}
+
+func (e *UniqueViolationError) Error() string {
+	return fmt.Sprintf("duplicate value violates unique constraint %q", e.Constraint)
+}
+
+func (e *UniqueViolationError) Is(target error) bool {
+	return target == errExpected
+}
+
+// IsExpected tells whether the error is one of the outcomes the repository reports by design,
+// e.g. a user not found or a phone number already taken, rather than a failure of the database
+func IsExpected(err error) bool {
+	return errors.Is(err, errExpected)
+}
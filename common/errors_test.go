@@ -0,0 +1,65 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsExpected(t *testing.T) {
+	t.Run("sentinel errors", func(t *testing.T) {
+		assert.True(t, IsExpected(ErrUserNotFound))
+		assert.True(t, IsExpected(fmt.Errorf("get user: %w", ErrPasswordResetCooldown)))
+		assert.True(t, errors.Is(ErrUserNotFound, ErrUserNotFound))
+		assert.False(t, errors.Is(ErrUserNotFound, ErrSessionNotFound))
+		assert.Equal(t, "user not found", ErrUserNotFound.Error())
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		assert.True(t, IsExpected(&UniqueViolationError{Constraint: "phone_number_key"}))
+		assert.True(t, IsExpected(fmt.Errorf("insert user: %w", &UniqueViolationError{})))
+	})
+
+	t.Run("database failures", func(t *testing.T) {
+		assert.False(t, IsExpected(nil))
+		assert.False(t, IsExpected(errors.New("connection refused")))
+	})
+
+	// A sentinel declared with errors.New wouldn't be recognized, so the metrics would count it as a failure
+	t.Run("every sentinel is marked as expected", func(t *testing.T) {
+		file, err := parser.ParseFile(token.NewFileSet(), "errors.go", nil, 0)
+		if err != nil {
+			t.Fatalf("Error parsing errors.go: %v", err)
+		}
+
+		var sentinels int
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+
+			for i, name := range spec.Names {
+				if !strings.HasPrefix(name.Name, "Err") {
+					continue
+				}
+
+				sentinels++
+				call, ok := spec.Values[i].(*ast.CallExpr)
+				if assert.True(t, ok, name.Name) {
+					assert.Equal(t, "newExpectedError", fmt.Sprint(call.Fun), name.Name)
+				}
+			}
+
+			return false
+		})
+
+		assert.NotZero(t, sentinels)
+	})
+}
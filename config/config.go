@@ -0,0 +1,279 @@
+// Package config loads the settings of the service. Every setting has a default, which the configuration file,
+// the environment variables and the command line flags override in turn.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Settings left at zero fall back to the defaults of the package using them, e.g. the login lockout thresholds
+type Config struct {
+	ListenAddress string `yaml:"listen_address"`
+
+	// Comma separated IPs or CIDRs of the proxies in front of the service, whose X-Forwarded-For is trusted
+	// for the client IP. The client IP is the address of the connection when empty.
+	TrustedProxies string `yaml:"trusted_proxies"`
+
+	// Requests in flight are given ShutdownTimeout to complete once the service is told to stop, after failing
+	// the readiness for ShutdownDelay so the load balancers stop sending new ones
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+
+	// One of debug, info, warn, error or off
+	LogLevel string `yaml:"log_level"`
+
+	Database  DatabaseConfig  `yaml:"database"`
+	JWT       JWTConfig       `yaml:"jwt"`
+	MFA       MFAConfig       `yaml:"mfa"`
+	Password  PasswordConfig  `yaml:"password"`
+	Login     LoginConfig     `yaml:"login"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	SMS       SMSConfig       `yaml:"sms"`
+}
+
+type DatabaseConfig struct {
+	URL string `yaml:"url"`
+
+	// Connection pool, the database/sql defaults are kept for the settings left at zero
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+
+	// How long the service waits for the database to answer when starting, not at all when zero
+	WaitTimeout time.Duration `yaml:"wait_timeout"`
+}
+
+type JWTConfig struct {
+	// Signs the access tokens with HS256, unless SigningKeyFile is set
+	SecretKey string `yaml:"secret_key"`
+
+	// PEM private key signing the access tokens, and the comma separated "[kid=]path" PEM keys still accepted,
+	// e.g. the key before a rotation
+	SigningKeyFile       string `yaml:"signing_key_file"`
+	SigningKeyId         string `yaml:"signing_key_id"`
+	VerificationKeyFiles string `yaml:"verification_key_files"`
+
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
+}
+
+type MFAConfig struct {
+	// Base64 of the 32 bytes key encrypting the TOTP secrets, two-factor enrollment is unavailable without it
+	EncryptionKey string `yaml:"encryption_key"`
+	Issuer        string `yaml:"issuer"`
+}
+
+type PasswordConfig struct {
+	// JSON file of the rules new passwords must follow, see handler.LoadPasswordPolicy
+	PolicyFile   string `yaml:"policy_file"`
+	HistoryDepth int    `yaml:"history_depth"`
+
+	// Either argon2id or bcrypt, existing hashes keep working and are upgraded on login
+	HashAlgorithm       string `yaml:"hash_algorithm"`
+	BcryptCost          int    `yaml:"bcrypt_cost"`
+	Argon2idMemory      int    `yaml:"argon2id_memory"`
+	Argon2idIterations  int    `yaml:"argon2id_iterations"`
+	Argon2idParallelism int    `yaml:"argon2id_parallelism"`
+
+	// Hashing goroutines and the requests waiting for them, past that requests are turned away with a 503
+	HashWorkers   int `yaml:"hash_workers"`
+	HashQueueSize int `yaml:"hash_queue_size"`
+
+	CommonPasswordsFile    string `yaml:"common_passwords_file"`
+	PwnedPasswordsDir      string `yaml:"pwned_passwords_dir"`
+	PwnedPasswordsMinCount int    `yaml:"pwned_passwords_min_count"`
+}
+
+type LoginConfig struct {
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutWindow    time.Duration `yaml:"lockout_window"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`
+	RetryDelay       time.Duration `yaml:"retry_delay"`
+	EnumerationSafe  bool          `yaml:"enumeration_safe"`
+}
+
+type RateLimitConfig struct {
+	// See ratelimit.ParseRules for the format, no limits when empty
+	Rules string `yaml:"rules"`
+
+	// Either postgres, so the limits hold across instances, or memory
+	Store string `yaml:"store"`
+}
+
+type SMSConfig struct {
+	// Text messages are appended to the file, or written to the standard output when it's not set
+	OutboxFile string `yaml:"outbox_file"`
+
+	// Secret keying the hashes of the codes sent by text message, so they can't be recovered from the stored hashes
+	CodeHashKey string `yaml:"code_hash_key"`
+}
+
+// Default rate limits
+const defaultRateLimitRules = `
+	POST /user/register ip token_bucket 10/1h
+	POST /user/login ip token_bucket 20/1m
+	POST /user/login phone_number sliding_window 10/15m
+	POST /user/password/reset/request ip token_bucket 10/1h
+	POST /user/password/reset/request phone_number sliding_window 3/1h
+	POST /user/phone/verify/request user sliding_window 5/1h
+`
+
+func Default() Config {
+	return Config{
+		ListenAddress:   ":1323",
+		ShutdownTimeout: 30 * time.Second,
+		LogLevel:        "error",
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		JWT: JWTConfig{
+			AccessTokenTTL:  2 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Password: PasswordConfig{
+			HashAlgorithm: "argon2id",
+			BcryptCost:    10,
+		},
+		RateLimit: RateLimitConfig{
+			Rules: defaultRateLimitRules,
+			Store: "postgres",
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file given by -config or CONFIG_FILE,
+// the environment variables and the command line flags, in that order of precedence. The arguments
+// left after the flags are returned along with it, e.g. a subcommand.
+//
+// Malformed values fail the load, missing or inconsistent ones are only reported by Validate.
+func Load(args []string, lookupEnv func(key string) (string, bool), output io.Writer) (cfg Config, rest []string, err error) {
+	cfg = Default()
+
+	// The flags are parsed first to find the file, but only applied last. Their values are checked
+	// on a scratch configuration meanwhile.
+	scratch := Default()
+	flags := flag.NewFlagSet("main", flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", "", "YAML configuration file, also given by CONFIG_FILE")
+	for _, s := range scratch.settings() {
+		flags.Var(s.value, s.flag(), s.usage+" ("+s.env+")")
+	}
+
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+
+	if *configFile != "" {
+		if err = cfg.loadFile(*configFile); err != nil {
+			return
+		}
+	}
+
+	settings := cfg.settings()
+	for _, s := range settings {
+		value, ok := lookupEnv(s.env)
+		if !ok || (value == "" && !s.allowEmpty) {
+			continue
+		}
+
+		if err = s.value.Set(value); err != nil {
+			return cfg, nil, fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag() == f.Name && err == nil {
+				err = s.value.Set(f.Value.String())
+			}
+		}
+	})
+
+	return cfg, flags.Args(), err
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// TrustedProxyNetworks parses the trusted proxies, a single IP standing for a network of its own
+func (c Config) TrustedProxyNetworks() ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, proxy := range strings.Split(c.TrustedProxies, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is neither an IP nor a CIDR", proxy)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// KeyFile is a PEM key file, along with the ID of the key when it's given
+type KeyFile struct {
+	Id   string
+	Path string
+}
+
+// VerificationKeys parses the verification key files, a comma separated list of "[kid=]path"
+func (c JWTConfig) VerificationKeys() []KeyFile {
+	var files []KeyFile
+	for _, file := range strings.Split(c.VerificationKeyFiles, ",") {
+		var id string
+		if i := strings.Index(file, "="); i >= 0 {
+			id, file = file[:i], file[i+1:]
+		}
+
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, KeyFile{Id: strings.TrimSpace(id), Path: file})
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting binds a field of the configuration to its key in the file, its environment variable and its flag
+type setting struct {
+	key   string
+	env   string
+	usage string
+	value flag.Value
+
+	// Whether the environment variable still applies when it's set but empty
+	allowEmpty bool
+}
+
+// flag is the name of the command line flag, the key with dashes, e.g. -jwt-access-token-ttl
+func (s setting) flag() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "listen_address", env: "LISTEN_ADDRESS", usage: "Address the HTTP server listens on", value: stringValue{&c.ListenAddress}},
+		{key: "trusted_proxies", env: "TRUSTED_PROXIES", usage: "Comma separated IPs or CIDRs of the proxies whose X-Forwarded-For is trusted", value: stringValue{&c.TrustedProxies}},
+		{key: "shutdown_timeout", env: "SHUTDOWN_TIMEOUT", usage: "How long the requests in flight are given to complete on shutdown", value: durationValue{&c.ShutdownTimeout}},
+		{key: "shutdown_delay", env: "SHUTDOWN_DELAY", usage: "How long the readiness fails before the server stops accepting requests", value: durationValue{&c.ShutdownDelay}},
+		{key: "log_level", env: "LOG_LEVEL", usage: "One of debug, info, warn, error or off", value: stringValue{&c.LogLevel}},
+
+		{key: "database.url", env: "DATABASE_URL", usage: "Postgres connection string", value: stringValue{&c.Database.URL}},
+		{key: "database.max_open_conns", env: "DATABASE_MAX_OPEN_CONNS", usage: "Open connections at most", value: intValue{&c.Database.MaxOpenConns}},
+		{key: "database.max_idle_conns", env: "DATABASE_MAX_IDLE_CONNS", usage: "Idle connections kept at most", value: intValue{&c.Database.MaxIdleConns}},
+		{key: "database.conn_max_lifetime", env: "DATABASE_CONN_MAX_LIFETIME", usage: "Connections are closed after this long", value: durationValue{&c.Database.ConnMaxLifetime}},
+		{key: "database.conn_max_idle_time", env: "DATABASE_CONN_MAX_IDLE_TIME", usage: "Connections are closed after being idle this long", value: durationValue{&c.Database.ConnMaxIdleTime}},
+
+		{key: "database.wait_timeout", env: "DATABASE_WAIT_TIMEOUT", usage: "How long to wait for the database when starting, not at all when zero", value: durationValue{&c.Database.WaitTimeout}},
+
+		{key: "jwt.secret_key", env: "JWT_SECRET_KEY", usage: "Secret signing the access tokens with HS256, at least 32 bytes", value: stringValue{&c.JWT.SecretKey}},
+		{key: "jwt.signing_key_file", env: "JWT_SIGNING_KEY_FILE", usage: "PEM private key signing the access tokens instead of the secret", value: stringValue{&c.JWT.SigningKeyFile}},
+		{key: "jwt.signing_key_id", env: "JWT_SIGNING_KEY_ID", usage: "ID of the signing key, its JWK thumbprint by default", value: stringValue{&c.JWT.SigningKeyId}},
+		{key: "jwt.verification_key_files", env: "JWT_VERIFICATION_KEY_FILES", usage: `Comma separated "[kid=]path" PEM keys still accepted`, value: stringValue{&c.JWT.VerificationKeyFiles}},
+		{key: "jwt.access_token_ttl", env: "ACCESS_TOKEN_TTL", usage: "Lifetime of the access tokens", value: durationValue{&c.JWT.AccessTokenTTL}},
+		{key: "jwt.refresh_token_ttl", env: "REFRESH_TOKEN_TTL", usage: "Lifetime of the refresh tokens", value: durationValue{&c.JWT.RefreshTokenTTL}},
+
+		{key: "mfa.encryption_key", env: "MFA_ENCRYPTION_KEY", usage: "Base64 of the 32 bytes key encrypting the TOTP secrets", value: stringValue{&c.MFA.EncryptionKey}},
+		{key: "mfa.issuer", env: "MFA_ISSUER", usage: "Issuer shown in the authenticator apps", value: stringValue{&c.MFA.Issuer}},
+
+		{key: "password.policy_file", env: "PASSWORD_POLICY_FILE", usage: "JSON file of the rules new passwords must follow", value: stringValue{&c.Password.PolicyFile}},
+		{key: "password.history_depth", env: "PASSWORD_HISTORY_DEPTH", usage: "Recent passwords, including the current one, that can't be reused", value: intValue{&c.Password.HistoryDepth}},
+		{key: "password.hash_algorithm", env: "PASSWORD_HASH_ALGORITHM", usage: "Either argon2id or bcrypt", value: stringValue{&c.Password.HashAlgorithm}},
+		{key: "password.bcrypt_cost", env: "BCRYPT_COST", usage: "Cost of the bcrypt hashes", value: intValue{&c.Password.BcryptCost}},
+		{key: "password.argon2id_memory", env: "ARGON2ID_MEMORY", usage: "Memory of the Argon2id hashes, in KiB", value: intValue{&c.Password.Argon2idMemory}},
+		{key: "password.argon2id_iterations", env: "ARGON2ID_ITERATIONS", usage: "Iterations of the Argon2id hashes", value: intValue{&c.Password.Argon2idIterations}},
+		{key: "password.argon2id_parallelism", env: "ARGON2ID_PARALLELISM", usage: "Parallelism of the Argon2id hashes", value: intValue{&c.Password.Argon2idParallelism}},
+		{key: "password.hash_workers", env: "PASSWORD_HASH_WORKERS", usage: "Passwords hashed at the same time at most", value: intValue{&c.Password.HashWorkers}},
+		{key: "password.hash_queue_size", env: "PASSWORD_HASH_QUEUE_SIZE", usage: "Passwords waiting to be hashed at most", value: intValue{&c.Password.HashQueueSize}},
+		{key: "password.common_passwords_file", env: "COMMON_PASSWORDS_FILE", usage: "List of the passwords users can't choose, one per line", value: stringValue{&c.Password.CommonPasswordsFile}},
+		{key: "password.pwned_passwords_dir", env: "PWNED_PASSWORDS_DIR", usage: "Offline copy of the Have I Been Pwned range files", value: stringValue{&c.Password.PwnedPasswordsDir}},
+		{key: "password.pwned_passwords_min_count", env: "PWNED_PASSWORDS_MIN_COUNT", usage: "Breached passwords seen fewer times are allowed", value: intValue{&c.Password.PwnedPasswordsMinCount}},
+
+		{key: "login.lockout_threshold", env: "LOGIN_LOCKOUT_THRESHOLD", usage: "Consecutive failed logins before the account is locked", value: intValue{&c.Login.LockoutThreshold}},
+		{key: "login.lockout_window", env: "LOGIN_LOCKOUT_WINDOW", usage: "Failed logins older than this are forgotten", value: durationValue{&c.Login.LockoutWindow}},
+		{key: "login.lockout_duration", env: "LOGIN_LOCKOUT_DURATION", usage: "How long a locked account stays locked", value: durationValue{&c.Login.LockoutDuration}},
+		{key: "login.retry_delay", env: "LOGIN_RETRY_DELAY", usage: "First delay between failed logins, doubling on every failure", value: durationValue{&c.Login.RetryDelay}},
+		{key: "login.enumeration_safe", env: "ENUMERATION_SAFE", usage: "Respond the same whether the phone number is registered or not", value: boolValue{&c.Login.EnumerationSafe}},
+
+		{key: "rate_limit.rules", env: "RATE_LIMIT_RULES", usage: "Rate limits, none when empty", value: stringValue{&c.RateLimit.Rules}, allowEmpty: true},
+		{key: "rate_limit.store", env: "RATE_LIMIT_STORE", usage: "Either postgres or memory", value: stringValue{&c.RateLimit.Store}},
+
+		{key: "sms.outbox_file", env: "SMS_OUTBOX_FILE", usage: "File the text messages are appended to, the standard output by default", value: stringValue{&c.SMS.OutboxFile}},
+		{key: "sms.code_hash_key", env: "SMS_CODE_HASH_KEY", usage: "Secret keying the hashes of the codes sent by text message, at least 32 bytes", value: stringValue{&c.SMS.CodeHashKey}},
+	}
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(s string) error {
+	*v.p = s
+	return nil
+}
+
+func (v stringValue) String() string {
+	if v.p == nil {
+		return ""
+	}
+
+	return *v.p
+}
+
+type intValue struct{ p *int }
+
+func (v intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("must be an integer")
+	}
+
+	*v.p = n
+	return nil
+}
+
+func (v intValue) String() string {
+	if v.p == nil {
+		return "0"
+	}
+
+	return strconv.Itoa(*v.p)
+}
+
+type durationValue struct{ p *time.Duration }
+
+func (v durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New(`must be a duration such as "15m"`)
+	}
+
+	*v.p = d
+	return nil
+}
+
+func (v durationValue) String() string {
+	if v.p == nil {
+		return "0s"
+	}
+
+	return v.p.String()
+}
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return errors.New("must be a boolean")
+	}
+
+	*v.p = b
+	return nil
+}
+
+func (v boolValue) String() string {
+	if v.p == nil {
+		return "false"
+	}
+
+	return strconv.FormatBool(*v.p)
+}
+
+// IsBoolFlag lets the flag be given without a value, e.g. -login-enumeration-safe
+func (v boolValue) IsBoolFlag() bool {
+	return true
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/dityuiri/UserServiceTest/ratelimit"
+)
+
+// Shortest JWT secret accepted, HS256 keys shorter than the hash output weaken the signature
+const minJWTSecretKeyLength = 32
+
+// Shortest key accepted for the hashes of the codes, for the same reason
+const minCodeHashKeyLength = 32
+
+// Keys the rate limits can be counted by. Only the names are needed to check the rules,
+// the functions come with the server.
+var rateLimitKeys = map[string]ratelimit.KeyFunc{
+	"ip":           nil,
+	"phone_number": nil,
+	"user":         nil,
+}
+
+// Validate reports every missing or inconsistent setting at once, so they can all be fixed before the next start
+func (c Config) Validate() error {
+	var problems []string
+	report := func(key string, format string, args ...interface{}) {
+		problem := key
+		for _, s := range c.settings() {
+			if s.key == key {
+				problem += " (" + s.env + ")"
+			}
+		}
+
+		problems = append(problems, problem+": "+fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddress); err != nil {
+		report("listen_address", `must be a "host:port" address such as ":1323"`)
+	}
+
+	if _, err := c.TrustedProxyNetworks(); err != nil {
+		report("trusted_proxies", "%s", err.Error())
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		report("shutdown_timeout", "must be positive")
+	}
+
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error", "off":
+	default:
+		report("log_level", "must be one of debug, info, warn, error or off")
+	}
+
+	if c.Database.URL == "" {
+		report("database.url", "is required")
+	}
+
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		report("database.max_idle_conns", "can't be more than database.max_open_conns")
+	}
+
+	// The secret is only used when the tokens aren't signed with a key pair
+	if c.JWT.SigningKeyFile == "" {
+		switch {
+		case c.JWT.SecretKey == "":
+			report("jwt.secret_key", "is required unless jwt.signing_key_file is set")
+		case len(c.JWT.SecretKey) < minJWTSecretKeyLength:
+			report("jwt.secret_key", "must be at least %d bytes", minJWTSecretKeyLength)
+		}
+	}
+
+	// The files are only read when starting, a typo in their path shouldn't wait until then
+	if c.JWT.SigningKeyFile != "" {
+		if err := checkReadable(c.JWT.SigningKeyFile, false); err != nil {
+			report("jwt.signing_key_file", "%s", err.Error())
+		}
+	}
+
+	for _, file := range c.JWT.VerificationKeys() {
+		if err := checkReadable(file.Path, false); err != nil {
+			report("jwt.verification_key_files", "%s", err.Error())
+		}
+	}
+
+	if c.JWT.AccessTokenTTL > 0 && c.JWT.RefreshTokenTTL > 0 && c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		report("jwt.refresh_token_ttl", "must be longer than jwt.access_token_ttl")
+	}
+
+	if c.MFA.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(c.MFA.EncryptionKey)
+		if err != nil || len(key) != 32 {
+			report("mfa.encryption_key", "must be the base64 encoding of 32 bytes")
+		}
+	}
+
+	switch c.Password.HashAlgorithm {
+	case "argon2id", "bcrypt":
+	default:
+		report("password.hash_algorithm", "must be either argon2id or bcrypt")
+	}
+
+	if c.Password.BcryptCost < bcrypt.MinCost || c.Password.BcryptCost > bcrypt.MaxCost {
+		report("password.bcrypt_cost", "must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	if int64(c.Password.Argon2idMemory) > math.MaxUint32 {
+		report("password.argon2id_memory", "must be at most %d", uint32(math.MaxUint32))
+	}
+
+	if int64(c.Password.Argon2idIterations) > math.MaxUint32 {
+		report("password.argon2id_iterations", "must be at most %d", uint32(math.MaxUint32))
+	}
+
+	if c.Password.Argon2idParallelism > math.MaxUint8 {
+		report("password.argon2id_parallelism", "must be at most %d", math.MaxUint8)
+	}
+
+	if c.Password.PolicyFile != "" {
+		if err := checkReadable(c.Password.PolicyFile, false); err != nil {
+			report("password.policy_file", "%s", err.Error())
+		}
+	}
+
+	if c.Password.CommonPasswordsFile != "" {
+		if err := checkReadable(c.Password.CommonPasswordsFile, false); err != nil {
+			report("password.common_passwords_file", "%s", err.Error())
+		}
+	}
+
+	if c.Password.PwnedPasswordsDir != "" {
+		if err := checkReadable(c.Password.PwnedPasswordsDir, true); err != nil {
+			report("password.pwned_passwords_dir", "%s", err.Error())
+		}
+	}
+
+	if _, err := ratelimit.ParseRules(c.RateLimit.Rules, rateLimitKeys); err != nil {
+		report("rate_limit.rules", "%s", err.Error())
+	}
+
+	switch c.RateLimit.Store {
+	case "postgres", "memory":
+	default:
+		report("rate_limit.store", "must be either postgres or memory")
+	}
+
+	switch {
+	case c.SMS.CodeHashKey == "":
+		report("sms.code_hash_key", "is required")
+	case len(c.SMS.CodeHashKey) < minCodeHashKeyLength:
+		report("sms.code_hash_key", "must be at least %d bytes", minCodeHashKeyLength)
+	}
+
+	// Zero falls back to the defaults, but nothing can be negative
+	for _, s := range c.settings() {
+		switch v := s.value.(type) {
+		case intValue:
+			if *v.p < 0 {
+				report(s.key, "can't be negative")
+			}
+		case durationValue:
+			if *v.p < 0 {
+				report(s.key, "can't be negative")
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n\t" + strings.Join(problems, "\n\t"))
+	}
+
+	return nil
+}
+
+// checkReadable tells why the file, or the directory, can't be read
+func checkReadable(path string, dir bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case dir && !info.IsDir():
+		return fmt.Errorf("%s is not a directory", path)
+	case !dir && info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	return nil
+}
@@ -1,9 +1,10 @@
 package handler
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+)
 
 // Function aliasing for helping cover unit test
 var (
-	GenerateFromPassword   = bcrypt.GenerateFromPassword
-	CompareHashAndPassword = bcrypt.CompareHashAndPassword
+	RandRead = rand.Read
 )
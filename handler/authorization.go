@@ -1,23 +1,88 @@
 package handler
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/revocation"
+)
+
+// Size of the random part of an opaque refresh token, in bytes
+const refreshTokenSize = 32
+
+// Values of the "typ" claim, so a token can't be used for something it wasn't issued for
+const (
+	accessTokenType       = "access"
+	mfaChallengeTokenType = "mfa_challenge"
+)
+
+// Reasons a token is rejected for, told apart by tokenValidationFailureCause
+var (
+	errMissingToken        = errors.New("missing JWT token")
+	errMalformedToken      = errors.New("invalid JWT token")
+	errUnexpectedTokenType = errors.New("unexpected token type")
+	errInvalidTokenClaims  = errors.New("invalid token claims")
+	errTokenRevoked        = errors.New("token has been revoked")
 )
 
-func (s *Server) generateJWTToken(id string) (string, error) {
-	// By default, set the expiration time for 2 minutes
-	expirationTime := time.Now().Add(2 * time.Minute)
+// accessTokenClaims holds the claims of a verified access token
+type accessTokenClaims struct {
+	UserId    string
+	TokenId   string
+	SessionId string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// generateJWTToken generates an access token for the user. The session ID ties the
+// access token to the refresh token family it was issued with.
+func (s *Server) generateJWTToken(id string, sessionId string) (string, error) {
+	now := time.Now()
 	claims := &jwt.MapClaims{
 		"id":  id,
-		"exp": jwt.NewNumericDate(expirationTime),
+		"jti": uuid.New().String(),
+		"sid": sessionId,
+		"typ": accessTokenType,
+		"iat": jwt.NewNumericDate(now),
+		"exp": jwt.NewNumericDate(now.Add(s.AccessTokenTTL)),
+	}
+
+	return s.signJWTToken(claims)
+}
+
+// revokeUserTokens revokes every access token of the user issued before now. The "iat" claim is in whole seconds,
+// so is the revocation: a token issued later within the same second, e.g. by logging in again right away, is accepted.
+func (s *Server) revokeUserTokens(ctx context.Context, userId string, now time.Time) error {
+	revokeUserTokensInput := revocation.RevokeUserTokensInput{
+		UserId:    userId,
+		RevokedAt: now.Truncate(time.Second),
+		ExpiresAt: now.Add(s.AccessTokenTTL),
+	}
+
+	return s.RevocationStore.RevokeUserTokens(ctx, revokeUserTokensInput)
+}
+
+// signJWTToken signs the claims with the current signing key
+func (s *Server) signJWTToken(claims *jwt.MapClaims) (string, error) {
+	// Fallback to the shared secret when no asymmetric key is configured
+	if s.SigningKeys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(s.JWTSecretKey))
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.JWTSecretKey))
+	signingKey := s.SigningKeys.SigningKey()
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.Id
+	tokenString, err := token.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		return "", err
 	}
@@ -26,18 +91,77 @@ func (s *Server) generateJWTToken(id string) (string, error) {
 }
 
 func (s *Server) retrieveAndGetIdFromJWTToken(ctx echo.Context) (string, error) {
-	token, err := s.retrieveJWTToken(ctx)
+	claims, err := s.retrieveAndGetClaimsFromJWTToken(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	// Get ID from JWT token
-	userId, err := s.getIdFromJWTToken(token)
+	return claims.UserId, nil
+}
+
+// UserIdFromRequest returns the ID of the user authenticated by the access token of the request,
+// for the middlewares that need to tell users apart. The rejected tokens aren't counted, the handler
+// checks the same token again.
+func (s *Server) UserIdFromRequest(ctx echo.Context) (string, error) {
+	claims, err := s.verifyRequestToken(ctx)
 	if err != nil {
 		return "", err
 	}
 
-	return userId, nil
+	return claims.UserId, nil
+}
+
+func (s *Server) retrieveAndGetClaimsFromJWTToken(ctx echo.Context) (accessTokenClaims, error) {
+	claims, err := s.verifyRequestToken(ctx)
+	if err != nil {
+		s.countTokenValidationFailure(accessTokenType, tokenValidationFailureCause(err))
+	}
+
+	return claims, err
+}
+
+// verifyRequestToken checks the access token of the request, including whether it has been revoked
+func (s *Server) verifyRequestToken(ctx echo.Context) (accessTokenClaims, error) {
+	token, err := s.retrieveJWTToken(ctx)
+	if err != nil {
+		return accessTokenClaims{}, err
+	}
+
+	// Get claims from JWT token
+	claims, err := s.getClaimsFromJWTToken(token)
+	if err != nil {
+		return accessTokenClaims{}, err
+	}
+
+	// Check whether the token, or the session it was issued within, has been revoked
+	isRevokedInput := revocation.IsRevokedInput{
+		TokenId:   claims.TokenId,
+		UserId:    claims.UserId,
+		SessionId: claims.SessionId,
+		IssuedAt:  claims.IssuedAt,
+	}
+
+	revoked, err := s.RevocationStore.IsRevoked(ctx.Request().Context(), isRevokedInput)
+	if err != nil {
+		return accessTokenClaims{}, err
+	}
+
+	if revoked {
+		return accessTokenClaims{}, errTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// revokeSessionAccessTokens rejects the access tokens already issued within the session,
+// they all expire within one access token TTL
+func (s *Server) revokeSessionAccessTokens(ctx context.Context, sessionId uuid.UUID) error {
+	revokeSessionInput := revocation.RevokeSessionInput{
+		SessionId: sessionId.String(),
+		ExpiresAt: time.Now().Add(s.AccessTokenTTL),
+	}
+
+	return s.RevocationStore.RevokeSession(ctx, revokeSessionInput)
 }
 
 func (s *Server) retrieveJWTToken(c echo.Context) (string, error) {
@@ -45,13 +169,13 @@ func (s *Server) retrieveJWTToken(c echo.Context) (string, error) {
 
 	// Get the auth header
 	if authHeader == "" {
-		return "", errors.New("missing JWT token")
+		return "", errMissingToken
 	}
 
 	// Check if it's valid token by escape the "Bearer"
 	token := s.extractToken(authHeader)
 	if token == "" {
-		return "", errors.New("invalid JWT token")
+		return "", errMalformedToken
 	}
 
 	return token, nil
@@ -65,20 +189,105 @@ func (s *Server) extractToken(authHeader string) string {
 	return ""
 }
 
-func (s *Server) getIdFromJWTToken(token string) (string, error) {
+func (s *Server) getClaimsFromJWTToken(token string) (accessTokenClaims, error) {
+	return s.parseJWTToken(token, accessTokenType)
+}
+
+// parseJWTToken verifies the token and returns its claims, as long as it was issued for the expected purpose.
+// Access tokens issued before the "typ" claim was introduced don't have one, so they're still accepted.
+func (s *Server) parseJWTToken(token string, tokenType string) (accessTokenClaims, error) {
 	claims := &jwt.MapClaims{}
-	tkn, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(s.JWTSecretKey), nil
-	})
+	tkn, err := jwt.ParseWithClaims(token, claims, s.getVerificationKey)
 
 	if err != nil {
-		return "", err
+		return accessTokenClaims{}, err
 	}
 
 	if !tkn.Valid {
-		return "", errors.New("token is no longer valid")
+		return accessTokenClaims{}, errors.New("token is no longer valid")
+	}
+
+	validClaims := *tkn.Claims.(*jwt.MapClaims)
+	userId, _ := validClaims["id"].(string)
+	tokenId, _ := validClaims["jti"].(string)
+	sessionId, _ := validClaims["sid"].(string)
+	issuedAt, _ := validClaims.GetIssuedAt()
+	expiresAt, _ := validClaims.GetExpirationTime()
+
+	actualType, _ := validClaims["typ"].(string)
+	if actualType != tokenType && !(actualType == "" && tokenType == accessTokenType) {
+		return accessTokenClaims{}, errUnexpectedTokenType
+	}
+
+	// Tokens without these claims can't be revoked, so they're not accepted
+	if userId == "" || tokenId == "" || issuedAt == nil || expiresAt == nil {
+		return accessTokenClaims{}, errInvalidTokenClaims
+	}
+
+	return accessTokenClaims{
+		UserId:    userId,
+		TokenId:   tokenId,
+		SessionId: sessionId,
+		IssuedAt:  issuedAt.Time,
+		ExpiresAt: expiresAt.Time,
+	}, nil
+}
+
+// getVerificationKey picks the key to verify the token with, based on its "kid" header.
+// Tokens without one were signed with the shared secret, which is still accepted while it's configured.
+func (s *Server) getVerificationKey(token *jwt.Token) (interface{}, error) {
+	keyId, _ := token.Header["kid"].(string)
+	if keyId == "" {
+		if s.JWTSecretKey == "" || token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		return []byte(s.JWTSecretKey), nil
 	}
 
-	validClaims := tkn.Claims.(*jwt.MapClaims)
-	return (*validClaims)["id"].(string), nil
+	if s.SigningKeys == nil {
+		return nil, errors.New("unknown signing key")
+	}
+
+	key, ok := s.SigningKeys.VerificationKey(keyId)
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+
+	// Never let the token choose the algorithm, otherwise a public key could be used as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.PublicKey, nil
+}
+
+// issueRefreshToken generates a new opaque refresh token within the given family and stores its hash.
+// Only the hash is persisted, so a leaked database dump can't be used to refresh sessions.
+func (s *Server) issueRefreshToken(ctx context.Context, userId uuid.UUID, familyId uuid.UUID) (string, error) {
+	randomBytes := make([]byte, refreshTokenSize)
+	if _, err := RandRead(randomBytes); err != nil {
+		return "", err
+	}
+
+	refreshToken := base64.RawURLEncoding.EncodeToString(randomBytes)
+	insertRefreshTokenInput := repository.InsertRefreshTokenInput{
+		Id:        uuid.New(),
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.RefreshTokenTTL),
+	}
+
+	err := s.Repository.InsertRefreshToken(ctx, insertRefreshTokenInput)
+	if err != nil {
+		return "", err
+	}
+
+	return refreshToken, nil
+}
+
+func hashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
 }
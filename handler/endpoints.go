@@ -1,18 +1,58 @@
 package handler
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/dityuiri/UserServiceTest/common"
 	"github.com/dityuiri/UserServiceTest/generated"
+	"github.com/dityuiri/UserServiceTest/hasher"
 	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/revocation"
+	"github.com/dityuiri/UserServiceTest/totp"
 )
 
+// GetJwks : GET /.well-known/jwks.json
+func (s *Server) GetJwks(ctx echo.Context) error {
+	resp := generated.JWKSResponse{Keys: []generated.JSONWebKey{}}
+	if s.SigningKeys != nil {
+		resp = s.SigningKeys.JWKS()
+	}
+
+	// Allow verifiers to cache the keys, but not for longer than a rotation would take to propagate
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// GetPasswordPolicy : GET /password-policy
+func (s *Server) GetPasswordPolicy(ctx echo.Context) error {
+	policy := s.PasswordPolicy
+	resp := generated.PasswordPolicyResponse{
+		MinLength:             policy.MinLength,
+		MaxLength:             policy.MaxLength,
+		RequireUppercase:      policy.RequireUppercase,
+		RequireLowercase:      policy.RequireLowercase,
+		RequireDigit:          policy.RequireDigit,
+		RequireSymbol:         policy.RequireSymbol,
+		AllowUnicode:          policy.AllowUnicode,
+		MaxRepeatedCharacters: policy.MaxRepeatedCharacters,
+		MinEntropyBits:        policy.MinEntropyBits,
+		Description:           policy.Description(),
+	}
+
+	// The policy only changes with the configuration
+	ctx.Response().Header().Set("Cache-Control", "public, max-age=300")
+	return ctx.JSON(http.StatusOK, resp)
+}
+
 // UserRegister : POST /user/register
 func (s *Server) UserRegister(ctx echo.Context) error {
 	var (
@@ -24,6 +64,7 @@ func (s *Server) UserRegister(ctx echo.Context) error {
 
 	// Retrieve request body
 	if err := ctx.Bind(&req); err != nil {
+		s.countRegistration(registrationOutcomeInvalid)
 		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
 			Messages: []string{"Invalid request body"},
 		})
@@ -33,13 +74,18 @@ func (s *Server) UserRegister(ctx echo.Context) error {
 	err := ctx.Validate(req)
 	if err != nil {
 		if validationErrors, ok := err.(validator.ValidationErrors); ok {
-			errMessages := TranslateErrorMessages(validationErrors)
+			s.countRegistration(registrationOutcomeInvalid)
+			errMessages := TranslateErrorMessages(validationErrors, s.PasswordPolicy)
 			return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
 				Messages: errMessages,
 			})
 		}
 	}
 
+	if s.EnumerationSafe {
+		return s.enumerationSafeUserRegister(ctx, req)
+	}
+
 	// Validate if user already created
 	getUserInput := repository.GetUserByPhoneNumberInput{PhoneNumber: req.PhoneNumber}
 	_, err = s.Repository.GetUserByPhoneNumber(standardCtx, getUserInput)
@@ -54,8 +100,14 @@ func (s *Server) UserRegister(ctx echo.Context) error {
 		// Normal case is when user isn't exist in the database
 		if err == common.ErrUserNotFound {
 			// Hash and Salt the password
-			hashedPassword, err := GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+			hashedPassword, err := s.PasswordHasher.Hash(standardCtx, req.Password)
 			if err != nil {
+				if err == hasher.ErrBusy {
+					return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+						Messages: []string{err.Error()},
+					})
+				}
+
 				ctx.Logger().Errorf("hashPassword error: %s", err.Error())
 				return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
 					Messages: []string{err.Error()},
@@ -67,11 +119,17 @@ func (s *Server) UserRegister(ctx echo.Context) error {
 				Id:          uuid.New(),
 				PhoneNumber: req.PhoneNumber,
 				Name:        req.FullName,
-				Password:    string(hashedPassword),
+				Password:    hashedPassword,
 			}
 
 			err = s.Repository.InsertUser(standardCtx, insertUserInput)
 			if err != nil {
+				// Registered concurrently since the check above
+				var uniqueViolation *common.UniqueViolationError
+				if errors.As(err, &uniqueViolation) {
+					return s.rejectExistingUser(ctx)
+				}
+
 				ctx.Logger().Errorf("InsertUser error: %s", err.Error())
 				return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
 					Messages: []string{err.Error()},
@@ -79,22 +137,105 @@ func (s *Server) UserRegister(ctx echo.Context) error {
 			}
 
 			// Success response
+			s.countRegistration(registrationOutcomeCreated)
 			resp.Id = insertUserInput.Id.String()
 			return ctx.JSON(http.StatusCreated, resp)
 		}
 	}
 
 	// Return 422 if user already created
+	return s.rejectExistingUser(ctx)
+}
+
+func (s *Server) rejectExistingUser(ctx echo.Context) error {
+	s.countRegistration(registrationOutcomeDuplicate)
 	return ctx.JSON(http.StatusUnprocessableEntity, generated.MultipleErrorResponse{
 		Messages: []string{"User already exists"},
 	})
 }
 
+// enumerationSafeUserRegister registers the user without telling whether the phone number was already registered.
+// A new account has to verify its phone number, while the owner of an existing one is notified by SMS instead.
+func (s *Server) enumerationSafeUserRegister(ctx echo.Context, req generated.UserRegisterRequest) error {
+	var (
+		resp        = generated.SuccessMessageResponse{Message: registrationAcceptedMessage}
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Hash the password first, so both outcomes take as long
+	hashedPassword, err := s.PasswordHasher.Hash(standardCtx, req.Password)
+	if err != nil {
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("hashPassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	getUserInput := repository.GetUserByPhoneNumberInput{PhoneNumber: req.PhoneNumber}
+	_, err = s.Repository.GetUserByPhoneNumber(standardCtx, getUserInput)
+	if err == nil {
+		return s.acceptExistingUserRegistration(ctx, req.PhoneNumber)
+	}
+
+	if err != common.ErrUserNotFound {
+		ctx.Logger().Errorf("GetUserByPhoneNumber error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	insertUserInput := repository.InsertUserInput{
+		Id:          uuid.New(),
+		PhoneNumber: req.PhoneNumber,
+		Name:        req.FullName,
+		Password:    hashedPassword,
+	}
+
+	err = s.Repository.InsertUser(standardCtx, insertUserInput)
+	if err != nil {
+		// Registered concurrently since the check above
+		var uniqueViolation *common.UniqueViolationError
+		if errors.As(err, &uniqueViolation) {
+			return s.acceptExistingUserRegistration(ctx, req.PhoneNumber)
+		}
+
+		ctx.Logger().Errorf("InsertUser error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	// The new user proves owning the phone number with the code, confirmed once logged in
+	if err = s.sendPhoneVerificationCode(standardCtx, insertUserInput.Id, req.PhoneNumber); err != nil {
+		ctx.Logger().Errorf("sendPhoneVerificationCode error: %s", err.Error())
+	}
+
+	s.countRegistration(registrationOutcomeCreated)
+	return ctx.JSON(http.StatusAccepted, resp)
+}
+
+// acceptExistingUserRegistration notifies the owner of the phone number instead of registering it again
+func (s *Server) acceptExistingUserRegistration(ctx echo.Context, phoneNumber string) error {
+	s.countRegistration(registrationOutcomeDuplicate)
+
+	// Delivery failures are only logged, a distinct response would confirm the phone number is registered
+	if err := s.notifyRegistrationAttempt(ctx.Request().Context(), phoneNumber); err != nil {
+		ctx.Logger().Errorf("notifyRegistrationAttempt error: %s", err.Error())
+	}
+
+	return ctx.JSON(http.StatusAccepted, generated.SuccessMessageResponse{Message: registrationAcceptedMessage})
+}
+
 // UserLogin : POST /user/login
 func (s *Server) UserLogin(ctx echo.Context) error {
 	var (
-		req  generated.UserLoginRequest
-		resp generated.UserLoginResponse
+		req generated.UserLoginRequest
 
 		standardCtx = ctx.Request().Context()
 	)
@@ -119,6 +260,11 @@ func (s *Server) UserLogin(ctx echo.Context) error {
 	user, err := s.Repository.GetUserByPhoneNumber(standardCtx, getUserInput)
 	if err != nil {
 		if err == common.ErrUserNotFound {
+			s.countLogin(loginOutcomeFailure, loginReasonUnknownUser)
+			if s.EnumerationSafe {
+				return s.rejectUnknownUserLogin(ctx, req.Password)
+			}
+
 			// Case when user not found
 			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
 				Message: err.Error(),
@@ -131,70 +277,171 @@ func (s *Server) UserLogin(ctx echo.Context) error {
 		})
 	}
 
+	// Refuse without checking the password while the account is locked or delayed by previous failures
+	now := time.Now()
+	if lockedUntil := s.loginLockedUntil(user.NumOfFailedLogin, user.LastFailedLoginAt, now); !lockedUntil.IsZero() {
+		s.recordLoginEvent(ctx, user.Id, false, loginReasonLocked)
+
+		if s.EnumerationSafe {
+			// The lockout is still enforced, just not told apart from a wrong password
+			return s.rejectUnknownUserLogin(ctx, req.Password)
+		}
+
+		return s.rejectLockedLogin(ctx, user.NumOfFailedLogin.Int32, lockedUntil.Sub(now))
+	}
+
 	// Compare supplied password with the user password
-	err = CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
+	err = s.PasswordHasher.Compare(standardCtx, user.Password, req.Password)
 	if err != nil {
-		if err == bcrypt.ErrMismatchedHashAndPassword {
+		if err == hasher.ErrMismatchedHashAndPassword {
+			// Failed attempts are counted in the database, so the lockout holds across instances
+			recordFailedLoginInput := repository.RecordFailedLoginInput{
+				UserId:      user.Id,
+				FailedAt:    now,
+				WindowStart: now.Add(-s.LoginLockoutWindow),
+			}
+
+			failedLogin, err := s.Repository.RecordFailedLogin(standardCtx, recordFailedLoginInput)
+			if err != nil {
+				ctx.Logger().Errorf("RecordFailedLogin error: %s", err.Error())
+				return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+					Message: err.Error(),
+				})
+			}
+
+			s.recordLoginEvent(ctx, user.Id, false, loginReasonWrongPassword)
+
+			if s.EnumerationSafe {
+				return s.rejectInvalidCredentials(ctx)
+			}
+
+			if s.isLoginLockedOut(failedLogin.NumOfFailedLogin) {
+				return s.rejectLockedLogin(ctx, failedLogin.NumOfFailedLogin, s.loginRetryDelay(failedLogin.NumOfFailedLogin))
+			}
+
 			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
 				Message: "Mismatched password",
 			})
 		}
 
-		ctx.Logger().Errorf("CompareHashAndPassword error: %s", err.Error())
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("comparePassword error: %s", err.Error())
 		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	// Generate JWT token
-	token, err := s.generateJWTToken(user.Id.String())
-	if err != nil {
-		ctx.Logger().Errorf("generateJWTToken error: %s", err.Error())
-		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
-			Message: err.Error(),
-		})
+	// Logging in with the password just registered would otherwise tell the phone number was free
+	if s.EnumerationSafe && !user.PhoneVerifiedAt.Valid {
+		verified, err := s.verifyPhoneOnLogin(ctx, user.Id, req.PhoneNumber, req.VerificationCode)
+		if err != nil {
+			ctx.Logger().Errorf("verifyPhoneOnLogin error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		if !verified {
+			s.recordLoginEvent(ctx, user.Id, false, loginReasonPhoneUnverified)
+			return s.rejectInvalidCredentials(ctx)
+		}
 	}
 
-	// Increment successful login
-	updateUserLoginInput := repository.UpsertUserLoginInput{
-		UserId:               user.Id,
-		NumOfSuccessfulLogin: user.NumOfSuccessfulLogin.Int32 + 1,
+	// Upgrade hashes made with another algorithm or weaker parameters, now that the password is known
+	if s.PasswordHasher.NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user.Id, user.Password, req.Password)
 	}
 
-	err = s.Repository.UpsertUserLogin(standardCtx, updateUserLoginInput)
-	if err != nil {
-		ctx.Logger().Errorf("UpdateUserLogin error: %s", err.Error())
+	// Users with two-factor authentication enabled have to complete the challenge first
+	getUserMFAInput := repository.GetUserMFAInput{UserId: user.Id}
+	userMFA, err := s.Repository.GetUserMFA(standardCtx, getUserMFAInput)
+	if err != nil && err != common.ErrMFANotFound {
+		ctx.Logger().Errorf("GetUserMFA error: %s", err.Error())
 		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	resp.Id = user.Id.String()
-	resp.Token = token
-	return ctx.JSON(http.StatusOK, resp)
+	if err == nil && userMFA.ConfirmedAt.Valid {
+		mfaToken, err := s.generateMFAChallengeToken(user.Id.String())
+		if err != nil {
+			ctx.Logger().Errorf("generateMFAChallengeToken error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		s.countLogin(loginOutcomeMFAChallenge, loginReasonPassword)
+		return ctx.JSON(http.StatusAccepted, generated.UserLoginMFAChallengeResponse{
+			MfaToken:  mfaToken,
+			ExpiresIn: int(mfaChallengeTTL.Seconds()),
+		})
+	}
+
+	return s.completeUserLogin(ctx, user.Id, loginReasonPassword)
 }
 
-// GetUserProfile : GET /user/profile
-func (s *Server) GetUserProfile(ctx echo.Context) error {
+// UserLoginMfa : POST /user/login/mfa
+func (s *Server) UserLoginMfa(ctx echo.Context) error {
 	var (
-		resp        generated.GetUserProfileResponse
+		req         generated.UserLoginMFARequest
 		standardCtx = ctx.Request().Context()
 	)
 
-	// Retrieve and Get ID from JWT Token
-	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	// Retrieve request body
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Required field validation
+	err := ctx.Validate(req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "MfaToken and Code are mandatory",
+		})
+	}
+
+	// Verify the challenge token issued on login
+	claims, err := s.parseJWTToken(req.MfaToken, mfaChallengeTokenType)
 	if err != nil {
+		s.countTokenValidationFailure(mfaChallengeTokenType, tokenValidationFailureCause(err))
 		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	// Get user profile
-	getUserInput := repository.GetUserByIdInput{Id: userId}
-	user, err := s.Repository.GetUserById(standardCtx, getUserInput)
+	isRevokedInput := revocation.IsRevokedInput{
+		TokenId:  claims.TokenId,
+		UserId:   claims.UserId,
+		IssuedAt: claims.IssuedAt,
+	}
+
+	revoked, err := s.RevocationStore.IsRevoked(standardCtx, isRevokedInput)
+	if err != nil {
+		ctx.Logger().Errorf("IsRevoked error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	if revoked {
+		s.countTokenValidationFailure(mfaChallengeTokenType, tokenFailureRevoked)
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: "token has been revoked",
+		})
+	}
+
+	// Make sure the user still exists
+	user, err := s.Repository.GetUserById(standardCtx, repository.GetUserByIdInput{Id: claims.UserId})
 	if err != nil {
 		if err == common.ErrUserNotFound {
-			// Follow the specification to return it as 403
 			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
 				Message: err.Error(),
 			})
@@ -206,116 +453,1541 @@ func (s *Server) GetUserProfile(ctx echo.Context) error {
 		})
 	}
 
-	resp.Name = user.Name
-	resp.PhoneNumber = user.PhoneNumber
-	return ctx.JSON(http.StatusOK, resp)
-}
-
-// UpdateUserProfile : PATCH /user/profile
-func (s *Server) UpdateUserProfile(ctx echo.Context) error {
-	var (
-		req         generated.UpdateUserProfileRequest
-		resp        generated.SuccessMessageResponse
-		standardCtx = ctx.Request().Context()
-	)
+	// The codes are subject to the same lockout as the password
+	now := time.Now()
+	if lockedUntil := s.loginLockedUntil(user.NumOfFailedLogin, user.LastFailedLoginAt, now); !lockedUntil.IsZero() {
+		s.recordLoginEvent(ctx, user.Id, false, loginReasonLocked)
+		return s.rejectLockedLogin(ctx, user.NumOfFailedLogin.Int32, lockedUntil.Sub(now))
+	}
 
-	// Retrieve and Get ID from JWT Token
-	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	userMFA, err := s.Repository.GetUserMFA(standardCtx, repository.GetUserMFAInput{UserId: user.Id})
 	if err != nil {
-		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+		if err == common.ErrMFANotFound {
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	// Retrieve request body
-	if err = ctx.Bind(&req); err != nil {
-		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
-			Message: "Invalid request body",
+	valid, err := s.verifyMFACode(standardCtx, userMFA, req.Code)
+	if err != nil {
+		ctx.Logger().Errorf("verifyMFACode error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
 		})
 	}
 
-	// Check if both of the fields are empty
-	if req.PhoneNumber == nil && req.FullName == nil {
-		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
-			Message: "Empty request body",
-		})
+	if !valid {
+		return s.rejectInvalidMFACode(ctx, user.Id, claims, now)
 	}
 
-	// Get user by id to get current profile of the user
-	getUserInput := repository.GetUserByIdInput{Id: userId}
-	user, err := s.Repository.GetUserById(standardCtx, getUserInput)
-	if err != nil {
-		if err == common.ErrUserNotFound {
-			// Follow the specification to return it as 403
-			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
-				Message: err.Error(),
-			})
-		}
+	// The challenge can only be completed once
+	revokeTokenInput := revocation.RevokeTokenInput{
+		TokenId:   claims.TokenId,
+		ExpiresAt: claims.ExpiresAt,
+	}
 
-		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+	err = s.RevocationStore.RevokeToken(standardCtx, revokeTokenInput)
+	if err != nil {
+		ctx.Logger().Errorf("RevokeToken error: %s", err.Error())
 		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	// Pre-fill input for update user with existing profile
-	updateUserInput := repository.UpdateUserInput{
-		Id:          userId,
-		PhoneNumber: user.PhoneNumber,
-		Name:        user.Name,
-	}
+	return s.completeUserLogin(ctx, user.Id, loginReasonMFA)
+}
 
-	// Check if any changes happen to the current one
-	var isPhoneChanged, isNameChanged bool
-	if req.PhoneNumber != nil {
-		if user.PhoneNumber != *req.PhoneNumber {
-			isPhoneChanged = true
-		}
+// rejectInvalidMFACode counts the invalid code as a failed login, like a wrong password.
+// Past a few failures the challenge is revoked, so the codes can't be guessed for as long as it's valid.
+func (s *Server) rejectInvalidMFACode(ctx echo.Context, userId uuid.UUID, claims accessTokenClaims, now time.Time) error {
+	standardCtx := ctx.Request().Context()
 
-		updateUserInput.PhoneNumber = *req.PhoneNumber
+	recordFailedLoginInput := repository.RecordFailedLoginInput{
+		UserId:      userId,
+		FailedAt:    now,
+		WindowStart: now.Add(-s.LoginLockoutWindow),
 	}
 
-	if req.FullName != nil {
-		if user.Name != *req.FullName {
-			isNameChanged = true
-			updateUserInput.Name = *req.FullName
-		}
+	failedLogin, err := s.Repository.RecordFailedLogin(standardCtx, recordFailedLoginInput)
+	if err != nil {
+		ctx.Logger().Errorf("RecordFailedLogin error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
 	}
 
-	// Return no content if no changes happened
-	if !isPhoneChanged && !isNameChanged {
-		return ctx.JSON(http.StatusNoContent, nil)
-	}
+	s.recordLoginEvent(ctx, userId, false, loginReasonInvalidMFACode)
 
-	// If phone number changed, check for existing user
-	if isPhoneChanged {
-		getUserByPhoneInput := repository.GetUserByPhoneNumberInput{PhoneNumber: *req.PhoneNumber}
-		existingUser, err := s.Repository.GetUserByPhoneNumber(standardCtx, getUserByPhoneInput)
-		// Return for other errors
-		if err != nil && err != common.ErrUserNotFound {
-			ctx.Logger().Errorf("GetUserByPhoneNumber error: %s", err.Error())
-			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
-				Message: err.Error(),
-			})
-		}
+	lockedOut := s.isLoginLockedOut(failedLogin.NumOfFailedLogin)
+	if !lockedOut && failedLogin.NumOfFailedLogin < mfaChallengeMaxFailures {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "invalid code",
+		})
+	}
 
-		// Return conflict status code
-		if err == nil && existingUser.Name != "" {
-			return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
-				Message: "phone number exists",
-			})
-		}
+	revokeTokenInput := revocation.RevokeTokenInput{
+		TokenId:   claims.TokenId,
+		ExpiresAt: claims.ExpiresAt,
 	}
 
-	// Continue the update process
-	err = s.Repository.UpdateUser(standardCtx, updateUserInput)
+	err = s.RevocationStore.RevokeToken(standardCtx, revokeTokenInput)
 	if err != nil {
-		ctx.Logger().Errorf("UpdateUser error: %s", err.Error())
+		ctx.Logger().Errorf("RevokeToken error: %s", err.Error())
 		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
 			Message: err.Error(),
 		})
 	}
 
-	resp.Message = "changes applied successfully"
+	if lockedOut {
+		return s.rejectLockedLogin(ctx, failedLogin.NumOfFailedLogin, s.loginRetryDelay(failedLogin.NumOfFailedLogin))
+	}
+
+	return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+		Message: tooManyInvalidCodesMessage,
+	})
+}
+
+// rejectInvalidCredentials responds to every failed login the same way, in enumeration-safe mode
+func (s *Server) rejectInvalidCredentials(ctx echo.Context) error {
+	return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+		Message: invalidCredentialsMessage,
+	})
+}
+
+// rejectUnknownUserLogin responds like rejectInvalidCredentials, after spending as long as a password check
+func (s *Server) rejectUnknownUserLogin(ctx echo.Context, password string) error {
+	err := s.compareDummyPassword(ctx.Request().Context(), password)
+	if err == hasher.ErrBusy {
+		return rejectBusyHashing(ctx, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	if err != nil {
+		ctx.Logger().Errorf("compareDummyPassword error: %s", err.Error())
+	}
+
+	return s.rejectInvalidCredentials(ctx)
+}
+
+// rejectBusyHashing responds when too many passwords are being hashed already, for the client to retry shortly
+func rejectBusyHashing(ctx echo.Context, resp interface{}) error {
+	setRetryAfter(ctx, busyHashingRetryAfter)
+	return ctx.JSON(http.StatusServiceUnavailable, resp)
+}
+
+// rejectLockedLogin responds to a login attempt made before the account may try again,
+// with 423 once the account is locked out and 429 while the attempts are only being slowed down
+func (s *Server) rejectLockedLogin(ctx echo.Context, numOfFailedLogin int32, wait time.Duration) error {
+	setRetryAfter(ctx, wait)
+
+	if s.isLoginLockedOut(numOfFailedLogin) {
+		return ctx.JSON(http.StatusLocked, generated.ErrorResponse{
+			Message: accountLockedMessage,
+		})
+	}
+
+	return ctx.JSON(http.StatusTooManyRequests, generated.ErrorResponse{
+		Message: tooManyLoginAttemptsMessage,
+	})
+}
+
+// rehashPassword replaces the hash of the password the user just logged in with, made with the configured hasher.
+// Failures are only logged, the old hash still works.
+func (s *Server) rehashPassword(ctx echo.Context, userId uuid.UUID, currentHash string, password string) {
+	hashedPassword, err := s.PasswordHasher.Hash(ctx.Request().Context(), password)
+	if err != nil {
+		ctx.Logger().Errorf("hashPassword error: %s", err.Error())
+		return
+	}
+
+	rehashUserPasswordInput := repository.RehashUserPasswordInput{
+		Id:              userId,
+		CurrentPassword: currentHash,
+		Password:        hashedPassword,
+	}
+
+	err = s.Repository.RehashUserPassword(ctx.Request().Context(), rehashUserPasswordInput)
+	if err != nil {
+		ctx.Logger().Errorf("RehashUserPassword error: %s", err.Error())
+	}
+}
+
+// completeUserLogin starts a new session for the authenticated user and responds with its tokens.
+// The reason tells how the user authenticated, for the login history.
+func (s *Server) completeUserLogin(ctx echo.Context, userId uuid.UUID, reason string) error {
+	var (
+		resp        generated.UserLoginResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Every login starts a new session, identified by its refresh token family
+	sessionId := uuid.New()
+
+	// Generate JWT token
+	token, err := s.generateJWTToken(userId.String(), sessionId.String())
+	if err != nil {
+		ctx.Logger().Errorf("generateJWTToken error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Increment successful login
+	updateUserLoginInput := repository.UpsertUserLoginInput{
+		UserId: userId,
+	}
+
+	_, err = s.Repository.UpsertUserLogin(standardCtx, updateUserLoginInput)
+	if err != nil {
+		ctx.Logger().Errorf("UpdateUserLogin error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Record the session so the user can see and revoke it from the other devices
+	insertSessionInput := repository.InsertUserSessionInput{
+		Id:        sessionId,
+		UserId:    userId,
+		UserAgent: ctx.Request().UserAgent(),
+		IpAddress: ctx.RealIP(),
+	}
+
+	err = s.Repository.InsertUserSession(standardCtx, insertSessionInput)
+	if err != nil {
+		ctx.Logger().Errorf("InsertUserSession error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Issue refresh token for the new session
+	refreshToken, err := s.issueRefreshToken(standardCtx, userId, sessionId)
+	if err != nil {
+		ctx.Logger().Errorf("issueRefreshToken error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	s.recordLoginEvent(ctx, userId, true, reason)
+
+	resp.Id = userId.String()
+	resp.Token = token
+	resp.RefreshToken = refreshToken
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UserTokenRefresh : POST /user/token/refresh
+func (s *Server) UserTokenRefresh(ctx echo.Context) error {
+	var (
+		req         generated.UserTokenRefreshRequest
+		resp        generated.UserTokenRefreshResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve request body
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Required field validation
+	err := ctx.Validate(req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "RefreshToken is mandatory",
+		})
+	}
+
+	// Look up the stored refresh token by its hash
+	getRefreshTokenInput := repository.GetRefreshTokenByHashInput{TokenHash: hashRefreshToken(req.RefreshToken)}
+	refreshToken, err := s.Repository.GetRefreshTokenByHash(standardCtx, getRefreshTokenInput)
+	if err != nil {
+		if err == common.ErrRefreshTokenNotFound {
+			s.countTokenValidationFailure(refreshTokenType, tokenFailureUnknown)
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: "invalid refresh token",
+			})
+		}
+
+		ctx.Logger().Errorf("GetRefreshTokenByHash error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	if refreshToken.RevokedAt.Valid {
+		s.countTokenValidationFailure(refreshTokenType, tokenFailureRevoked)
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: "refresh token has been revoked",
+		})
+	}
+
+	// A refresh token that has been used before means it most likely leaked,
+	// so revoke the whole family to log out both the attacker and the legitimate user
+	if refreshToken.UsedAt.Valid {
+		return s.revokeReusedRefreshTokenFamily(ctx, refreshToken.FamilyId)
+	}
+
+	if time.Now().After(refreshToken.ExpiresAt) {
+		s.countTokenValidationFailure(refreshTokenType, tokenFailureExpired)
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: "refresh token has expired",
+		})
+	}
+
+	// Consume the refresh token, losing this race also counts as a reuse
+	err = s.Repository.MarkRefreshTokenUsed(standardCtx, repository.MarkRefreshTokenUsedInput{Id: refreshToken.Id})
+	if err != nil {
+		if err == common.ErrRefreshTokenAlreadyUsed {
+			return s.revokeReusedRefreshTokenFamily(ctx, refreshToken.FamilyId)
+		}
+
+		ctx.Logger().Errorf("MarkRefreshTokenUsed error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Refreshing is how a session is used from the outside, keep track of when and where it last happened.
+	// Failures are only logged, the session works all the same.
+	touchSessionInput := repository.TouchUserSessionInput{Id: refreshToken.FamilyId, IpAddress: ctx.RealIP()}
+	if err = s.Repository.TouchUserSession(standardCtx, touchSessionInput); err != nil {
+		ctx.Logger().Errorf("TouchUserSession error: %s", err.Error())
+	}
+
+	// Generate JWT token
+	token, err := s.generateJWTToken(refreshToken.UserId.String(), refreshToken.FamilyId.String())
+	if err != nil {
+		ctx.Logger().Errorf("generateJWTToken error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Rotate the refresh token within the same family
+	newRefreshToken, err := s.issueRefreshToken(standardCtx, refreshToken.UserId, refreshToken.FamilyId)
+	if err != nil {
+		ctx.Logger().Errorf("issueRefreshToken error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Token = token
+	resp.RefreshToken = newRefreshToken
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+func (s *Server) revokeReusedRefreshTokenFamily(ctx echo.Context, familyId uuid.UUID) error {
+	s.countTokenValidationFailure(refreshTokenType, tokenFailureReused)
+
+	revokeInput := repository.RevokeRefreshTokenFamilyInput{FamilyId: familyId}
+	err := s.Repository.RevokeRefreshTokenFamily(ctx.Request().Context(), revokeInput)
+	if err != nil {
+		ctx.Logger().Errorf("RevokeRefreshTokenFamily error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+		Message: "refresh token reuse detected",
+	})
+}
+
+// UserPasswordResetRequest : POST /user/password/reset/request
+func (s *Server) UserPasswordResetRequest(ctx echo.Context) error {
+	var (
+		req         generated.UserPasswordResetRequest
+		resp        = generated.SuccessMessageResponse{Message: passwordResetRequestedMessage}
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve request body
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Required field validation
+	err := ctx.Validate(req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "PhoneNumber is mandatory",
+		})
+	}
+
+	getUserInput := repository.GetUserByPhoneNumberInput{PhoneNumber: req.PhoneNumber}
+	user, err := s.Repository.GetUserByPhoneNumber(standardCtx, getUserInput)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			return ctx.JSON(http.StatusAccepted, resp)
+		}
+
+		ctx.Logger().Errorf("GetUserByPhoneNumber error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// The code is stored and sent after responding, so the response is as fast as for an unknown phone number.
+	// Failures are only logged, a distinct response would confirm the phone number is registered.
+	logger := ctx.Logger()
+	s.runInBackground(func(backgroundCtx context.Context) {
+		err := s.sendPasswordResetCode(backgroundCtx, user.Id, req.PhoneNumber)
+		if err != nil && err != common.ErrPasswordResetCooldown {
+			logger.Errorf("sendPasswordResetCode error: %s", err.Error())
+		}
+	})
+
+	return ctx.JSON(http.StatusAccepted, resp)
+}
+
+// UserPasswordResetConfirm : POST /user/password/reset/confirm
+func (s *Server) UserPasswordResetConfirm(ctx echo.Context) error {
+	var (
+		req         generated.UserPasswordResetConfirmRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+
+		invalidCodeResponse = generated.MultipleErrorResponse{
+			Messages: []string{invalidPasswordResetCodeMessage},
+		}
+	)
+
+	// Retrieve request body
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: []string{"Invalid request body"},
+		})
+	}
+
+	// Field validation
+	err := ctx.Validate(req)
+	if err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errMessages := TranslateErrorMessages(validationErrors, s.PasswordPolicy)
+			return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+				Messages: errMessages,
+			})
+		}
+	}
+
+	getUserInput := repository.GetUserByPhoneNumberInput{PhoneNumber: req.PhoneNumber}
+	user, err := s.Repository.GetUserByPhoneNumber(standardCtx, getUserInput)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+		}
+
+		ctx.Logger().Errorf("GetUserByPhoneNumber error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	// Get the pending password reset
+	passwordReset, err := s.Repository.GetPasswordReset(standardCtx, repository.GetPasswordResetInput{UserId: user.Id})
+	if err != nil {
+		if err == common.ErrPasswordResetNotFound {
+			return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+		}
+
+		ctx.Logger().Errorf("GetPasswordReset error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	if time.Now().After(passwordReset.ExpiresAt) {
+		return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+	}
+
+	// Count the attempt before comparing, so guessing stops at the limit
+	incrementAttemptsInput := repository.IncrementPasswordResetAttemptsInput{
+		UserId:      user.Id,
+		MaxAttempts: passwordResetMaxAttempts,
+	}
+
+	err = s.Repository.IncrementPasswordResetAttempts(standardCtx, incrementAttemptsInput)
+	if err != nil {
+		if err == common.ErrPasswordResetAttemptsExceeded {
+			return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+		}
+
+		ctx.Logger().Errorf("IncrementPasswordResetAttempts error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	codeHash := hashVerificationCode(s.CodeHashKey, user.Id, req.PhoneNumber, req.Code)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(passwordReset.CodeHash)) != 1 {
+		return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+	}
+
+	// The request doesn't carry the user's name, check the new password against it now
+	err = ctx.Validate(passwordOfUser{Password: req.Password, FullName: user.Name, PhoneNumber: req.PhoneNumber})
+	if validationErrors, ok := err.(validator.ValidationErrors); ok {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: TranslateErrorMessages(validationErrors, s.PasswordPolicy),
+		})
+	}
+
+	// Forgetting the password is no reason to reuse an old one
+	reused, err := s.isPasswordReused(standardCtx, user.Id, user.Password, req.Password)
+	if err != nil {
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("isPasswordReused error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	if reused {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: []string{passwordReusedMessage},
+		})
+	}
+
+	// Hash and Salt the new password
+	hashedPassword, err := s.PasswordHasher.Hash(standardCtx, req.Password)
+	if err != nil {
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("hashPassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	// Consume the code, set the password and revoke the refresh tokens at once
+	resetPasswordInput := repository.ResetUserPasswordInput{
+		UserId:   user.Id,
+		CodeHash: codeHash,
+		Password: hashedPassword,
+	}
+
+	err = s.Repository.ResetUserPassword(standardCtx, resetPasswordInput)
+	if err != nil {
+		if err == common.ErrPasswordResetNotFound {
+			return ctx.JSON(http.StatusBadRequest, invalidCodeResponse)
+		}
+
+		ctx.Logger().Errorf("ResetUserPassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	// Revoke every access token issued so far, they all expire within one access token TTL
+	err = s.revokeUserTokens(standardCtx, user.Id.String(), time.Now())
+	if err != nil {
+		ctx.Logger().Errorf("RevokeUserTokens error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	resp.Message = "password reset successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UserLogout : POST /user/logout
+func (s *Server) UserLogout(ctx echo.Context) error {
+	var (
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get claims from JWT Token
+	claims, err := s.retrieveAndGetClaimsFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Revoke the access token until it expires by itself
+	revokeTokenInput := revocation.RevokeTokenInput{
+		TokenId:   claims.TokenId,
+		ExpiresAt: claims.ExpiresAt,
+	}
+
+	err = s.RevocationStore.RevokeToken(standardCtx, revokeTokenInput)
+	if err != nil {
+		ctx.Logger().Errorf("RevokeToken error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Revoke the session, so neither the other access tokens issued within it nor its refresh tokens can be used
+	if sessionId, err := uuid.Parse(claims.SessionId); err == nil {
+		err = s.revokeSessionAccessTokens(standardCtx, sessionId)
+		if err != nil {
+			ctx.Logger().Errorf("RevokeSession error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		revokeFamilyInput := repository.RevokeRefreshTokenFamilyInput{FamilyId: sessionId}
+		err = s.Repository.RevokeRefreshTokenFamily(standardCtx, revokeFamilyInput)
+		if err != nil {
+			ctx.Logger().Errorf("RevokeRefreshTokenFamily error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+	}
+
+	resp.Message = "logged out successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UserLogoutAll : POST /user/logout-all
+func (s *Server) UserLogoutAll(ctx echo.Context) error {
+	var (
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get claims from JWT Token
+	claims, err := s.retrieveAndGetClaimsFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Revoke every access token issued so far, they all expire within one access token TTL
+	err = s.revokeUserTokens(standardCtx, claims.UserId, time.Now())
+	if err != nil {
+		ctx.Logger().Errorf("RevokeUserTokens error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Revoke the refresh tokens of every session
+	err = s.Repository.RevokeUserRefreshTokens(standardCtx, repository.RevokeUserRefreshTokensInput{UserId: userId})
+	if err != nil {
+		ctx.Logger().Errorf("RevokeUserRefreshTokens error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Message = "logged out from all sessions successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// GetUserSessions : GET /user/sessions
+func (s *Server) GetUserSessions(ctx echo.Context) error {
+	var (
+		resp        generated.GetUserSessionsResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get claims from JWT Token
+	claims, err := s.retrieveAndGetClaimsFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	userId, err := uuid.Parse(claims.UserId)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Sessions that haven't been refreshed within the refresh token TTL can't be resumed anymore
+	listSessionsInput := repository.ListUserSessionsInput{
+		UserId:        userId,
+		LastSeenAfter: time.Now().Add(-s.RefreshTokenTTL),
+	}
+
+	sessions, err := s.Repository.ListUserSessions(standardCtx, listSessionsInput)
+	if err != nil {
+		ctx.Logger().Errorf("ListUserSessions error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Sessions = make([]generated.UserSession, 0, len(sessions.Sessions))
+	for _, session := range sessions.Sessions {
+		resp.Sessions = append(resp.Sessions, generated.UserSession{
+			Id:         session.Id.String(),
+			UserAgent:  session.UserAgent,
+			IpAddress:  session.IpAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			Current:    session.Id.String() == claims.SessionId,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// DeleteUserSession : DELETE /user/sessions/{id}
+func (s *Server) DeleteUserSession(ctx echo.Context, id uuid.UUID) error {
+	standardCtx := ctx.Request().Context()
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	parsedUserId, err := uuid.Parse(userId)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Revoke the session along with its refresh tokens, as long as it belongs to the user
+	revokeSessionInput := repository.RevokeUserSessionInput{Id: id, UserId: parsedUserId}
+	err = s.Repository.RevokeUserSession(standardCtx, revokeSessionInput)
+	if err != nil {
+		if err == common.ErrSessionNotFound {
+			return ctx.JSON(http.StatusNotFound, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("RevokeUserSession error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// And the access tokens issued within it, which would otherwise keep working until they expire
+	err = s.revokeSessionAccessTokens(standardCtx, id)
+	if err != nil {
+		ctx.Logger().Errorf("RevokeSession error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// UserMfaTotpEnroll : POST /user/mfa/totp/enroll
+func (s *Server) UserMfaTotpEnroll(ctx echo.Context) error {
+	var (
+		resp        generated.UserMFATotpEnrollResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Get user profile, the phone number names the account in the authenticator app
+	user, err := s.Repository.GetUserById(standardCtx, repository.GetUserByIdInput{Id: userId})
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			// Follow the specification to return it as 403
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	secret, encryptedSecret, err := s.generateMFASecret(user.Id)
+	if err != nil {
+		ctx.Logger().Errorf("generateMFASecret error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	recoveryCodes, recoveryCodeHashes, err := generateRecoveryCodes()
+	if err != nil {
+		ctx.Logger().Errorf("generateRecoveryCodes error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Store the pending enrollment, replacing any previous one that was never confirmed
+	upsertUserMFAInput := repository.UpsertUserMFAInput{
+		UserId:             user.Id,
+		EncryptedSecret:    encryptedSecret,
+		RecoveryCodeHashes: recoveryCodeHashes,
+	}
+
+	err = s.Repository.UpsertUserMFA(standardCtx, upsertUserMFAInput)
+	if err != nil {
+		if err == common.ErrMFAAlreadyEnabled {
+			return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("UpsertUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Secret = totp.EncodeSecret(secret)
+	resp.ProvisioningUri = totp.ProvisioningURI(s.MFAIssuer, user.PhoneNumber, secret)
+	resp.RecoveryCodes = recoveryCodes
+	return ctx.JSON(http.StatusCreated, resp)
+}
+
+// UserMfaTotpConfirm : POST /user/mfa/totp/confirm
+func (s *Server) UserMfaTotpConfirm(ctx echo.Context) error {
+	var (
+		req         generated.UserMFATotpCodeRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	id, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Retrieve request body
+	if err = ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Required field validation
+	err = ctx.Validate(req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Code is mandatory",
+		})
+	}
+
+	// Get the enrollment of the user
+	getUserMFAInput := repository.GetUserMFAInput{UserId: userId}
+	userMFA, err := s.Repository.GetUserMFA(standardCtx, getUserMFAInput)
+	if err != nil {
+		if err == common.ErrMFANotFound {
+			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	if userMFA.ConfirmedAt.Valid {
+		return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+			Message: common.ErrMFAAlreadyEnabled.Error(),
+		})
+	}
+
+	// Only a TOTP code proves the authenticator app was set up, recovery codes aren't accepted here
+	secret, err := s.decryptMFASecret(userMFA.UserId, userMFA.EncryptedSecret)
+	if err != nil {
+		ctx.Logger().Errorf("decryptMFASecret error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "invalid code",
+		})
+	}
+
+	err = s.Repository.ConfirmUserMFA(standardCtx, repository.ConfirmUserMFAInput{UserId: userMFA.UserId, Step: step})
+	if err != nil {
+		if err == common.ErrMFAAlreadyEnabled {
+			return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("ConfirmUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Message = "two-factor authentication enabled successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UserMfaTotpDisable : DELETE /user/mfa/totp
+func (s *Server) UserMfaTotpDisable(ctx echo.Context) error {
+	var (
+		req         generated.UserMFATotpCodeRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	id, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Retrieve request body
+	if err = ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Get the enrollment of the user
+	getUserMFAInput := repository.GetUserMFAInput{UserId: userId}
+	userMFA, err := s.Repository.GetUserMFA(standardCtx, getUserMFAInput)
+	if err != nil {
+		if err == common.ErrMFANotFound {
+			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// A stolen access token alone isn't enough to turn off the second factor
+	if userMFA.ConfirmedAt.Valid {
+		valid, err := s.verifyMFACode(standardCtx, userMFA, req.Code)
+		if err != nil {
+			ctx.Logger().Errorf("verifyMFACode error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		if !valid {
+			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+				Message: "invalid code",
+			})
+		}
+	}
+
+	err = s.Repository.DeleteUserMFA(standardCtx, repository.DeleteUserMFAInput{UserId: userMFA.UserId})
+	if err != nil {
+		ctx.Logger().Errorf("DeleteUserMFA error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Message = "two-factor authentication disabled successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UserPhoneVerifyRequest : POST /user/phone/verify/request
+func (s *Server) UserPhoneVerifyRequest(ctx echo.Context) error {
+	var (
+		resp        generated.UserPhoneVerifyRequestResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Get user profile for the phone number to verify
+	user, err := s.Repository.GetUserById(standardCtx, repository.GetUserByIdInput{Id: userId})
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			// Follow the specification to return it as 403
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	if user.PhoneVerifiedAt.Valid {
+		return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+			Message: "phone number is already verified",
+		})
+	}
+
+	err = s.sendPhoneVerificationCode(standardCtx, user.Id, user.PhoneNumber)
+	if err != nil {
+		if err == common.ErrPhoneVerificationCooldown {
+			return s.rejectPhoneVerificationResend(ctx, user.Id, err)
+		}
+
+		ctx.Logger().Errorf("sendPhoneVerificationCode error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.ExpiresIn = int(phoneVerificationCodeTTL.Seconds())
+	resp.ResendIn = int(phoneVerificationResendCooldown.Seconds())
+	return ctx.JSON(http.StatusAccepted, resp)
+}
+
+// rejectPhoneVerificationResend responds with how long the user has to wait for a new code
+func (s *Server) rejectPhoneVerificationResend(ctx echo.Context, userId uuid.UUID, cause error) error {
+	getVerificationInput := repository.GetPhoneVerificationInput{UserId: userId}
+	verification, err := s.Repository.GetPhoneVerification(ctx.Request().Context(), getVerificationInput)
+	if err != nil {
+		ctx.Logger().Errorf("GetPhoneVerification error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	setRetryAfter(ctx, time.Until(verification.SentAt.Add(phoneVerificationResendCooldown)))
+	return ctx.JSON(http.StatusTooManyRequests, generated.ErrorResponse{
+		Message: cause.Error(),
+	})
+}
+
+// UserPhoneVerifyConfirm : POST /user/phone/verify/confirm
+func (s *Server) UserPhoneVerifyConfirm(ctx echo.Context) error {
+	var (
+		req         generated.UserPhoneVerifyConfirmRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	id, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	userId, err := uuid.Parse(id)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Retrieve request body
+	if err = ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Required field validation
+	err = ctx.Validate(req)
+	if err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Code is mandatory",
+		})
+	}
+
+	verification, err := s.confirmPhoneVerification(standardCtx, userId, req.Code)
+	if err != nil {
+		switch err {
+		case common.ErrPhoneVerificationNotFound, errVerificationCodeExpired, errInvalidVerificationCode:
+			return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		case common.ErrPhoneVerificationAttemptsExceeded:
+			setRetryAfter(ctx, time.Until(verification.SentAt.Add(phoneVerificationResendCooldown)))
+			return ctx.JSON(http.StatusTooManyRequests, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("confirmPhoneVerification error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Message = "phone number verified successfully"
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// GetUserProfile : GET /user/profile
+func (s *Server) GetUserProfile(ctx echo.Context) error {
+	var (
+		resp        generated.GetUserProfileResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Get user profile
+	getUserInput := repository.GetUserByIdInput{Id: userId}
+	user, err := s.Repository.GetUserById(standardCtx, getUserInput)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			// Follow the specification to return it as 403
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Name = user.Name
+	resp.PhoneNumber = user.PhoneNumber
+	resp.PhoneVerified = user.PhoneVerifiedAt.Valid
+	if user.PhoneVerifiedAt.Valid {
+		resp.PhoneVerifiedAt = &user.PhoneVerifiedAt.Time
+	}
+
+	// Clients send it back as If-Match, so their changes don't overwrite someone else's
+	ctx.Response().Header().Set("ETag", profileETag(user.Version))
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// GetUserLoginHistory : GET /user/login-history
+func (s *Server) GetUserLoginHistory(ctx echo.Context, params generated.GetUserLoginHistoryParams) error {
+	var (
+		resp        generated.GetUserLoginHistoryResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	parsedUserId, err := uuid.Parse(userId)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Pagination parameters validation
+	limit := defaultLoginHistoryLimit
+	if params.Limit != nil {
+		limit = *params.Limit
+	}
+
+	if limit < 1 || limit > maxLoginHistoryLimit {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: fmt.Sprintf("limit must be between 1 and %d", maxLoginHistoryLimit),
+		})
+	}
+
+	var before int64
+	if params.Before != nil {
+		before = *params.Before
+	}
+
+	if before < 0 {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "before must not be negative",
+		})
+	}
+
+	// Get one more event than requested to know whether there's another page
+	listLoginEventsInput := repository.ListLoginEventsInput{
+		UserId:   parsedUserId,
+		BeforeId: before,
+		Limit:    limit + 1,
+	}
+
+	loginEvents, err := s.Repository.ListLoginEvents(standardCtx, listLoginEventsInput)
+	if err != nil {
+		ctx.Logger().Errorf("ListLoginEvents error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	events := loginEvents.Events
+	if len(events) > limit {
+		events = events[:limit]
+		resp.NextBefore = &events[limit-1].Id
+	}
+
+	resp.Events = make([]generated.LoginEvent, 0, len(events))
+	for _, event := range events {
+		resp.Events = append(resp.Events, generated.LoginEvent{
+			Id:         event.Id,
+			Successful: event.Successful,
+			Reason:     event.Reason,
+			IpAddress:  event.IpAddress,
+			UserAgent:  event.UserAgent,
+			CreatedAt:  event.CreatedAt,
+		})
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UpdateUserProfile : PATCH /user/profile
+func (s *Server) UpdateUserProfile(ctx echo.Context, params generated.UpdateUserProfileParams) error {
+	var (
+		req         generated.UpdateUserProfileRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Retrieve request body
+	if err = ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Invalid request body",
+		})
+	}
+
+	// Check if both of the fields are empty
+	if req.PhoneNumber == nil && req.FullName == nil {
+		return ctx.JSON(http.StatusBadRequest, generated.ErrorResponse{
+			Message: "Empty request body",
+		})
+	}
+
+	// Get user by id to get current profile of the user
+	getUserInput := repository.GetUserByIdInput{Id: userId}
+	user, err := s.Repository.GetUserById(standardCtx, getUserInput)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			// Follow the specification to return it as 403
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Reject the changes made to an outdated version of the profile
+	if params.IfMatch != nil && !etagMatches(*params.IfMatch, profileETag(user.Version)) {
+		return ctx.JSON(http.StatusPreconditionFailed, generated.ErrorResponse{
+			Message: common.ErrUserVersionMismatch.Error(),
+		})
+	}
+
+	// Pre-fill input for update user with existing profile
+	updateUserInput := repository.UpdateUserInput{
+		Id:          userId,
+		PhoneNumber: user.PhoneNumber,
+		Name:        user.Name,
+		Version:     user.Version,
+	}
+
+	// Check if any changes happen to the current one
+	var isPhoneChanged, isNameChanged bool
+	if req.PhoneNumber != nil {
+		if user.PhoneNumber != *req.PhoneNumber {
+			isPhoneChanged = true
+		}
+
+		updateUserInput.PhoneNumber = *req.PhoneNumber
+	}
+
+	if req.FullName != nil {
+		if user.Name != *req.FullName {
+			isNameChanged = true
+			updateUserInput.Name = *req.FullName
+		}
+	}
+
+	// Return no content if no changes happened
+	if !isPhoneChanged && !isNameChanged {
+		ctx.Response().Header().Set("ETag", profileETag(user.Version))
+		return ctx.NoContent(http.StatusNoContent)
+	}
+
+	// If phone number changed, check for existing user
+	if isPhoneChanged {
+		getUserByPhoneInput := repository.GetUserByPhoneNumberInput{PhoneNumber: *req.PhoneNumber}
+		existingUser, err := s.Repository.GetUserByPhoneNumber(standardCtx, getUserByPhoneInput)
+		// Return for other errors
+		if err != nil && err != common.ErrUserNotFound {
+			ctx.Logger().Errorf("GetUserByPhoneNumber error: %s", err.Error())
+			return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		// Return conflict status code
+		if err == nil && existingUser.Name != "" {
+			return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+				Message: "phone number exists",
+			})
+		}
+	}
+
+	// Continue the update process
+	err = s.Repository.UpdateUser(standardCtx, updateUserInput)
+	if err != nil {
+		// Taken concurrently since the check above
+		var uniqueViolation *common.UniqueViolationError
+		if errors.As(err, &uniqueViolation) {
+			return ctx.JSON(http.StatusConflict, generated.ErrorResponse{
+				Message: "phone number exists",
+			})
+		}
+
+		// Changed concurrently since it was read above. It's only a failed precondition when the client gave one.
+		if err == common.ErrUserVersionMismatch {
+			status := http.StatusConflict
+			if params.IfMatch != nil {
+				status = http.StatusPreconditionFailed
+			}
+
+			return ctx.JSON(status, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("UpdateUser error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	resp.Message = "changes applied successfully"
+	ctx.Response().Header().Set("ETag", profileETag(user.Version+1))
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// UpdateUserPassword : PUT /user/password
+func (s *Server) UpdateUserPassword(ctx echo.Context) error {
+	var (
+		req         generated.UpdateUserPasswordRequest
+		resp        generated.SuccessMessageResponse
+		standardCtx = ctx.Request().Context()
+	)
+
+	// Retrieve and Get ID from JWT Token
+	userId, err := s.retrieveAndGetIdFromJWTToken(ctx)
+	if err != nil {
+		return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+			Message: err.Error(),
+		})
+	}
+
+	// Retrieve request body
+	if err = ctx.Bind(&req); err != nil {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: []string{"Invalid request body"},
+		})
+	}
+
+	// Field validation
+	err = ctx.Validate(req)
+	if err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errMessages := TranslateErrorMessages(validationErrors, s.PasswordPolicy)
+			return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+				Messages: errMessages,
+			})
+		}
+	}
+
+	// Get user to compare the password
+	user, err := s.Repository.GetUserById(standardCtx, repository.GetUserByIdInput{Id: userId})
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			// Follow the specification to return it as 403
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("GetUserById error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	// Compare supplied current password with the user password
+	err = s.PasswordHasher.Compare(standardCtx, user.Password, req.CurrentPassword)
+	if err != nil {
+		if err == hasher.ErrMismatchedHashAndPassword {
+			return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+				Messages: []string{"Mismatched current password"},
+			})
+		}
+
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("comparePassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	if req.NewPassword == req.CurrentPassword {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: []string{"New password must be different from the current password"},
+		})
+	}
+
+	// Same for the user's name and phone number, which the request doesn't carry
+	err = ctx.Validate(passwordOfUser{Password: req.NewPassword, FullName: user.Name, PhoneNumber: user.PhoneNumber})
+	if validationErrors, ok := err.(validator.ValidationErrors); ok {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: TranslateErrorMessages(validationErrors, s.PasswordPolicy),
+		})
+	}
+
+	// And different from the previous passwords as well
+	reused, err := s.isPasswordReused(standardCtx, user.Id, user.Password, req.NewPassword)
+	if err != nil {
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("isPasswordReused error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	if reused {
+		return ctx.JSON(http.StatusBadRequest, generated.MultipleErrorResponse{
+			Messages: []string{passwordReusedMessage},
+		})
+	}
+
+	// Hash and Salt the new password
+	hashedPassword, err := s.PasswordHasher.Hash(standardCtx, req.NewPassword)
+	if err != nil {
+		if err == hasher.ErrBusy {
+			return rejectBusyHashing(ctx, generated.MultipleErrorResponse{
+				Messages: []string{err.Error()},
+			})
+		}
+
+		ctx.Logger().Errorf("hashPassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	updateUserPasswordInput := repository.UpdateUserPasswordInput{
+		Id:       userId,
+		Password: hashedPassword,
+	}
+
+	err = s.Repository.UpdateUserPassword(standardCtx, updateUserPasswordInput)
+	if err != nil {
+		if err == common.ErrUserNotFound {
+			return ctx.JSON(http.StatusForbidden, generated.ErrorResponse{
+				Message: err.Error(),
+			})
+		}
+
+		ctx.Logger().Errorf("UpdateUserPassword error: %s", err.Error())
+		return ctx.JSON(http.StatusInternalServerError, generated.MultipleErrorResponse{
+			Messages: []string{err.Error()},
+		})
+	}
+
+	resp.Message = "password changed successfully"
 	return ctx.JSON(http.StatusOK, resp)
 }
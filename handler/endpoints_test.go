@@ -1,12 +1,16 @@
 package handler
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -22,15 +26,76 @@ import (
 
 	"github.com/dityuiri/UserServiceTest/common"
 	"github.com/dityuiri/UserServiceTest/generated"
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/passwordcheck"
 	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/revocation"
+	"github.com/dityuiri/UserServiceTest/sms"
+	"github.com/dityuiri/UserServiceTest/totp"
 )
 
+var (
+	testMFAEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	testCodeHashKey      = []byte("fedcba9876543210fedcba9876543210")
+
+	// The test users' passwords are hashed with bcrypt, which then doesn't need a rehash
+	testPasswordHasher, _ = hasher.NewHasher(hasher.NewHasherOptions{Algorithm: hasher.AlgorithmBcrypt})
+)
+
+// failingPasswordHasher fails to hash passwords, and to compare them too when failCompare is set
+type failingPasswordHasher struct {
+	hasher.PasswordHasher
+	failCompare bool
+}
+
+func (h failingPasswordHasher) Hash(context.Context, string) (string, error) {
+	return "", errors.New("error")
+}
+
+func (h failingPasswordHasher) Compare(ctx context.Context, encodedHash string, password string) error {
+	if h.failCompare {
+		return errors.New("error")
+	}
+
+	return h.PasswordHasher.Compare(ctx, encodedHash, password)
+}
+
+// busyPasswordHasher behaves like a hashing pool with no room left in its queue
+type busyPasswordHasher struct {
+	hasher.PasswordHasher
+}
+
+func (h busyPasswordHasher) Hash(context.Context, string) (string, error) {
+	return "", hasher.ErrBusy
+}
+
+func (h busyPasswordHasher) Compare(context.Context, string, string) error {
+	return hasher.ErrBusy
+}
+
+// slowSMSSender takes delay to send every text message, like a gateway far away
+type slowSMSSender struct {
+	sms.SMSSender
+	delay time.Duration
+}
+
+func (s slowSMSSender) SendSMS(ctx context.Context, input sms.SendSMSInput) error {
+	time.Sleep(s.delay)
+	return s.SMSSender.SendSMS(ctx, input)
+}
+
 func initializeTestEchoServer(repo repository.RepositoryInterface) (generated.ServerInterface, *echo.Echo, *sync.WaitGroup) {
 	e := echo.New()
 	validate := validator.New()
-	_ = validate.RegisterValidation("password", ValidatePassword)
+	_ = RegisterPasswordValidation(validate, DefaultPasswordPolicy(), passwordcheck.NewChecker(passwordcheck.NewCheckerOptions{}))
 	e.Validator = &UserRegistrationValidator{Validator: validate}
-	var server generated.ServerInterface = &Server{JWTSecretKey: "key", Repository: repo}
+	var server generated.ServerInterface = NewServer(NewServerOptions{
+		JWTSecretKey:     "key",
+		Repository:       repo,
+		MFAEncryptionKey: testMFAEncryptionKey,
+		PasswordHasher:   testPasswordHasher,
+		CodeHashKey:      testCodeHashKey,
+	})
 	generated.RegisterHandlers(e, server)
 
 	var wg sync.WaitGroup
@@ -45,9 +110,20 @@ func initializeTestEchoServer(repo repository.RepositoryInterface) (generated.Se
 }
 
 func generateNewToken(id string, key string) string {
-	expirationTime := time.Now().Add(2 * time.Minute)
+	return generateNewTokenWithClaims(id, key, uuid.New().String(), uuid.New().String())
+}
+
+func generateNewTokenWithClaims(id string, key string, tokenId string, sessionId string) string {
+	return generateNewTokenIssuedAt(id, key, tokenId, sessionId, time.Now())
+}
+
+func generateNewTokenIssuedAt(id string, key string, tokenId string, sessionId string, issuedAt time.Time) string {
+	expirationTime := issuedAt.Add(2 * time.Minute)
 	claims := &jwt.MapClaims{
 		"id":  id,
+		"jti": tokenId,
+		"sid": sessionId,
+		"iat": jwt.NewNumericDate(issuedAt),
 		"exp": jwt.NewNumericDate(expirationTime),
 	}
 
@@ -56,6 +132,136 @@ func generateNewToken(id string, key string) string {
 	return tokenString
 }
 
+// waitForNextSecond sleeps until the start of the next second, so what follows runs within the same second
+func waitForNextSecond() {
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+}
+
+// loginAndGetUserProfile logs the user in with their password, then gets their profile with the access token issued
+func loginAndGetUserProfile(t *testing.T, sv generated.ServerInterface, e *echo.Echo,
+	mockRepository *repository.MockRepositoryInterface, userId uuid.UUID) *httptest.ResponseRecorder {
+	passwordHash, _ := testPasswordHasher.Hash(context.Background(), "correctPassword123!")
+	mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), gomock.Any()).
+		Return(repository.GetUserByPhoneNumberOutput{Id: userId, Password: passwordHash}, nil).Times(1)
+	mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+		Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+	mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+		Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+	mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+	req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, sv.UserLogin(e.NewContext(req, rec)))
+
+	var loginResp generated.UserLoginResponse
+	if !assert.Equal(t, http.StatusOK, rec.Code) || !assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &loginResp)) {
+		return rec
+	}
+
+	mockRepository.EXPECT().GetUserById(gomock.Any(), repository.GetUserByIdInput{Id: userId.String()}).
+		Return(repository.GetUserByIdOutput{Id: userId}, nil).MaxTimes(1)
+
+	req = httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", loginResp.Token))
+	rec = httptest.NewRecorder()
+	assert.NoError(t, sv.GetUserProfile(e.NewContext(req, rec)))
+	return rec
+}
+
+func TestGetJwks(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("no asymmetric keys configured", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetJwks(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"keys": []}`, rec.Body.String())
+		}
+	})
+
+	t.Run("all ok", func(t *testing.T) {
+		keySet, _ := NewKeySet(generateEd25519SigningKey(t, "current"), generateEd25519SigningKey(t, "previous"))
+		server := NewServer(NewServerOptions{SigningKeys: keySet, Repository: mockRepository})
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, server.GetJwks(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"kid":"current"`)
+			assert.Contains(t, rec.Body.String(), `"kid":"previous"`)
+			assert.NotContains(t, rec.Body.String(), `"d"`)
+			assert.NotEmpty(t, rec.Header().Get("Cache-Control"))
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestGetPasswordPolicy(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("default policy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/password-policy", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetPasswordPolicy(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{
+				"min_length": 6,
+				"max_length": 64,
+				"require_uppercase": true,
+				"require_lowercase": false,
+				"require_digit": true,
+				"require_symbol": true,
+				"allow_unicode": true,
+				"max_repeated_characters": 0,
+				"min_entropy_bits": 0,
+				"description": "Minimum 6 characters, maximum 64 characters, containing at least 1 capital character AND 1 number AND 1 special (non-alpha-numeric) character."
+			}`, rec.Body.String())
+			assert.NotEmpty(t, rec.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("configured policy", func(t *testing.T) {
+		server := NewServer(NewServerOptions{PasswordPolicy: PasswordPolicy{MinLength: 12, MaxLength: 128, MinEntropyBits: 50}})
+
+		req := httptest.NewRequest(http.MethodGet, "/password-policy", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, server.GetPasswordPolicy(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"min_length":12`)
+			assert.Contains(t, rec.Body.String(), `"min_entropy_bits":50`)
+			assert.Contains(t, rec.Body.String(), "at least 50 bits of entropy")
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
 func TestUserRegister(t *testing.T) {
 	var (
 		mockCtrl       = gomock.NewController(t)
@@ -65,7 +271,7 @@ func TestUserRegister(t *testing.T) {
 	sv, e, wg := initializeTestEchoServer(mockRepository)
 
 	t.Run("all ok", func(t *testing.T) {
-		reqBody := `{"full_name": "Haga Uruna", "password": "Pass123!", "phone_number": "+62123456789"}`
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -146,8 +352,47 @@ func TestUserRegister(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid password rule - common password", func(t *testing.T) {
+		reqBody := `{"full_name": "Haga Uruna", "password": "Password1!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserRegister(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Password is too common or has appeared in a data breach")
+		}
+	})
+
+	t.Run("invalid password rule - contains the name", func(t *testing.T) {
+		reqBody := `{"full_name": "Haga Uruna", "password": "Uruna-2024!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserRegister(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Password must not contain your name or phone number.")
+		}
+	})
+
+	t.Run("invalid password rule - contains the phone number", func(t *testing.T) {
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka!123456", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserRegister(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Password must not contain your name or phone number.")
+		}
+	})
+
 	t.Run("get user phone number returns error", func(t *testing.T) {
-		reqBody := `{"full_name": "Haga Uruna", "password": "Pass123!", "phone_number": "+62123456789"}`
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -163,7 +408,7 @@ func TestUserRegister(t *testing.T) {
 	})
 
 	t.Run("user already exists", func(t *testing.T) {
-		reqBody := `{"full_name": "Haga Uruna", "password": "Pass123!", "phone_number": "+62123456789"}`
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -179,7 +424,7 @@ func TestUserRegister(t *testing.T) {
 	})
 
 	t.Run("generate hash from password returning error", func(t *testing.T) {
-		reqBody := `{"full_name": "Haga Uruna", "password": "Pass123!", "phone_number": "+62123456789"}`
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -188,12 +433,10 @@ func TestUserRegister(t *testing.T) {
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), repository.GetUserByPhoneNumberInput{PhoneNumber: "+62123456789"}).
 			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
 
-		// patch generate from password
-		tempFunc := GenerateFromPassword
-		GenerateFromPassword = func(password []byte, cost int) ([]byte, error) {
-			return []byte(""), errors.New("error")
-		}
-		defer func() { GenerateFromPassword = tempFunc }()
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = failingPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
 
 		if assert.NoError(t, sv.UserRegister(c)) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
@@ -201,8 +444,30 @@ func TestUserRegister(t *testing.T) {
 		}
 	})
 
+	t.Run("too many passwords being hashed", func(t *testing.T) {
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), repository.GetUserByPhoneNumberInput{PhoneNumber: "+62123456789"}).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = busyPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		if assert.NoError(t, sv.UserRegister(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
 	t.Run("insert user return error", func(t *testing.T) {
-		reqBody := `{"full_name": "Haga Uruna", "password": "Pass123!", "phone_number": "+62123456789"}`
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -218,155 +483,3036 @@ func TestUserRegister(t *testing.T) {
 		}
 	})
 
+	t.Run("user registered concurrently", func(t *testing.T) {
+		reqBody := `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), repository.GetUserByPhoneNumberInput{PhoneNumber: "+62123456789"}).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().InsertUser(gomock.Any(), gomock.Any()).
+			Return(&common.UniqueViolationError{Constraint: "phone_number_key"}).Times(1)
+
+		if assert.NoError(t, sv.UserRegister(c)) {
+			assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+			assert.Contains(t, rec.Body.String(), "User already exists")
+		}
+	})
+
 	_ = e.Shutdown(context.Background())
 	wg.Wait()
 }
 
-func TestUserLogin(t *testing.T) {
+func TestUserRegisterEnumerationSafe(t *testing.T) {
 	var (
 		mockCtrl       = gomock.NewController(t)
 		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
 
-		knownHash, _ = bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.DefaultCost)
-
-		userInput = repository.GetUserByPhoneNumberInput{
-			PhoneNumber: "+62123456789",
-		}
+		outbox  bytes.Buffer
+		reqBody = `{"full_name": "Haga Uruna", "password": "Quokka7-Lamp!", "phone_number": "+62123456789"}`
 
-		userOutput = repository.GetUserByPhoneNumberOutput{
-			Id:                   uuid.New(),
-			Name:                 "Kurumi Ruru",
-			Password:             string(knownHash),
-			NumOfSuccessfulLogin: sql.NullInt32{Int32: 0},
-		}
+		userInput = repository.GetUserByPhoneNumberInput{PhoneNumber: "+62123456789"}
 	)
 
 	sv, e, wg := initializeTestEchoServer(mockRepository)
+	sv.(*Server).EnumerationSafe = true
+	sv.(*Server).SMSSender = sms.NewWriterSender(&outbox)
 
-	t.Run("all ok", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+	register := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(reqBody))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
-		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
-			repository.UpsertUserLoginInput{UserId: userOutput.Id,
-				NumOfSuccessfulLogin: userOutput.NumOfSuccessfulLogin.Int32 + 1}).Return(nil).Times(1)
+		assert.NoError(t, sv.UserRegister(c))
+		return rec
+	}
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusOK, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
-	})
+	var newUserRec, existingUserRec *httptest.ResponseRecorder
 
-	t.Run("invalid request body", func(t *testing.T) {
-		reqBody := `{perkedel}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+	t.Run("new user", func(t *testing.T) {
+		outbox.Reset()
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusBadRequest, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
+		var userId uuid.UUID
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().InsertUser(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertUserInput) error {
+				userId = input.Id
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpsertPhoneVerificationInput) error {
+				assert.Equal(t, userId, input.UserId)
+				assert.Equal(t, "+62123456789", input.PhoneNumber)
+				return nil
+			}).Times(1)
+
+		newUserRec = register()
+		assert.Equal(t, http.StatusAccepted, newUserRec.Code)
+		assert.Contains(t, newUserRec.Body.String(), registrationAcceptedMessage)
+		assert.NotContains(t, newUserRec.Body.String(), userId.String())
+		assert.Regexp(t, `SMS to \+62123456789: Your verification code is \d{6}`, outbox.String())
 	})
 
-	t.Run("field validation failed", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusBadRequest, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
-	})
+	t.Run("phone number already registered", func(t *testing.T) {
+		outbox.Reset()
 
-	t.Run("user not found", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{Id: uuid.New()}, nil).Times(1)
 
-		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		existingUserRec = register()
+		assert.Contains(t, outbox.String(), "SMS to +62123456789: "+registrationAttemptMessage)
+	})
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusBadRequest, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
+	t.Run("same response either way", func(t *testing.T) {
+		assert.Equal(t, newUserRec.Code, existingUserRec.Code)
+		assert.Equal(t, newUserRec.Body.String(), existingUserRec.Body.String())
 	})
 
 	t.Run("get user by phone returning internal server error", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
 			Return(repository.GetUserByPhoneNumberOutput{}, errors.New("error")).Times(1)
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusInternalServerError, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
+		rec := register()
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
-	t.Run("mismatched password", func(t *testing.T) {
-		reqBody := `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
-
-		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+	t.Run("insert user returning internal server error", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().InsertUser(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusBadRequest, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
+		rec := register()
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
 	})
 
-	t.Run("compare hash anda password returning error", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+	t.Run("phone number registered concurrently", func(t *testing.T) {
+		outbox.Reset()
 
-		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
-		// patch
-		tempFunc := CompareHashAndPassword
-		CompareHashAndPassword = func(hashedPassword, password []byte) error {
-			return errors.New("error")
-		}
-		defer func() { CompareHashAndPassword = tempFunc }()
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().InsertUser(gomock.Any(), gomock.Any()).
+			Return(&common.UniqueViolationError{Constraint: "phone_number_key"}).Times(1)
 
-		if assert.NoError(t, sv.UserLogin(c)) {
-			assert.Equal(t, http.StatusInternalServerError, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
-		}
+		rec := register()
+		assert.Equal(t, newUserRec.Code, rec.Code)
+		assert.Equal(t, newUserRec.Body.String(), rec.Body.String())
+		assert.Contains(t, outbox.String(), "SMS to +62123456789: "+registrationAttemptMessage)
 	})
 
-	t.Run("update user login returns error", func(t *testing.T) {
-		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
-		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+	t.Run("sending the verification code fails", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().InsertUser(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
 
-		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
-		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
-			repository.UpsertUserLoginInput{UserId: userOutput.Id,
-				NumOfSuccessfulLogin: userOutput.NumOfSuccessfulLogin.Int32 + 1}).Return(errors.New("error")).Times(1)
+		// The user can still request another code once logged in
+		rec := register()
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+	})
+
+	t.Run("generate from password returning error", func(t *testing.T) {
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = failingPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		rec := register()
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserLoginEnumerationSafe(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		knownHash, _ = bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.DefaultCost)
+
+		outbox    bytes.Buffer
+		reqBody   = `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
+		userInput = repository.GetUserByPhoneNumberInput{PhoneNumber: "+62123456789"}
+
+		userOutput = repository.GetUserByPhoneNumberOutput{
+			Id:       uuid.New(),
+			Name:     "Kurumi Ruru",
+			Password: string(knownHash),
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+	sv.(*Server).EnumerationSafe = true
+	sv.(*Server).SMSSender = sms.NewWriterSender(&outbox)
+
+	loginWith := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		assert.NoError(t, sv.UserLogin(c))
+		return rec
+	}
+
+	login := func() (*httptest.ResponseRecorder, time.Duration) {
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		start := time.Now()
+		assert.NoError(t, sv.UserLogin(c))
+		return rec, time.Since(start)
+	}
+
+	expectUnknownUser := func() {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+	}
+
+	expectWrongPassword := func() {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{NumOfFailedLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	}
+
+	t.Run("same response for an unknown user, a wrong password and a locked account", func(t *testing.T) {
+		expectUnknownUser()
+		unknownUserRec, _ := login()
+
+		expectWrongPassword()
+		wrongPasswordRec, _ := login()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{NumOfFailedLogin: defaultLoginLockoutThreshold}, nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		lockingRec, _ := login()
+
+		lockedUser := userOutput
+		lockedUser.NumOfFailedLogin = sql.NullInt32{Int32: defaultLoginLockoutThreshold, Valid: true}
+		lockedUser.LastFailedLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(lockedUser, nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		lockedRec, _ := login()
+
+		for _, rec := range []*httptest.ResponseRecorder{unknownUserRec, wrongPasswordRec, lockingRec, lockedRec} {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, unknownUserRec.Body.String(), rec.Body.String())
+			assert.Empty(t, rec.Header().Get("Retry-After"))
+		}
+
+		assert.Contains(t, unknownUserRec.Body.String(), invalidCredentialsMessage)
+	})
+
+	expectLoginSuccess := func(user repository.GetUserByPhoneNumberOutput) {
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: user.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), repository.UpsertUserLoginInput{UserId: user.Id}).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	}
+
+	expectPhoneUnverifiedEvent := func() {
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertLoginEventInput) error {
+				assert.False(t, input.Successful)
+				assert.Equal(t, loginReasonPhoneUnverified, input.Reason)
+				return nil
+			}).Times(1)
+	}
+
+	var (
+		correctPasswordBody = `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		withCodeBody        = `{"password": "correctPassword123!", "phone_number": "+62123456789", "verification_code": "%s"}`
+
+		verification = repository.GetPhoneVerificationOutput{
+			PhoneNumber: "+62123456789",
+			CodeHash:    hashVerificationCode(testCodeHashKey, userOutput.Id, "+62123456789", "123456"),
+			ExpiresAt:   time.Now().Add(phoneVerificationCodeTTL),
+			SentAt:      time.Now(),
+		}
+	)
+
+	t.Run("verified phone number logs in", func(t *testing.T) {
+		verifiedUser := userOutput
+		verifiedUser.PhoneVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(verifiedUser, nil).Times(1)
+		expectLoginSuccess(verifiedUser)
+
+		rec := loginWith(correctPasswordBody)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "refresh_token")
+	})
+
+	t.Run("unverified phone number without a code gets a new one", func(t *testing.T) {
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpsertPhoneVerificationInput) error {
+				assert.Equal(t, userOutput.Id, input.UserId)
+				assert.Equal(t, "+62123456789", input.PhoneNumber)
+				return nil
+			}).Times(1)
+		expectPhoneUnverifiedEvent()
+
+		rec := loginWith(correctPasswordBody)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), invalidCredentialsMessage)
+		assert.Contains(t, outbox.String(), "Your verification code is")
+	})
+
+	t.Run("unverified phone number within the resend cooldown", func(t *testing.T) {
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).
+			Return(common.ErrPhoneVerificationCooldown).Times(1)
+		expectPhoneUnverifiedEvent()
+
+		rec := loginWith(correctPasswordBody)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), invalidCredentialsMessage)
+		assert.Empty(t, outbox.String())
+	})
+
+	t.Run("unverified phone number verified by the code", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), repository.GetPhoneVerificationInput{UserId: userOutput.Id}).
+			Return(verification, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().VerifyUserPhone(gomock.Any(), repository.VerifyUserPhoneInput{
+			UserId:      userOutput.Id,
+			PhoneNumber: "+62123456789",
+		}).Return(nil).Times(1)
+		expectLoginSuccess(userOutput)
+
+		rec := loginWith(fmt.Sprintf(withCodeBody, "123456"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), "refresh_token")
+	})
+
+	t.Run("unverified phone number with a wrong code", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verification, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPhoneUnverifiedEvent()
+
+		rec := loginWith(fmt.Sprintf(withCodeBody, "654321"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), invalidCredentialsMessage)
+	})
+
+	t.Run("unverified phone number with too many wrong codes", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verification, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).
+			Return(common.ErrPhoneVerificationAttemptsExceeded).Times(1)
+		expectPhoneUnverifiedEvent()
+
+		rec := loginWith(fmt.Sprintf(withCodeBody, "123456"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), invalidCredentialsMessage)
+	})
+
+	t.Run("unverified phone number with an expired code gets a new one", func(t *testing.T) {
+		expired := verification
+		expired.ExpiresAt = time.Now().Add(-time.Minute)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(expired, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPhoneUnverifiedEvent()
+
+		rec := loginWith(fmt.Sprintf(withCodeBody, "123456"))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), invalidCredentialsMessage)
+	})
+
+	t.Run("verifying the phone number returns error", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).
+			Return(repository.GetPhoneVerificationOutput{}, errors.New("error")).Times(1)
+
+		rec := loginWith(fmt.Sprintf(withCodeBody, "123456"))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("same response for an unknown user and a known one when too many passwords are being hashed", func(t *testing.T) {
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = busyPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		expectUnknownUser()
+		unknownUserRec, _ := login()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		knownUserRec, _ := login()
+
+		for _, rec := range []*httptest.ResponseRecorder{unknownUserRec, knownUserRec} {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, unknownUserRec.Body.String(), rec.Body.String())
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("timing parity between an unknown user and a wrong password", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("timing measurement skipped in short mode")
+		}
+
+		const rounds = 7
+		var unknownUserTimes, wrongPasswordTimes []time.Duration
+		for i := 0; i < rounds; i++ {
+			expectUnknownUser()
+			_, elapsed := login()
+			unknownUserTimes = append(unknownUserTimes, elapsed)
+
+			expectWrongPassword()
+			_, elapsed = login()
+			wrongPasswordTimes = append(wrongPasswordTimes, elapsed)
+		}
+
+		median := func(times []time.Duration) time.Duration {
+			sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+			return times[len(times)/2]
+		}
+
+		// Both are dominated by the bcrypt comparison
+		unknownUserTime, wrongPasswordTime := median(unknownUserTimes), median(wrongPasswordTimes)
+		assert.InEpsilon(t, float64(wrongPasswordTime), float64(unknownUserTime), 0.3,
+			"unknown user %s, wrong password %s", unknownUserTime, wrongPasswordTime)
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserLogin(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		knownHash, _ = bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.DefaultCost)
+
+		userInput = repository.GetUserByPhoneNumberInput{
+			PhoneNumber: "+62123456789",
+		}
+
+		userOutput = repository.GetUserByPhoneNumberOutput{
+			Id:                   uuid.New(),
+			Name:                 "Kurumi Ruru",
+			Password:             string(knownHash),
+			NumOfSuccessfulLogin: sql.NullInt32{Int32: 0},
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	expectLoginEvent := func(successful bool, reason string) {
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertLoginEventInput) error {
+				assert.Equal(t, userOutput.Id, input.UserId)
+				assert.Equal(t, successful, input.Successful)
+				assert.Equal(t, reason, input.Reason)
+				return nil
+			}).Times(1)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("User-Agent", "okhttp/4.12.0")
+		req.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		var sessionId uuid.UUID
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
+			repository.UpsertUserLoginInput{UserId: userOutput.Id}).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: userOutput.NumOfSuccessfulLogin.Int32 + 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertUserSessionInput) error {
+				assert.Equal(t, userOutput.Id, input.UserId)
+				assert.Equal(t, "okhttp/4.12.0", input.UserAgent)
+				assert.Equal(t, "203.0.113.7", input.IpAddress)
+				sessionId = input.Id
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertRefreshTokenInput) error {
+				// The session is identified by the refresh token family
+				assert.Equal(t, sessionId, input.FamilyId)
+				return nil
+			}).Times(1)
+
+		expectLoginEvent(true, loginReasonPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "refresh_token")
+		}
+	})
+
+	t.Run("bcrypt hash upgraded on login", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		argon2idHasher, _ := hasher.NewHasher(hasher.NewHasherOptions{Argon2idMemory: 64, Argon2idIterations: 1})
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = argon2idHasher
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RehashUserPassword(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.RehashUserPasswordInput) error {
+				assert.Equal(t, userOutput.Id, input.Id)
+				assert.Equal(t, userOutput.Password, input.CurrentPassword)
+				assert.True(t, strings.HasPrefix(input.Password, "$argon2id$v=19$m=64,t=1,p=1$"))
+				assert.NoError(t, argon2idHasher.Compare(context.Background(), input.Password, "correctPassword123!"))
+				return nil
+			}).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("rehash returning error doesn't fail the login", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		strongerHasher, _ := hasher.NewHasher(hasher.NewHasherOptions{Algorithm: hasher.AlgorithmBcrypt,
+			BcryptCost: bcrypt.DefaultCost + 1})
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = strongerHasher
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RehashUserPassword(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("insert login event returning error doesn't fail the login", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "refresh_token")
+		}
+	})
+
+	t.Run("insert login event returning error doesn't change a failed login", func(t *testing.T) {
+		reqBody := `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{NumOfFailedLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Mismatched password")
+		}
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		reqBody := `{perkedel}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
 
 		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("get user by phone returning internal server error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("mismatched password", func(t *testing.T) {
+		reqBody := `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.RecordFailedLoginInput) (repository.RecordFailedLoginOutput, error) {
+				assert.Equal(t, userOutput.Id, input.UserId)
+				assert.Equal(t, sv.(*Server).LoginLockoutWindow, input.FailedAt.Sub(input.WindowStart))
+				return repository.RecordFailedLoginOutput{NumOfFailedLogin: 1}, nil
+			}).Times(1)
+
+		expectLoginEvent(false, loginReasonWrongPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("mismatched password reaching the lockout threshold", func(t *testing.T) {
+		reqBody := `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{NumOfFailedLogin: defaultLoginLockoutThreshold}, nil).Times(1)
+
+		expectLoginEvent(false, loginReasonWrongPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusLocked, rec.Code)
+			assert.Equal(t, "900", rec.Header().Get("Retry-After"))
+			assert.Contains(t, rec.Body.String(), accountLockedMessage)
+		}
+	})
+
+	t.Run("record failed login returning error", func(t *testing.T) {
+		reqBody := `{"password": "haguUruna123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("account locked out", func(t *testing.T) {
+		// Even the right password is refused while the account is locked
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		lockedUser := userOutput
+		lockedUser.NumOfFailedLogin = sql.NullInt32{Int32: defaultLoginLockoutThreshold, Valid: true}
+		lockedUser.LastFailedLoginAt = sql.NullTime{Time: time.Now().Add(-5 * time.Minute), Valid: true}
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(lockedUser, nil).Times(1)
+
+		expectLoginEvent(false, loginReasonLocked)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusLocked, rec.Code)
+			assert.Equal(t, "600", rec.Header().Get("Retry-After"))
+			assert.Contains(t, rec.Body.String(), accountLockedMessage)
+		}
+	})
+
+	t.Run("login attempted during the progressive delay", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		// The third failure delays the next attempt by two seconds
+		delayedUser := userOutput
+		delayedUser.NumOfFailedLogin = sql.NullInt32{Int32: 3, Valid: true}
+		delayedUser.LastFailedLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(delayedUser, nil).Times(1)
+
+		expectLoginEvent(false, loginReasonLocked)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+			assert.Contains(t, rec.Body.String(), tooManyLoginAttemptsMessage)
+		}
+	})
+
+	t.Run("lockout expired", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		unlockedUser := userOutput
+		unlockedUser.NumOfFailedLogin = sql.NullInt32{Int32: defaultLoginLockoutThreshold, Valid: true}
+		unlockedUser.LastFailedLoginAt = sql.NullTime{Time: time.Now().Add(-defaultLoginLockoutDuration), Valid: true}
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(unlockedUser, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
+			repository.UpsertUserLoginInput{UserId: userOutput.Id}).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: userOutput.NumOfSuccessfulLogin.Int32 + 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("compare hash anda password returning error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = failingPasswordHasher{PasswordHasher: tempHasher, failCompare: true}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("too many passwords being hashed", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = busyPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		// A busy pool is not a failed login
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).Times(0)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("two-factor authentication enabled", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{
+				UserId:      userOutput.Id,
+				ConfirmedAt: sql.NullTime{Time: time.Now(), Valid: true},
+			}, nil).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), "mfa_token")
+			assert.NotContains(t, rec.Body.String(), "refresh_token")
+		}
+	})
+
+	t.Run("two-factor authentication enrollment not confirmed", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{UserId: userOutput.Id}, nil).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonPassword)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "refresh_token")
+		}
+	})
+
+	t.Run("get user mfa returns error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserMFAOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("update user login returns error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
+			repository.UpsertUserLoginInput{UserId: userOutput.Id}).
+			Return(repository.UpsertUserLoginOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("insert user session returns error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("insert refresh token returns error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("generate refresh token returns error", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userOutput.Id}).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		// patch
+		tempFunc := RandRead
+		RandRead = func(b []byte) (n int, err error) {
+			return 0, errors.New("error")
+		}
+		defer func() { RandRead = tempFunc }()
+
+		if assert.NoError(t, sv.UserLogin(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserLoginMfa(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+		secret = []byte("12345678901234567890")
+
+		userOutput = repository.GetUserByIdOutput{
+			Id:                   userId,
+			Name:                 "Kurumi Ruru",
+			PhoneNumber:          "+62123456789",
+			NumOfSuccessfulLogin: sql.NullInt32{Int32: 3, Valid: true},
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+	server := sv.(*Server)
+
+	encryptedSecret, _ := server.encryptMFASecret(userId, secret)
+	userMFAOutput := repository.GetUserMFAOutput{
+		UserId:          userId,
+		EncryptedSecret: encryptedSecret,
+		ConfirmedAt:     sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	expectLoginEvent := func(successful bool, reason string) {
+		mockRepository.EXPECT().InsertLoginEvent(gomock.Any(),
+			repository.InsertLoginEventInput{UserId: userId, Successful: successful, Reason: reason, IpAddress: "192.0.2.1"}).
+			Return(nil).Times(1)
+	}
+
+	expectFailedLogin := func(numOfFailedLogin int32) {
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.RecordFailedLoginInput) (repository.RecordFailedLoginOutput, error) {
+				assert.Equal(t, userId, input.UserId)
+				assert.Equal(t, defaultLoginLockoutWindow, input.FailedAt.Sub(input.WindowStart))
+				return repository.RecordFailedLoginOutput{NumOfFailedLogin: numOfFailedLogin}, nil
+			}).Times(1)
+	}
+
+	newRequest := func(mfaToken string, code string) (*httptest.ResponseRecorder, echo.Context) {
+		reqBody := fmt.Sprintf(`{"mfa_token": "%s", "code": "%s"}`, mfaToken, code)
+		req := httptest.NewRequest(http.MethodPost, "/user/login/mfa", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		now := time.Now()
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, totp.Code(secret, now))
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), repository.GetUserByIdInput{Id: userId.String()}).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userId}).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserMFALastUsedStep(gomock.Any(),
+			repository.UpdateUserMFALastUsedStepInput{UserId: userId, Step: totp.Step(now)}).Return(nil).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(),
+			repository.UpsertUserLoginInput{UserId: userId}).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 4}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonMFA)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "refresh_token")
+		}
+
+		// The same challenge can't be completed twice
+		rec, c = newRequest(mfaToken, totp.Code(secret, time.Now()))
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "ABCD-EFGH-IJKL-MNOP")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), repository.UseMFARecoveryCodeInput{
+			UserId:   userId,
+			CodeHash: hashRecoveryCode("abcdefghijklmnop"),
+		}).Return(nil).Times(1)
+		mockRepository.EXPECT().UpsertUserLogin(gomock.Any(), gomock.Any()).
+			Return(repository.UpsertUserLoginOutput{NumOfSuccessfulLogin: 1}, nil).Times(1)
+		mockRepository.EXPECT().InsertUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		expectLoginEvent(true, loginReasonMFA)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/login/mfa", strings.NewReader(`{perkedel}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "")
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("access token is not a challenge token", func(t *testing.T) {
+		rec, c := newRequest(generateNewToken(userId.String(), "key"), "123456")
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "000000")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Any()).Return(common.ErrMFARecoveryCodeNotFound).Times(1)
+		expectFailedLogin(1)
+
+		expectLoginEvent(false, loginReasonInvalidMFACode)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("challenge revoked after too many invalid codes", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "000000")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Any()).Return(common.ErrMFARecoveryCodeNotFound).Times(1)
+		expectFailedLogin(mfaChallengeMaxFailures)
+
+		expectLoginEvent(false, loginReasonInvalidMFACode)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), tooManyInvalidCodesMessage)
+		}
+
+		// Even the right code isn't accepted with the revoked challenge
+		rec, c = newRequest(mfaToken, totp.Code(secret, time.Now()))
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), "token has been revoked")
+		}
+	})
+
+	t.Run("locked out by invalid code", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "000000")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Any()).Return(common.ErrMFARecoveryCodeNotFound).Times(1)
+		expectFailedLogin(defaultLoginLockoutThreshold)
+
+		expectLoginEvent(false, loginReasonInvalidMFACode)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusLocked, rec.Code)
+			assert.Equal(t, "900", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("locked out before checking the code", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, totp.Code(secret, time.Now()))
+
+		lockedOutUser := userOutput
+		lockedOutUser.NumOfFailedLogin = sql.NullInt32{Int32: 2, Valid: true}
+		lockedOutUser.LastFailedLoginAt = sql.NullTime{Time: time.Now(), Valid: true}
+
+		// Neither the code is checked nor the failure counted while the delay runs
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(lockedOutUser, nil).Times(1)
+
+		expectLoginEvent(false, loginReasonLocked)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("record failed login returns error", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "000000")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Any()).Return(common.ErrMFARecoveryCodeNotFound).Times(1)
+		mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+			Return(repository.RecordFailedLoginOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		}
+	})
+
+	t.Run("code already used", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, totp.Code(secret, time.Now()))
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserMFALastUsedStep(gomock.Any(), gomock.Any()).Return(common.ErrMFACodeAlreadyUsed).Times(1)
+		expectFailedLogin(1)
+
+		expectLoginEvent(false, loginReasonInvalidMFACode)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "123456")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserByIdOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("get user mfa returns error", func(t *testing.T) {
+		mfaToken, _ := server.generateMFAChallengeToken(userId.String())
+		rec, c := newRequest(mfaToken, "123456")
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserMFAOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLoginMfa(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserTokenRefresh(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		refreshToken = "kq3Jd1m0rO8yV1b3rN2zXw7gS9hH4tL6cE5pQ0aU2fY"
+		reqBody      = fmt.Sprintf(`{"refresh_token": "%s"}`, refreshToken)
+
+		refreshTokenInput = repository.GetRefreshTokenByHashInput{
+			TokenHash: hashRefreshToken(refreshToken),
+		}
+
+		refreshTokenOutput = repository.GetRefreshTokenByHashOutput{
+			Id:        uuid.New(),
+			UserId:    uuid.New(),
+			FamilyId:  uuid.New(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(refreshTokenOutput, nil).Times(1)
+		mockRepository.EXPECT().MarkRefreshTokenUsed(gomock.Any(),
+			repository.MarkRefreshTokenUsedInput{Id: refreshTokenOutput.Id}).Return(nil).Times(1)
+		mockRepository.EXPECT().TouchUserSession(gomock.Any(),
+			repository.TouchUserSessionInput{Id: refreshTokenOutput.FamilyId, IpAddress: "192.0.2.1"}).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.InsertRefreshTokenInput) error {
+				// Rotated token must stay within the same family
+				assert.Equal(t, refreshTokenOutput.FamilyId, input.FamilyId)
+				assert.Equal(t, refreshTokenOutput.UserId, input.UserId)
+				assert.NotEqual(t, refreshTokenInput.TokenHash, input.TokenHash)
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), "refresh_token")
+		}
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(`{perkedel}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(`{}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("refresh token not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).
+			Return(repository.GetRefreshTokenByHashOutput{}, common.ErrRefreshTokenNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("get refresh token returns error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).
+			Return(repository.GetRefreshTokenByHashOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("refresh token revoked", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		revokedOutput := refreshTokenOutput
+		revokedOutput.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(revokedOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("refresh token reused revokes the family", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		usedOutput := refreshTokenOutput
+		usedOutput.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(usedOutput, nil).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(),
+			repository.RevokeRefreshTokenFamilyInput{FamilyId: refreshTokenOutput.FamilyId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("revoke refresh token family returns error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		usedOutput := refreshTokenOutput
+		usedOutput.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(usedOutput, nil).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("refresh token expired", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		expiredOutput := refreshTokenOutput
+		expiredOutput.ExpiresAt = time.Now().Add(-time.Minute)
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(expiredOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("concurrent use of the same refresh token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(refreshTokenOutput, nil).Times(1)
+		mockRepository.EXPECT().MarkRefreshTokenUsed(gomock.Any(), gomock.Any()).Return(common.ErrRefreshTokenAlreadyUsed).Times(1)
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(),
+			repository.RevokeRefreshTokenFamilyInput{FamilyId: refreshTokenOutput.FamilyId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("mark refresh token used returns error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(refreshTokenOutput, nil).Times(1)
+		mockRepository.EXPECT().MarkRefreshTokenUsed(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("touch user session returns error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(refreshTokenOutput, nil).Times(1)
+		mockRepository.EXPECT().MarkRefreshTokenUsed(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().TouchUserSession(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		// Keeping track of the session isn't worth failing the refresh
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("insert refresh token returns error", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(gomock.Any(), refreshTokenInput).Return(refreshTokenOutput, nil).Times(1)
+		mockRepository.EXPECT().MarkRefreshTokenUsed(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().TouchUserSession(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().InsertRefreshToken(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserPasswordResetRequest(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userInput = repository.GetUserByPhoneNumberInput{
+			PhoneNumber: "+62123456789",
+		}
+
+		userOutput = repository.GetUserByPhoneNumberOutput{
+			Id:   uuid.New(),
+			Name: "Kurumi Ruru",
+		}
+
+		outbox bytes.Buffer
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+	sv.(*Server).SMSSender = sms.NewWriterSender(&outbox)
+
+	newRequest := func(reqBody string) (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodPost, "/user/password/reset/request", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+		outbox.Reset()
+
+		var upsertInput repository.UpsertPasswordResetInput
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPasswordReset(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpsertPasswordResetInput) error {
+				upsertInput = input
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordResetRequestedMessage)
+
+			// Sent after responding
+			assert.NoError(t, sv.(*Server).Close())
+			code := regexp.MustCompile(`code is (\d{6})`).FindStringSubmatch(outbox.String())
+			if assert.Len(t, code, 2) {
+				assert.Contains(t, outbox.String(), "SMS to +62123456789")
+				assert.Equal(t, hashVerificationCode(testCodeHashKey, userOutput.Id, "+62123456789", code[1]), upsertInput.CodeHash)
+			}
+
+			assert.Equal(t, passwordResetCodeTTL, upsertInput.ExpiresAt.Sub(upsertInput.SentAt))
+		}
+	})
+
+	t.Run("unknown phone number gets the same response", func(t *testing.T) {
+		rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordResetRequestedMessage)
+			assert.Empty(t, outbox.String())
+		}
+	})
+
+	t.Run("sent too recently gets the same response", func(t *testing.T) {
+		rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPasswordReset(gomock.Any(), gomock.Any()).Return(common.ErrPasswordResetCooldown).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordResetRequestedMessage)
+			assert.NoError(t, sv.(*Server).Close())
+			assert.Empty(t, outbox.String())
+		}
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		rec, c := newRequest(`{perkedel}`)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		rec, c := newRequest(`{}`)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("get user by phone returning error", func(t *testing.T) {
+		rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("upsert password reset returning error gets the same response", func(t *testing.T) {
+		rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPasswordReset(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetRequest(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordResetRequestedMessage)
+			assert.NoError(t, sv.(*Server).Close())
+			assert.Empty(t, outbox.String())
+		}
+	})
+
+	t.Run("timing parity between an unknown and a registered phone number", func(t *testing.T) {
+		if testing.Short() {
+			t.Skip("timing measurement skipped in short mode")
+		}
+
+		// Storing and sending the code take long enough to tell a registered phone number apart, if waited for
+		const sendDelay = 200 * time.Millisecond
+		tempSender := sv.(*Server).SMSSender
+		sv.(*Server).SMSSender = slowSMSSender{SMSSender: tempSender, delay: sendDelay}
+		defer func() { sv.(*Server).SMSSender = tempSender }()
+
+		request := func() time.Duration {
+			rec, c := newRequest(`{"phone_number": "+62123456789"}`)
+
+			start := time.Now()
+			assert.NoError(t, sv.UserPasswordResetRequest(c))
+			elapsed := time.Since(start)
+
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			return elapsed
+		}
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		unknownTime := request()
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPasswordReset(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		registeredTime := request()
+
+		assert.NoError(t, sv.(*Server).Close())
+		assert.Less(t, unknownTime, sendDelay/2)
+		assert.Less(t, registeredTime, sendDelay/2, "unknown %s, registered %s", unknownTime, registeredTime)
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserPasswordResetConfirm(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userInput = repository.GetUserByPhoneNumberInput{
+			PhoneNumber: "+62123456789",
+		}
+
+		knownHash, _ = bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.DefaultCost)
+
+		userOutput = repository.GetUserByPhoneNumberOutput{
+			Id:       uuid.New(),
+			Name:     "Kurumi Ruru",
+			Password: string(knownHash),
+		}
+
+		passwordHistoryInput = repository.GetPasswordHistoryInput{UserId: userOutput.Id}
+
+		codeHash = hashVerificationCode(testCodeHashKey, userOutput.Id, "+62123456789", "123456")
+
+		passwordResetOutput = repository.GetPasswordResetOutput{
+			UserId:    userOutput.Id,
+			CodeHash:  codeHash,
+			ExpiresAt: time.Now().Add(5 * time.Minute),
+			SentAt:    time.Now(),
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	expectPasswordHistory := func(passwordHashes ...string) {
+		mockRepository.EXPECT().GetPasswordHistory(gomock.Any(), passwordHistoryInput).
+			Return(repository.GetPasswordHistoryOutput{PasswordHashes: passwordHashes}, nil).Times(1)
+	}
+
+	newRequest := func(code string, password string) (*httptest.ResponseRecorder, echo.Context) {
+		reqBody := fmt.Sprintf(`{"phone_number": "+62123456789", "code": "%s", "password": "%s"}`, code, password)
+		req := httptest.NewRequest(http.MethodPost, "/user/password/reset/confirm", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		// A token issued before the reset must be rejected afterwards
+		oldToken := generateNewTokenIssuedAt(userOutput.Id.String(), "key", uuid.New().String(), uuid.New().String(),
+			time.Now().Add(-time.Second))
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), repository.GetPasswordResetInput{UserId: userOutput.Id}).
+			Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(),
+			repository.IncrementPasswordResetAttemptsInput{UserId: userOutput.Id, MaxAttempts: passwordResetMaxAttempts}).
+			Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().ResetUserPassword(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.ResetUserPasswordInput) error {
+				assert.Equal(t, userOutput.Id, input.UserId)
+				assert.Equal(t, codeHash, input.CodeHash)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(input.Password), []byte("NewPassword123!")))
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", oldToken))
+		_, err := sv.(*Server).retrieveAndGetIdFromJWTToken(e.NewContext(req, httptest.NewRecorder()))
+		assert.EqualError(t, err, "token has been revoked")
+	})
+
+	t.Run("logging in within the same second", func(t *testing.T) {
+		waitForNextSecond()
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().ResetUserPassword(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+
+		// The access token issued by the login with the new password is accepted
+		rec = loginAndGetUserProfile(t, sv, e, mockRepository, userOutput.Id)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/password/reset/confirm", strings.NewReader(`{perkedel}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid password rule", func(t *testing.T) {
+		rec, c := newRequest("123456", "weakpassword")
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "password criteria")
+		}
+	})
+
+	t.Run("unknown phone number", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("no pending password reset", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).
+			Return(repository.GetPasswordResetOutput{}, common.ErrPasswordResetNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("code expired", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		expiredOutput := passwordResetOutput
+		expiredOutput.ExpiresAt = time.Now().Add(-time.Second)
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(expiredOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).
+			Return(common.ErrPasswordResetAttemptsExceeded).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		rec, c := newRequest("654321", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("password contains the name", func(t *testing.T) {
+		rec, c := newRequest("123456", "Kurumi-2024!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Password must not contain your name or phone number.")
+		}
+	})
+
+	t.Run("password used recently", func(t *testing.T) {
+		rec, c := newRequest("123456", "OldPassword123!")
+		oldHash, _ := bcrypt.GenerateFromPassword([]byte("OldPassword123!"), bcrypt.DefaultCost)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash), string(oldHash))
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordReusedMessage)
+		}
+	})
+
+	t.Run("current password without history", func(t *testing.T) {
+		rec, c := newRequest("123456", "correctPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory()
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordReusedMessage)
+		}
+	})
+
+	t.Run("get password history returns error", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().GetPasswordHistory(gomock.Any(), passwordHistoryInput).
+			Return(repository.GetPasswordHistoryOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("code consumed concurrently", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().ResetUserPassword(gomock.Any(), gomock.Any()).Return(common.ErrPasswordResetNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), invalidPasswordResetCodeMessage)
+		}
+	})
+
+	t.Run("generate hash from password returning error", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = failingPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("reset user password returns error", func(t *testing.T) {
+		rec, c := newRequest("123456", "NewPassword123!")
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordReset(gomock.Any(), gomock.Any()).Return(passwordResetOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPasswordResetAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().ResetUserPassword(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPasswordResetConfirm(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserLogout(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId    = uuid.New()
+		sessionId = uuid.New()
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		generatedToken := generateNewTokenWithClaims(userId.String(), "key", uuid.New().String(), sessionId.String())
+		req := httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(),
+			repository.RevokeRefreshTokenFamilyInput{FamilyId: sessionId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserLogout(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+
+		// The same token must be rejected afterwards
+		req = httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserLogout(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+
+		// And so must the other tokens issued within the session
+		otherToken := generateNewTokenWithClaims(userId.String(), "key", uuid.New().String(), sessionId.String())
+		req = httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", otherToken))
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserLogout(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("revoke refresh token family returns error", func(t *testing.T) {
+		generatedToken := generateNewTokenWithClaims(userId.String(), "key", uuid.New().String(), uuid.New().String())
+		req := httptest.NewRequest(http.MethodPost, "/user/logout", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeRefreshTokenFamily(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogout(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserLogoutAll(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		otherToken := generateNewTokenIssuedAt(userId.String(), "key", uuid.New().String(), uuid.New().String(),
+			time.Now().Add(-time.Second))
+		req := httptest.NewRequest(http.MethodPost, "/user/logout-all", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserRefreshTokens(gomock.Any(),
+			repository.RevokeUserRefreshTokensInput{UserId: userId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserLogoutAll(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+
+		// Any other token issued before must be rejected as well
+		req = httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", otherToken))
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("logging in again within the same second", func(t *testing.T) {
+		otherUserId := uuid.New()
+		generatedToken := generateNewTokenIssuedAt(otherUserId.String(), "key", uuid.New().String(), uuid.New().String(),
+			time.Now().Add(-time.Second))
+
+		waitForNextSecond()
+		req := httptest.NewRequest(http.MethodPost, "/user/logout-all", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserRefreshTokens(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserLogoutAll(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+
+		// The access token issued by the new login is accepted
+		rec = loginAndGetUserProfile(t, sv, e, mockRepository, otherUserId)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/logout-all", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserLogoutAll(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("revoke user refresh tokens returns error", func(t *testing.T) {
+		otherUserId := uuid.New()
+		generatedToken := generateNewToken(otherUserId.String(), "key")
+		req := httptest.NewRequest(http.MethodPost, "/user/logout-all", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserRefreshTokens(gomock.Any(),
+			repository.RevokeUserRefreshTokensInput{UserId: otherUserId}).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserLogoutAll(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestGetUserSessions(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId         = uuid.New()
+		currentSession = repository.UserSession{
+			Id:         uuid.New(),
+			UserAgent:  "okhttp/4.12.0",
+			IpAddress:  "203.0.113.7",
+			CreatedAt:  time.Now().Add(-time.Hour).UTC(),
+			LastSeenAt: time.Now().UTC(),
+		}
+		otherSession = repository.UserSession{
+			Id:         uuid.New(),
+			UserAgent:  "Mozilla/5.0",
+			IpAddress:  "198.51.100.23",
+			CreatedAt:  time.Now().Add(-48 * time.Hour).UTC(),
+			LastSeenAt: time.Now().Add(-24 * time.Hour).UTC(),
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		generatedToken := generateNewTokenWithClaims(userId.String(), "key", uuid.New().String(), currentSession.Id.String())
+		req := httptest.NewRequest(http.MethodGet, "/user/sessions", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().ListUserSessions(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.ListUserSessionsInput) (repository.ListUserSessionsOutput, error) {
+				assert.Equal(t, userId, input.UserId)
+				assert.WithinDuration(t, time.Now().Add(-sv.(*Server).RefreshTokenTTL), input.LastSeenAfter, time.Minute)
+				return repository.ListUserSessionsOutput{Sessions: []repository.UserSession{currentSession, otherSession}}, nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.GetUserSessions(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp generated.GetUserSessionsResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, []generated.UserSession{
+				{
+					Id:         currentSession.Id.String(),
+					UserAgent:  currentSession.UserAgent,
+					IpAddress:  currentSession.IpAddress,
+					CreatedAt:  currentSession.CreatedAt,
+					LastSeenAt: currentSession.LastSeenAt,
+					Current:    true,
+				},
+				{
+					Id:         otherSession.Id.String(),
+					UserAgent:  otherSession.UserAgent,
+					IpAddress:  otherSession.IpAddress,
+					CreatedAt:  otherSession.CreatedAt,
+					LastSeenAt: otherSession.LastSeenAt,
+					Current:    false,
+				},
+			}, resp.Sessions)
+		}
+	})
+
+	t.Run("no sessions", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodGet, "/user/sessions", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().ListUserSessions(gomock.Any(), gomock.Any()).
+			Return(repository.ListUserSessionsOutput{}, nil).Times(1)
+
+		if assert.NoError(t, sv.GetUserSessions(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"sessions": []}`, rec.Body.String())
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/user/sessions", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserSessions(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("list user sessions returns error", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodGet, "/user/sessions", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().ListUserSessions(gomock.Any(), gomock.Any()).
+			Return(repository.ListUserSessionsOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.GetUserSessions(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestDeleteUserSession(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		sessionId := uuid.New()
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/"+sessionId.String(), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserSession(gomock.Any(),
+			repository.RevokeUserSessionInput{Id: sessionId, UserId: userId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.DeleteUserSession(c, sessionId)) {
+			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Empty(t, rec.Body.String())
+		}
+
+		// The access tokens of the revoked session must be rejected afterwards
+		revokedToken := generateNewTokenWithClaims(userId.String(), "key", uuid.New().String(), sessionId.String())
+		req = httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", revokedToken))
+		rec = httptest.NewRecorder()
+		c = e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		}
+	})
+
+	t.Run("session not found", func(t *testing.T) {
+		sessionId := uuid.New()
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/"+sessionId.String(), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserSession(gomock.Any(), gomock.Any()).Return(common.ErrSessionNotFound).Times(1)
+
+		if assert.NoError(t, sv.DeleteUserSession(c, sessionId)) {
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Contains(t, rec.Body.String(), common.ErrSessionNotFound.Error())
+		}
+	})
+
+	t.Run("invalid session id", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/perkedel", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/"+uuid.New().String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.DeleteUserSession(c, uuid.New())) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("revoke user session returns error", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodDelete, "/user/sessions/"+uuid.New().String(), nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().RevokeUserSession(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.DeleteUserSession(c, uuid.New())) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestGetUserLoginHistory(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+		events = []repository.LoginEvent{
+			{Id: 42, Successful: true, Reason: loginReasonPassword, IpAddress: "203.0.113.7", UserAgent: "okhttp/4.12.0",
+				CreatedAt: time.Now().UTC()},
+			{Id: 41, Successful: false, Reason: loginReasonWrongPassword, IpAddress: "198.51.100.23", UserAgent: "curl/8.4.0",
+				CreatedAt: time.Now().Add(-time.Minute).UTC()},
+			{Id: 40, Successful: false, Reason: loginReasonLocked, IpAddress: "198.51.100.23", UserAgent: "curl/8.4.0",
+				CreatedAt: time.Now().Add(-time.Hour).UTC()},
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	newRequest := func(token string) (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodGet, "/user/login-history", nil)
+		if token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	intPointer := func(i int) *int { return &i }
+	int64Pointer := func(i int64) *int64 { return &i }
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest(generateNewToken(userId.String(), "key"))
+
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(),
+			repository.ListLoginEventsInput{UserId: userId, Limit: defaultLoginHistoryLimit + 1}).
+			Return(repository.ListLoginEventsOutput{Events: events}, nil).Times(1)
+
+		if assert.NoError(t, sv.GetUserLoginHistory(c, generated.GetUserLoginHistoryParams{})) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp generated.GetUserLoginHistoryResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Nil(t, resp.NextBefore)
+			assert.Len(t, resp.Events, len(events))
+			assert.Equal(t, generated.LoginEvent{
+				Id:         events[1].Id,
+				Successful: false,
+				Reason:     loginReasonWrongPassword,
+				IpAddress:  events[1].IpAddress,
+				UserAgent:  events[1].UserAgent,
+				CreatedAt:  events[1].CreatedAt,
+			}, resp.Events[1])
+		}
+	})
+
+	t.Run("more events than the limit", func(t *testing.T) {
+		rec, c := newRequest(generateNewToken(userId.String(), "key"))
+		params := generated.GetUserLoginHistoryParams{Limit: intPointer(2), Before: int64Pointer(43)}
+
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(),
+			repository.ListLoginEventsInput{UserId: userId, BeforeId: 43, Limit: 3}).
+			Return(repository.ListLoginEventsOutput{Events: events}, nil).Times(1)
+
+		if assert.NoError(t, sv.GetUserLoginHistory(c, params)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var resp generated.GetUserLoginHistoryResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Len(t, resp.Events, 2)
+			if assert.NotNil(t, resp.NextBefore) {
+				assert.Equal(t, int64(41), *resp.NextBefore)
+			}
+		}
+	})
+
+	t.Run("query parameters are bound", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/user/login-history?limit=5&before=100", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(),
+			repository.ListLoginEventsInput{UserId: userId, BeforeId: 100, Limit: 6}).
+			Return(repository.ListLoginEventsOutput{}, nil).Times(1)
+
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"events": []}`, rec.Body.String())
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		for _, limit := range []int{0, maxLoginHistoryLimit + 1} {
+			rec, c := newRequest(generateNewToken(userId.String(), "key"))
+
+			if assert.NoError(t, sv.GetUserLoginHistory(c, generated.GetUserLoginHistoryParams{Limit: intPointer(limit)})) {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.NotEmpty(t, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("invalid before", func(t *testing.T) {
+		rec, c := newRequest(generateNewToken(userId.String(), "key"))
+
+		if assert.NoError(t, sv.GetUserLoginHistory(c, generated.GetUserLoginHistoryParams{Before: int64Pointer(-1)})) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		rec, c := newRequest("")
+
+		if assert.NoError(t, sv.GetUserLoginHistory(c, generated.GetUserLoginHistoryParams{})) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("list login events returns error", func(t *testing.T) {
+		rec, c := newRequest(generateNewToken(userId.String(), "key"))
+
+		mockRepository.EXPECT().ListLoginEvents(gomock.Any(), gomock.Any()).
+			Return(repository.ListLoginEventsOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.GetUserLoginHistory(c, generated.GetUserLoginHistoryParams{})) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserMfaTotpEnroll(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+
+		userOutput = repository.GetUserByIdOutput{
+			Id:          userId,
+			Name:        "Kurumi Ruru",
+			PhoneNumber: "+62123456789",
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/enroll", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		var upsertInput repository.UpsertUserMFAInput
+		mockRepository.EXPECT().GetUserById(gomock.Any(), repository.GetUserByIdInput{Id: userId.String()}).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertUserMFA(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpsertUserMFAInput) error {
+				upsertInput = input
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpEnroll(c)) {
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			var resp generated.UserMFATotpEnrollResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Contains(t, resp.ProvisioningUri, "otpauth://totp/")
+			assert.Len(t, resp.RecoveryCodes, recoveryCodeCount)
+
+			// Only the encrypted secret and the hashes of the recovery codes are stored
+			assert.Equal(t, userId, upsertInput.UserId)
+			assert.NotContains(t, upsertInput.EncryptedSecret, resp.Secret)
+			assert.Equal(t, hashRecoveryCode(resp.RecoveryCodes[0]), upsertInput.RecoveryCodeHashes[0])
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/enroll", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserMfaTotpEnroll(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/enroll", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertUserMFA(gomock.Any(), gomock.Any()).Return(common.ErrMFAAlreadyEnabled).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpEnroll(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("get user by id not found", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/enroll", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserByIdOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpEnroll(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("upsert user mfa returns error", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/enroll", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertUserMFA(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpEnroll(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserMfaTotpConfirm(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+		secret = []byte("12345678901234567890")
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	encryptedSecret, _ := sv.(*Server).encryptMFASecret(userId, secret)
+	pendingMFAOutput := repository.GetUserMFAOutput{UserId: userId, EncryptedSecret: encryptedSecret}
+
+	newRequest := func(code string) (*httptest.ResponseRecorder, echo.Context) {
+		reqBody := fmt.Sprintf(`{"code": "%s"}`, code)
+		req := httptest.NewRequest(http.MethodPost, "/user/mfa/totp/confirm", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		now := time.Now()
+		rec, c := newRequest(totp.Code(secret, now))
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userId}).Return(pendingMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().ConfirmUserMFA(gomock.Any(),
+			repository.ConfirmUserMFAInput{UserId: userId, Step: totp.Step(now)}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		rec, c := newRequest("")
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		rec, c := newRequest("abcd-efgh-ijkl-mnop")
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(pendingMFAOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("not enrolled", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("already confirmed", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		confirmedMFAOutput := pendingMFAOutput
+		confirmedMFAOutput.ConfirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(confirmedMFAOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("confirm user mfa returns error", func(t *testing.T) {
+		rec, c := newRequest(totp.Code(secret, time.Now()))
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(pendingMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().ConfirmUserMFA(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpConfirm(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserMfaTotpDisable(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+		secret = []byte("12345678901234567890")
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	encryptedSecret, _ := sv.(*Server).encryptMFASecret(userId, secret)
+	userMFAOutput := repository.GetUserMFAOutput{
+		UserId:          userId,
+		EncryptedSecret: encryptedSecret,
+		ConfirmedAt:     sql.NullTime{Time: time.Now(), Valid: true},
+	}
+
+	newRequest := func(code string) (*httptest.ResponseRecorder, echo.Context) {
+		reqBody := fmt.Sprintf(`{"code": "%s"}`, code)
+		req := httptest.NewRequest(http.MethodDelete, "/user/mfa/totp", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest(totp.Code(secret, time.Now()))
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), repository.GetUserMFAInput{UserId: userId}).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserMFALastUsedStep(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().DeleteUserMFA(gomock.Any(), repository.DeleteUserMFAInput{UserId: userId}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("pending enrollment doesn't need a code", func(t *testing.T) {
+		rec, c := newRequest("")
+
+		pendingMFAOutput := userMFAOutput
+		pendingMFAOutput.ConfirmedAt = sql.NullTime{}
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(pendingMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().DeleteUserMFA(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/user/mfa/totp", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		rec, c := newRequest("000000")
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UseMFARecoveryCode(gomock.Any(), gomock.Any()).Return(common.ErrMFARecoveryCodeNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("not enrolled", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserMFAOutput{}, common.ErrMFANotFound).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("delete user mfa returns error", func(t *testing.T) {
+		rec, c := newRequest(totp.Code(secret, time.Now()))
+
+		mockRepository.EXPECT().GetUserMFA(gomock.Any(), gomock.Any()).Return(userMFAOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUserMFALastUsedStep(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().DeleteUserMFA(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserMfaTotpDisable(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserPhoneVerifyRequest(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+
+		userOutput = repository.GetUserByIdOutput{
+			Id:          userId,
+			Name:        "Kurumi Ruru",
+			PhoneNumber: "+62123456789",
+		}
+
+		outbox bytes.Buffer
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+	sv.(*Server).SMSSender = sms.NewWriterSender(&outbox)
+
+	newRequest := func() (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodPost, "/user/phone/verify/request", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest()
+		outbox.Reset()
+
+		var upsertInput repository.UpsertPhoneVerificationInput
+		mockRepository.EXPECT().GetUserById(gomock.Any(), repository.GetUserByIdInput{Id: userId.String()}).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpsertPhoneVerificationInput) error {
+				upsertInput = input
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+			assert.Contains(t, rec.Body.String(), "resend_in")
+
+			// The code is sent to the user, while only its hash is stored
+			code := regexp.MustCompile(`code is (\d{6})`).FindStringSubmatch(outbox.String())
+			if assert.Len(t, code, 2) {
+				assert.Contains(t, outbox.String(), userOutput.PhoneNumber)
+				assert.Equal(t, hashVerificationCode(testCodeHashKey, userId, userOutput.PhoneNumber, code[1]), upsertInput.CodeHash)
+			}
+
+			assert.Equal(t, phoneVerificationResendCooldown, upsertInput.SentAt.Sub(upsertInput.LastSentBefore))
+			assert.Equal(t, phoneVerificationCodeTTL, upsertInput.ExpiresAt.Sub(upsertInput.SentAt))
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/phone/verify/request", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("already verified", func(t *testing.T) {
+		rec, c := newRequest()
+
+		verifiedUserOutput := userOutput
+		verifiedUserOutput.PhoneVerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(verifiedUserOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("sent too recently", func(t *testing.T) {
+		rec, c := newRequest()
+		outbox.Reset()
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).Return(common.ErrPhoneVerificationCooldown).Times(1)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), repository.GetPhoneVerificationInput{UserId: userId}).
+			Return(repository.GetPhoneVerificationOutput{SentAt: time.Now().Add(-20 * time.Second)}, nil).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.Contains(t, []string{"40", "41"}, rec.Header().Get("Retry-After"))
+			assert.Empty(t, outbox.String())
+		}
+	})
+
+	t.Run("get user by id not found", func(t *testing.T) {
+		rec, c := newRequest()
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).
+			Return(repository.GetUserByIdOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("generate code returns error", func(t *testing.T) {
+		rec, c := newRequest()
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+
+		// patch
+		tempFunc := RandRead
+		RandRead = func(b []byte) (n int, err error) {
+			return 0, errors.New("error")
+		}
+		defer func() { RandRead = tempFunc }()
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("upsert phone verification returns error", func(t *testing.T) {
+		rec, c := newRequest()
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpsertPhoneVerification(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyRequest(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUserPhoneVerifyConfirm(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId = uuid.New()
+
+		verificationOutput = repository.GetPhoneVerificationOutput{
+			UserId:      userId,
+			PhoneNumber: "+62123456789",
+			CodeHash:    hashVerificationCode(testCodeHashKey, userId, "+62123456789", "123456"),
+			ExpiresAt:   time.Now().Add(5 * time.Minute),
+			SentAt:      time.Now(),
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	newRequest := func(code string) (*httptest.ResponseRecorder, echo.Context) {
+		reqBody := fmt.Sprintf(`{"code": "%s"}`, code)
+		req := httptest.NewRequest(http.MethodPost, "/user/phone/verify/confirm", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), repository.GetPhoneVerificationInput{UserId: userId}).
+			Return(verificationOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(),
+			repository.IncrementPhoneVerificationAttemptsInput{UserId: userId, MaxAttempts: phoneVerificationMaxAttempts}).
+			Return(nil).Times(1)
+		mockRepository.EXPECT().VerifyUserPhone(gomock.Any(),
+			repository.VerifyUserPhoneInput{UserId: userId, PhoneNumber: verificationOutput.PhoneNumber}).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("field validation failed", func(t *testing.T) {
+		rec, c := newRequest("")
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("no pending verification", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).
+			Return(repository.GetPhoneVerificationOutput{}, common.ErrPhoneVerificationNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("code expired", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		expiredOutput := verificationOutput
+		expiredOutput.ExpiresAt = time.Now().Add(-time.Second)
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(expiredOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "expired")
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verificationOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).
+			Return(common.ErrPhoneVerificationAttemptsExceeded).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		rec, c := newRequest("654321")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verificationOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "invalid code")
+		}
+	})
+
+	t.Run("phone number changed", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verificationOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().VerifyUserPhone(gomock.Any(), gomock.Any()).Return(common.ErrPhoneVerificationNotFound).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("verify user phone returns error", func(t *testing.T) {
+		rec, c := newRequest("123456")
+
+		mockRepository.EXPECT().GetPhoneVerification(gomock.Any(), gomock.Any()).Return(verificationOutput, nil).Times(1)
+		mockRepository.EXPECT().IncrementPhoneVerificationAttempts(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockRepository.EXPECT().VerifyUserPhone(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UserPhoneVerifyConfirm(c)) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -390,24 +3536,44 @@ func TestGetUserProfile(t *testing.T) {
 			Id:          userId,
 			Name:        "Kurumi Ruru",
 			PhoneNumber: "628788889999",
+			Version:     4,
+		}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("all ok", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+			assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
 		}
-	)
-
-	sv, e, wg := initializeTestEchoServer(mockRepository)
+	})
 
-	t.Run("all ok", func(t *testing.T) {
+	t.Run("phone number verified", func(t *testing.T) {
 		generatedToken := generateNewToken(userId.String(), "key")
 		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		verifiedUserOutput := userOutput
+		verifiedUserOutput.PhoneVerifiedAt = sql.NullTime{Time: time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), Valid: true}
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(verifiedUserOutput, nil).Times(1)
 
 		if assert.NoError(t, sv.GetUserProfile(c)) {
 			assert.Equal(t, http.StatusOK, rec.Code)
-			assert.NotEmpty(t, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), `"phone_verified":true`)
+			assert.Contains(t, rec.Body.String(), `"phone_verified_at":"2024-01-02T15:04:05Z"`)
 		}
 	})
 
@@ -449,6 +3615,42 @@ func TestGetUserProfile(t *testing.T) {
 		}
 	})
 
+	t.Run("token without jti claim", func(t *testing.T) {
+		claims := &jwt.MapClaims{
+			"id":  userId.String(),
+			"exp": jwt.NewNumericDate(time.Now().Add(2 * time.Minute)),
+		}
+		generatedToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("key"))
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		tokenId := uuid.New().String()
+		generatedToken := generateNewTokenWithClaims(userId.String(), "key", tokenId, uuid.New().String())
+		_ = sv.(*Server).RevocationStore.RevokeToken(context.Background(),
+			revocation.RevokeTokenInput{TokenId: tokenId, ExpiresAt: time.Now().Add(time.Minute)})
+
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Contains(t, rec.Body.String(), "revoked")
+		}
+	})
+
 	t.Run("get user by id not found", func(t *testing.T) {
 		generatedToken := generateNewToken(userId.String(), "key")
 		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
@@ -499,6 +3701,7 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userId,
 			Name:        "Kurumi Ruru",
 			PhoneNumber: "628788889999",
+			Version:     4,
 		}
 	)
 
@@ -517,6 +3720,7 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userOutput.Id.String(),
 			Name:        "Mirapa Ruru",
 			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
 		}
 
 		userPhoneInput := repository.GetUserByPhoneNumberInput{
@@ -527,9 +3731,109 @@ func TestUpdateUserProfile(t *testing.T) {
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userPhoneInput).Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
 		mockRepository.EXPECT().UpdateUser(gomock.Any(), updateUserInput).Return(nil).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusOK, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
+			assert.Equal(t, `"5"`, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("if-match matches the current version", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		updateUserInput := repository.UpdateUserInput{
+			Id:          userOutput.Id.String(),
+			Name:        "Mirapa Ruru",
+			PhoneNumber: userOutput.PhoneNumber,
+			Version:     userOutput.Version,
+		}
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUser(gomock.Any(), updateUserInput).Return(nil).Times(1)
+
+		ifMatch := `"3", "4"`
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{IfMatch: &ifMatch})) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, `"5"`, rec.Header().Get("ETag"))
+		}
+	})
+
+	t.Run("if-match doesn't match the current version", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		ifMatch := `"3"`
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{IfMatch: &ifMatch})) {
+			assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+			assert.Contains(t, rec.Body.String(), common.ErrUserVersionMismatch.Error())
+		}
+	})
+
+	t.Run("if-match with a weak tag", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		// If-Match uses the strong comparison
+		ifMatch := `W/"4"`
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{IfMatch: &ifMatch})) {
+			assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		}
+	})
+
+	t.Run("profile changed concurrently", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(common.ErrUserVersionMismatch).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.Contains(t, rec.Body.String(), common.ErrUserVersionMismatch.Error())
+		}
+	})
+
+	t.Run("profile changed concurrently after if-match", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(common.ErrUserVersionMismatch).Times(1)
+
+		ifMatch := "*"
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{IfMatch: &ifMatch})) {
+			assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+			assert.Contains(t, rec.Body.String(), common.ErrUserVersionMismatch.Error())
 		}
 	})
 
@@ -540,7 +3844,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusForbidden, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -554,7 +3858,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusForbidden, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -569,7 +3873,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusBadRequest, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -584,7 +3888,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusBadRequest, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -601,7 +3905,7 @@ func TestUpdateUserProfile(t *testing.T) {
 
 		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, common.ErrUserNotFound).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusForbidden, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -618,7 +3922,7 @@ func TestUpdateUserProfile(t *testing.T) {
 
 		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, errors.New("error")).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -637,18 +3941,21 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userOutput.Id.String(),
 			Name:        "Mirapa Ruru",
 			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
 		}
 
 		noChangesUserOutput := repository.GetUserByIdOutput{
 			Id:          userId,
 			Name:        updateUserInput.Name,
 			PhoneNumber: updateUserInput.PhoneNumber,
+			Version:     userOutput.Version,
 		}
 
 		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(noChangesUserOutput, nil).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusNoContent, rec.Code)
+			assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
 		}
 	})
 
@@ -665,6 +3972,7 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userOutput.Id.String(),
 			Name:        "Mirapa Ruru",
 			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
 		}
 
 		userPhoneInput := repository.GetUserByPhoneNumberInput{
@@ -674,7 +3982,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userPhoneInput).Return(repository.GetUserByPhoneNumberOutput{}, errors.New("error")).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -693,6 +4001,7 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userOutput.Id.String(),
 			Name:        "Mirapa Ruru",
 			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
 		}
 
 		userPhoneInput := repository.GetUserByPhoneNumberInput{
@@ -702,7 +4011,7 @@ func TestUpdateUserProfile(t *testing.T) {
 		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userPhoneInput).Return(repository.GetUserByPhoneNumberOutput{Name: "Haga Uruna"}, nil).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
 			assert.Equal(t, http.StatusConflict, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
@@ -721,6 +4030,7 @@ func TestUpdateUserProfile(t *testing.T) {
 			Id:          userOutput.Id.String(),
 			Name:        "Mirapa Ruru",
 			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
 		}
 
 		userPhoneInput := repository.GetUserByPhoneNumberInput{
@@ -731,7 +4041,251 @@ func TestUpdateUserProfile(t *testing.T) {
 		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userPhoneInput).Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
 		mockRepository.EXPECT().UpdateUser(gomock.Any(), updateUserInput).Return(errors.New("error")).Times(1)
 
-		if assert.NoError(t, sv.UpdateUserProfile(c)) {
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("phone number taken concurrently", func(t *testing.T) {
+		generatedToken := generateNewToken(userId.String(), "key")
+		reqBody := `{"full_name": "Mirapa Ruru", "phone_number": "+6212345678219"}`
+		req := httptest.NewRequest(http.MethodPatch, "/user/profile", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generatedToken))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		updateUserInput := repository.UpdateUserInput{
+			Id:          userOutput.Id.String(),
+			Name:        "Mirapa Ruru",
+			PhoneNumber: "+6212345678219",
+			Version:     userOutput.Version,
+		}
+
+		userPhoneInput := repository.GetUserByPhoneNumberInput{
+			PhoneNumber: updateUserInput.PhoneNumber,
+		}
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), userPhoneInput).Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound).Times(1)
+		mockRepository.EXPECT().UpdateUser(gomock.Any(), updateUserInput).
+			Return(&common.UniqueViolationError{Constraint: "phone_number_key"}).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserProfile(c, generated.UpdateUserProfileParams{})) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.Contains(t, rec.Body.String(), "phone number exists")
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestUpdateUserPassword(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		knownHash, _ = bcrypt.GenerateFromPassword([]byte("correctPassword123!"), bcrypt.DefaultCost)
+
+		userId    = uuid.New()
+		userInput = repository.GetUserByIdInput{
+			Id: userId.String(),
+		}
+
+		userOutput = repository.GetUserByIdOutput{
+			Id:          userId,
+			Name:        "Kurumi Ruru",
+			PhoneNumber: "+62123456789",
+			Password:    string(knownHash),
+		}
+
+		passwordHistoryInput = repository.GetPasswordHistoryInput{UserId: userId}
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	expectPasswordHistory := func(passwordHashes ...string) {
+		mockRepository.EXPECT().GetPasswordHistory(gomock.Any(), passwordHistoryInput).
+			Return(repository.GetPasswordHistoryOutput{PasswordHashes: passwordHashes}, nil).Times(1)
+	}
+
+	newRequest := func(reqBody string) (*httptest.ResponseRecorder, echo.Context) {
+		req := httptest.NewRequest(http.MethodPut, "/user/password", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", generateNewToken(userId.String(), "key")))
+		rec := httptest.NewRecorder()
+		return rec, e.NewContext(req, rec)
+	}
+
+	t.Run("all ok", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, input repository.UpdateUserPasswordInput) error {
+				assert.Equal(t, userId.String(), input.Id)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(input.Password), []byte("NewPassword123!")))
+				return nil
+			}).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("empty token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/user/password", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.JSONEq(t, `{"message": "missing JWT token"}`, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid request body", func(t *testing.T) {
+		rec, c := newRequest(`{perkedel}`)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("invalid password rule", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "weakpassword"}`)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "password criteria")
+		}
+	})
+
+	t.Run("get user by id not found", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).
+			Return(repository.GetUserByIdOutput{}, common.ErrUserNotFound).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.JSONEq(t, `{"message": "user not found"}`, rec.Body.String())
+		}
+	})
+
+	t.Run("mismatched current password", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "wrongPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Mismatched current password")
+		}
+	})
+
+	t.Run("reused current password", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "correctPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "must be different")
+		}
+	})
+
+	t.Run("new password contains the phone number", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "Quokka!123456789"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "Password must not contain your name or phone number.")
+		}
+	})
+
+	t.Run("common new password", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "Sunshine1!"}`)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "NewPassword is too common")
+		}
+	})
+
+	t.Run("new password used recently", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "OldPassword123!"}`)
+		oldHash, _ := bcrypt.GenerateFromPassword([]byte("OldPassword123!"), bcrypt.DefaultCost)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		expectPasswordHistory(string(knownHash), string(oldHash))
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), passwordReusedMessage)
+		}
+	})
+
+	t.Run("get password history returns error", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		mockRepository.EXPECT().GetPasswordHistory(gomock.Any(), passwordHistoryInput).
+			Return(repository.GetPasswordHistoryOutput{}, errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("too many passwords being hashed", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = busyPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("generate hash from password returning error", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+
+		// patch the password hasher
+		tempHasher := sv.(*Server).PasswordHasher
+		sv.(*Server).PasswordHasher = failingPasswordHasher{PasswordHasher: tempHasher}
+		defer func() { sv.(*Server).PasswordHasher = tempHasher }()
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.NotEmpty(t, rec.Body.String())
+		}
+	})
+
+	t.Run("update user password returns error", func(t *testing.T) {
+		rec, c := newRequest(`{"current_password": "correctPassword123!", "new_password": "NewPassword123!"}`)
+
+		mockRepository.EXPECT().GetUserById(gomock.Any(), userInput).Return(userOutput, nil).Times(1)
+		expectPasswordHistory(string(knownHash))
+		mockRepository.EXPECT().UpdateUserPassword(gomock.Any(), gomock.Any()).Return(errors.New("error")).Times(1)
+
+		if assert.NoError(t, sv.UpdateUserPassword(c)) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			assert.NotEmpty(t, rec.Body.String())
 		}
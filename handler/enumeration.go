@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/sms"
+)
+
+const (
+	// Same response whether the phone number is unknown or the password is wrong, in enumeration-safe mode
+	invalidCredentialsMessage = "Invalid phone number or password"
+
+	// Same response whether the phone number was free or already registered, in enumeration-safe mode
+	registrationAcceptedMessage = "Registration received, check your phone for the next steps"
+
+	registrationAttemptMessage = "Someone tried to register an account with this phone number. " +
+		"If it was you, log in or reset your password instead."
+)
+
+// compareDummyPassword spends as long as the password check of an existing user,
+// so the response time doesn't tell whether the phone number is registered
+func (s *Server) compareDummyPassword(ctx context.Context, password string) error {
+	s.dummyPasswordHashMu.Lock()
+	if s.dummyPasswordHash == "" {
+		// Made on first use, with whatever the hasher is configured for
+		dummyPasswordHash, err := s.PasswordHasher.Hash(ctx, "not the password of anyone")
+		if err != nil {
+			s.dummyPasswordHashMu.Unlock()
+			return err
+		}
+
+		s.dummyPasswordHash = dummyPasswordHash
+	}
+
+	dummyPasswordHash := s.dummyPasswordHash
+	s.dummyPasswordHashMu.Unlock()
+
+	err := s.PasswordHasher.Compare(ctx, dummyPasswordHash, password)
+	if err == hasher.ErrMismatchedHashAndPassword {
+		return nil
+	}
+
+	return err
+}
+
+// verifyPhoneOnLogin verifies the phone number of the account with the code sent by SMS, which the login has to carry
+// until then in enumeration-safe mode. Without a pending code, e.g. expired or for an account registered before,
+// a new one is sent, the cooldown keeping from flooding the phone number.
+func (s *Server) verifyPhoneOnLogin(ctx echo.Context, userId uuid.UUID, phoneNumber string, code *string) (bool, error) {
+	standardCtx := ctx.Request().Context()
+
+	if code != nil && *code != "" {
+		_, err := s.confirmPhoneVerification(standardCtx, userId, *code)
+		switch err {
+		case nil:
+			return true, nil
+		case errInvalidVerificationCode, common.ErrPhoneVerificationAttemptsExceeded:
+			return false, nil
+		case common.ErrPhoneVerificationNotFound, errVerificationCodeExpired:
+		default:
+			return false, err
+		}
+	}
+
+	// Delivery failures are only logged, the response is the same either way
+	err := s.sendPhoneVerificationCode(standardCtx, userId, phoneNumber)
+	if err != nil && err != common.ErrPhoneVerificationCooldown {
+		ctx.Logger().Errorf("sendPhoneVerificationCode error: %s", err.Error())
+	}
+
+	return false, nil
+}
+
+// notifyRegistrationAttempt lets the owner of an already registered phone number know someone tried to register it.
+// They're the only one learning the number is registered.
+func (s *Server) notifyRegistrationAttempt(ctx context.Context, phoneNumber string) error {
+	sendSMSInput := sms.SendSMSInput{
+		PhoneNumber: phoneNumber,
+		Message:     registrationAttemptMessage,
+	}
+
+	return s.SMSSender.SendSMS(ctx, sendSMSInput)
+}
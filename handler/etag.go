@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// profileETag identifies the version of the user profile, as a strong entity tag
+func profileETag(version int32) string {
+	return strconv.Quote(strconv.Itoa(int(version)))
+}
+
+// etagMatches tells whether the If-Match header lists the entity tag. Weak tags never match, as If-Match
+// uses the strong comparison.
+func etagMatches(ifMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/generated"
+)
+
+const (
+	healthStatusOk      = "ok"
+	healthStatusFailing = "failing"
+
+	// How long every readiness check is given, a slow dependency is as good as a failing one
+	defaultReadinessTimeout = 2 * time.Second
+)
+
+// ReadinessCheck tells whether a dependency of the service is usable, returning why it isn't otherwise
+type ReadinessCheck func(ctx context.Context) error
+
+// GetHealthz : GET /healthz
+func (s *Server) GetHealthz(ctx echo.Context) error {
+	// Answering at all is enough, the dependencies are checked by the readiness
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	return ctx.JSON(http.StatusOK, generated.HealthResponse{
+		Status: healthStatusOk,
+		Checks: map[string]generated.HealthCheck{},
+	})
+}
+
+// GetReadyz : GET /readyz
+func (s *Server) GetReadyz(ctx echo.Context) error {
+	var (
+		resp = generated.HealthResponse{
+			Status: healthStatusOk,
+			Checks: map[string]generated.HealthCheck{},
+		}
+		checks = s.readinessChecks()
+		errs   = make([]error, len(checks))
+		names  = make([]string, 0, len(checks))
+	)
+
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Run the checks at the same time, so the slowest one bounds the response time
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx.Request().Context(), s.ReadinessTimeout)
+			defer cancel()
+			errs[i] = check(checkCtx)
+		}(i, checks[name])
+	}
+	wg.Wait()
+
+	for i, name := range names {
+		if errs[i] == nil {
+			resp.Checks[name] = generated.HealthCheck{Status: healthStatusOk}
+			continue
+		}
+
+		message := errs[i].Error()
+		ctx.Logger().Errorf("readiness check %s error: %s", name, message)
+		resp.Checks[name] = generated.HealthCheck{Status: healthStatusFailing, Error: &message}
+		resp.Status = healthStatusFailing
+	}
+
+	ctx.Response().Header().Set("Cache-Control", "no-store")
+	if resp.Status != healthStatusOk {
+		return ctx.JSON(http.StatusServiceUnavailable, resp)
+	}
+
+	return ctx.JSON(http.StatusOK, resp)
+}
+
+// readinessChecks adds the checks of the server itself to the configured ones
+func (s *Server) readinessChecks() map[string]ReadinessCheck {
+	checks := map[string]ReadinessCheck{
+		"database": func(ctx context.Context) error {
+			return s.Repository.Ping(ctx)
+		},
+		"signing_keys": func(_ context.Context) error {
+			if s.SigningKeys == nil && s.JWTSecretKey == "" {
+				return errors.New("no key to sign the access tokens with")
+			}
+
+			return nil
+		},
+	}
+
+	for name, check := range s.ReadinessChecks {
+		checks[name] = check
+	}
+
+	return checks
+}
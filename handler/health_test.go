@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+func TestGetHealthz(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+	)
+
+	sv, e, wg := initializeTestEchoServer(mockRepository)
+
+	t.Run("positive", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		// The dependencies aren't checked
+		if assert.NoError(t, sv.GetHealthz(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"status": "ok", "checks": {}}`, rec.Body.String())
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestGetReadyz(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+		ctx            = gomock.Any()
+	)
+
+	_, e, wg := initializeTestEchoServer(mockRepository)
+
+	newReadyzServer := func(checks map[string]ReadinessCheck) *Server {
+		return NewServer(NewServerOptions{
+			JWTSecretKey:     "key",
+			Repository:       mockRepository,
+			ReadinessChecks:  checks,
+			ReadinessTimeout: 50 * time.Millisecond,
+		})
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		server := newReadyzServer(map[string]ReadinessCheck{
+			"migrations": func(_ context.Context) error { return nil },
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().Ping(ctx).Return(nil)
+
+		if assert.NoError(t, server.GetReadyz(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{
+				"status": "ok",
+				"checks": {
+					"database": {"status": "ok"},
+					"migrations": {"status": "ok"},
+					"signing_keys": {"status": "ok"}
+				}
+			}`, rec.Body.String())
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		}
+	})
+
+	t.Run("database unreachable", func(t *testing.T) {
+		server := newReadyzServer(nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().Ping(ctx).Return(errors.New("error"))
+
+		if assert.NoError(t, server.GetReadyz(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.JSONEq(t, `{
+				"status": "failing",
+				"checks": {
+					"database": {"status": "failing", "error": "error"},
+					"signing_keys": {"status": "ok"}
+				}
+			}`, rec.Body.String())
+		}
+	})
+
+	t.Run("check times out", func(t *testing.T) {
+		server := newReadyzServer(map[string]ReadinessCheck{
+			"migrations": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().Ping(ctx).Return(nil)
+
+		if assert.NoError(t, server.GetReadyz(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.JSONEq(t, `{
+				"status": "failing",
+				"checks": {
+					"database": {"status": "ok"},
+					"migrations": {"status": "failing", "error": "context deadline exceeded"},
+					"signing_keys": {"status": "ok"}
+				}
+			}`, rec.Body.String())
+		}
+	})
+
+	t.Run("no signing keys", func(t *testing.T) {
+		server := NewServer(NewServerOptions{Repository: mockRepository})
+
+		req := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().Ping(ctx).Return(nil)
+
+		if assert.NoError(t, server.GetReadyz(c)) {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"signing_keys":{"error":"no key to sign the access tokens with","status":"failing"}`)
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+// BenchmarkGetUserProfileDuringLoginFlood measures the profile endpoint latency while logins with wrong
+// passwords hammer the server. Without the pool every login hashes at once and the profile requests queue
+// behind them for CPU; with it the latency should stay close to the one of an idle server.
+//
+//	go test ./handler -run '^$' -bench GetUserProfileDuringLoginFlood
+func BenchmarkGetUserProfileDuringLoginFlood(b *testing.B) {
+	passwordHasher, err := hasher.NewHasher(hasher.NewHasherOptions{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("idle", func(b *testing.B) {
+		benchmarkGetUserProfile(b, passwordHasher, 0)
+	})
+
+	b.Run("login flood without pool", func(b *testing.B) {
+		benchmarkGetUserProfile(b, passwordHasher, 4*runtime.GOMAXPROCS(0))
+	})
+
+	b.Run("login flood with pool", func(b *testing.B) {
+		benchmarkGetUserProfile(b, hasher.NewPool(passwordHasher, hasher.NewPoolOptions{}), 4*runtime.GOMAXPROCS(0))
+	})
+}
+
+func benchmarkGetUserProfile(b *testing.B, passwordHasher hasher.PasswordHasher, flooders int) {
+	var (
+		mockCtrl       = gomock.NewController(b)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+
+		userId       = uuid.New()
+		knownHash, _ = passwordHasher.Hash(context.Background(), "correctPassword123!")
+	)
+
+	mockRepository.EXPECT().GetUserByPhoneNumber(gomock.Any(), gomock.Any()).
+		Return(repository.GetUserByPhoneNumberOutput{Id: userId, Password: knownHash}, nil).AnyTimes()
+	mockRepository.EXPECT().RecordFailedLogin(gomock.Any(), gomock.Any()).
+		Return(repository.RecordFailedLoginOutput{NumOfFailedLogin: 1}, nil).AnyTimes()
+	mockRepository.EXPECT().InsertLoginEvent(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockRepository.EXPECT().GetUserById(gomock.Any(), gomock.Any()).
+		Return(repository.GetUserByIdOutput{Id: userId, Name: "Kurumi Ruru"}, nil).AnyTimes()
+
+	server := NewServer(NewServerOptions{
+		JWTSecretKey:   "key",
+		Repository:     mockRepository,
+		PasswordHasher: passwordHasher,
+
+		// Never lock the account out, every login has to check the password
+		LoginLockoutThreshold: 1 << 30,
+		LoginRetryDelay:       time.Nanosecond,
+	})
+	e := echo.New()
+
+	// Flood the server with logins until the benchmark is done
+	var (
+		stop = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+
+	for i := 0; i < flooders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				reqBody := `{"password": "wrongPassword123!", "phone_number": "+62123456789"}`
+				req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				_ = server.UserLogin(e.NewContext(req, httptest.NewRecorder()))
+			}
+		}()
+	}
+
+	// Give the flood time to saturate the CPU
+	if flooders > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	token := generateNewToken(userId.String(), "key")
+	latencies := make([]time.Duration, 0, b.N)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		rec := httptest.NewRecorder()
+
+		start := time.Now()
+		_ = server.GetUserProfile(e.NewContext(req, rec))
+		latencies = append(latencies, time.Since(start))
+
+		if rec.Code != http.StatusOK {
+			b.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	b.StopTimer()
+
+	close(stop)
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	b.ReportMetric(float64(latencies[len(latencies)/2].Microseconds()), "p50-µs")
+	b.ReportMetric(float64(latencies[len(latencies)*99/100].Microseconds()), "p99-µs")
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+// Reasons recorded in the login history, telling how a login succeeded or why it failed
+const (
+	loginReasonPassword        = "password"
+	loginReasonMFA             = "mfa"
+	loginReasonWrongPassword   = "wrong_password"
+	loginReasonLocked          = "locked"
+	loginReasonInvalidMFACode  = "invalid_mfa_code"
+	loginReasonPhoneUnverified = "phone_unverified"
+)
+
+// Page size of the login history, when not requested otherwise, and the largest one allowed
+const (
+	defaultLoginHistoryLimit = 20
+	maxLoginHistoryLimit     = 100
+)
+
+// recordLoginEvent counts the outcome of the login attempt and appends it to the user's login history.
+// Failures are only logged, the history is not worth failing the login for.
+func (s *Server) recordLoginEvent(ctx echo.Context, userId uuid.UUID, successful bool, reason string) {
+	if successful {
+		s.countLogin(loginOutcomeSuccess, reason)
+	} else {
+		s.countLogin(loginOutcomeFailure, reason)
+	}
+
+	insertLoginEventInput := repository.InsertLoginEventInput{
+		UserId:     userId,
+		Successful: successful,
+		Reason:     reason,
+		IpAddress:  ctx.RealIP(),
+		UserAgent:  ctx.Request().UserAgent(),
+	}
+
+	err := s.Repository.InsertLoginEvent(ctx.Request().Context(), insertLoginEventInput)
+	if err != nil {
+		ctx.Logger().Errorf("InsertLoginEvent error: %s", err.Error())
+	}
+}
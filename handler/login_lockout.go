@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	defaultLoginLockoutThreshold = 5
+	defaultLoginLockoutWindow    = 15 * time.Minute
+	defaultLoginLockoutDuration  = 15 * time.Minute
+	defaultLoginRetryDelay       = time.Second
+
+	accountLockedMessage        = "account is temporarily locked due to too many failed login attempts"
+	tooManyLoginAttemptsMessage = "too many failed login attempts, try again later"
+)
+
+// loginRetryDelay returns how long the account can't log in after its n-th consecutive failed attempt.
+// The first failure is free, the delay then doubles on every failure until the account is locked.
+func (s *Server) loginRetryDelay(numOfFailedLogin int32) time.Duration {
+	if numOfFailedLogin >= int32(s.LoginLockoutThreshold) {
+		return s.LoginLockoutDuration
+	}
+
+	if numOfFailedLogin < 2 {
+		return 0
+	}
+
+	delay := s.LoginRetryDelay << (numOfFailedLogin - 2)
+	if delay <= 0 || delay > s.LoginLockoutDuration {
+		delay = s.LoginLockoutDuration
+	}
+
+	return delay
+}
+
+// loginLockedUntil returns until when the user can't log in because of the previous failed attempts.
+// The zero time is returned when the user is free to try.
+func (s *Server) loginLockedUntil(numOfFailedLogin sql.NullInt32, lastFailedLoginAt sql.NullTime, now time.Time) time.Time {
+	if !numOfFailedLogin.Valid || !lastFailedLoginAt.Valid {
+		return time.Time{}
+	}
+
+	lockedUntil := lastFailedLoginAt.Time.Add(s.loginRetryDelay(numOfFailedLogin.Int32))
+	if !now.Before(lockedUntil) {
+		return time.Time{}
+	}
+
+	return lockedUntil
+}
+
+// isLoginLockedOut tells whether the failed attempts reached the threshold, as opposed to a progressive delay
+func (s *Server) isLoginLockedOut(numOfFailedLogin int32) bool {
+	return numOfFailedLogin >= int32(s.LoginLockoutThreshold)
+}
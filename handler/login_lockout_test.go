@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginRetryDelay(t *testing.T) {
+	server := NewServer(NewServerOptions{})
+
+	expectedDelays := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 15 * time.Minute, 15 * time.Minute}
+	for numOfFailedLogin, expectedDelay := range expectedDelays {
+		assert.Equal(t, expectedDelay, server.loginRetryDelay(int32(numOfFailedLogin)), numOfFailedLogin)
+	}
+
+	t.Run("delay never exceeds the lockout", func(t *testing.T) {
+		server := NewServer(NewServerOptions{LoginLockoutThreshold: 100, LoginLockoutDuration: time.Minute})
+		assert.Equal(t, time.Minute, server.loginRetryDelay(20))
+		assert.Equal(t, time.Minute, server.loginRetryDelay(80))
+		assert.False(t, server.isLoginLockedOut(80))
+	})
+}
+
+func TestLoginLockedUntil(t *testing.T) {
+	var (
+		server = NewServer(NewServerOptions{})
+		now    = time.Now()
+	)
+
+	t.Run("no failed login", func(t *testing.T) {
+		assert.True(t, server.loginLockedUntil(sql.NullInt32{}, sql.NullTime{}, now).IsZero())
+	})
+
+	t.Run("locked out", func(t *testing.T) {
+		lastFailedLoginAt := now.Add(-time.Minute)
+		numOfFailedLogin := sql.NullInt32{Int32: 5, Valid: true}
+		lastFailedLogin := sql.NullTime{Time: lastFailedLoginAt, Valid: true}
+
+		assert.Equal(t, lastFailedLoginAt.Add(15*time.Minute), server.loginLockedUntil(numOfFailedLogin, lastFailedLogin, now))
+		assert.True(t, server.loginLockedUntil(numOfFailedLogin, lastFailedLogin, lastFailedLoginAt.Add(15*time.Minute)).IsZero())
+	})
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// Outcomes of the login attempts, along with the reasons of the login history
+const (
+	loginOutcomeSuccess      = "success"
+	loginOutcomeFailure      = "failure"
+	loginOutcomeMFAChallenge = "mfa_challenge"
+
+	// Only counted, the login history belongs to a user
+	loginReasonUnknownUser = "unknown_user"
+)
+
+// Outcomes of the registration attempts
+const (
+	registrationOutcomeCreated   = "created"
+	registrationOutcomeDuplicate = "duplicate"
+	registrationOutcomeInvalid   = "invalid"
+)
+
+// The opaque refresh tokens are counted along with the JWTs
+const refreshTokenType = "refresh"
+
+// Causes of the rejected tokens
+const (
+	tokenFailureMissing          = "missing"
+	tokenFailureMalformed        = "malformed"
+	tokenFailureExpired          = "expired"
+	tokenFailureNotValidYet      = "not_valid_yet"
+	tokenFailureInvalidSignature = "invalid_signature"
+	tokenFailureWrongType        = "wrong_type"
+	tokenFailureInvalidClaims    = "invalid_claims"
+	tokenFailureRevoked          = "revoked"
+	tokenFailureReused           = "reused"
+	tokenFailureUnknown          = "unknown"
+)
+
+// GetMetrics : GET /metrics
+func (s *Server) GetMetrics(ctx echo.Context) error {
+	return echo.WrapHandler(s.Metrics.Handler())(ctx)
+}
+
+func (s *Server) countLogin(outcome string, reason string) {
+	s.Metrics.Logins.WithLabelValues(outcome, reason).Inc()
+}
+
+func (s *Server) countRegistration(outcome string) {
+	s.Metrics.Registrations.WithLabelValues(outcome).Inc()
+}
+
+// countTokenValidationFailure counts the rejected token, unless the cause is empty, i.e. the token couldn't be
+// checked at all, e.g. because the revocation store is down
+func (s *Server) countTokenValidationFailure(tokenType string, cause string) {
+	if cause != "" {
+		s.Metrics.TokenValidationFailures.WithLabelValues(tokenType, cause).Inc()
+	}
+}
+
+// tokenValidationFailureCause tells why the JWT was rejected, empty when it's not the token's fault
+func tokenValidationFailureCause(err error) string {
+	// Checked first, jwt joins them with ErrTokenInvalidClaims
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return tokenFailureExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return tokenFailureNotValidYet
+	}
+
+	switch {
+	case errors.Is(err, errMissingToken):
+		return tokenFailureMissing
+	case errors.Is(err, errMalformedToken), errors.Is(err, jwt.ErrTokenMalformed):
+		return tokenFailureMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return tokenFailureInvalidSignature
+	case errors.Is(err, errUnexpectedTokenType):
+		return tokenFailureWrongType
+	case errors.Is(err, errInvalidTokenClaims), errors.Is(err, jwt.ErrTokenInvalidClaims):
+		return tokenFailureInvalidClaims
+	case errors.Is(err, errTokenRevoked):
+		return tokenFailureRevoked
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/metrics"
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+func TestGetMetrics(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+		ctx            = gomock.Any()
+	)
+
+	_, e, wg := initializeTestEchoServer(mockRepository)
+
+	server := NewServer(NewServerOptions{
+		JWTSecretKey:   "key",
+		Repository:     mockRepository,
+		PasswordHasher: testPasswordHasher,
+		Metrics:        metrics.NewMetrics(metrics.NewMetricsOptions{Registry: prometheus.NewRegistry()}),
+	})
+
+	t.Run("login of an unknown user", func(t *testing.T) {
+		reqBody := `{"password": "correctPassword123!", "phone_number": "+62123456789"}`
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(reqBody))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetUserByPhoneNumber(ctx, gomock.Any()).
+			Return(repository.GetUserByPhoneNumberOutput{}, common.ErrUserNotFound)
+
+		if assert.NoError(t, server.UserLogin(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, float64(1), testutil.ToFloat64(server.Metrics.Logins.WithLabelValues(loginOutcomeFailure, loginReasonUnknownUser)))
+		}
+	})
+
+	t.Run("invalid registration", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/register", strings.NewReader(`{`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, server.UserRegister(c)) {
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, float64(1), testutil.ToFloat64(server.Metrics.Registrations.WithLabelValues(registrationOutcomeInvalid)))
+		}
+	})
+
+	t.Run("missing access token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, server.GetUserProfile(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Equal(t, float64(1), testutil.ToFloat64(server.Metrics.TokenValidationFailures.WithLabelValues(accessTokenType, tokenFailureMissing)))
+		}
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/user/token/refresh", strings.NewReader(`{"refresh_token": "unknown"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		mockRepository.EXPECT().GetRefreshTokenByHash(ctx, gomock.Any()).
+			Return(repository.GetRefreshTokenByHashOutput{}, common.ErrRefreshTokenNotFound)
+
+		if assert.NoError(t, server.UserTokenRefresh(c)) {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Equal(t, float64(1), testutil.ToFloat64(server.Metrics.TokenValidationFailures.WithLabelValues(refreshTokenType, tokenFailureUnknown)))
+		}
+	})
+
+	t.Run("exposed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		if assert.NoError(t, server.GetMetrics(c)) {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Header().Get(echo.HeaderContentType), "text/plain")
+			assert.Contains(t, rec.Body.String(), `user_service_logins_total{outcome="failure",reason="unknown_user"} 1`)
+			assert.Contains(t, rec.Body.String(), `user_service_registrations_total{outcome="invalid"} 1`)
+		}
+	})
+
+	_ = e.Shutdown(context.Background())
+	wg.Wait()
+}
+
+func TestTokenValidationFailureCause(t *testing.T) {
+	server := NewServer(NewServerOptions{JWTSecretKey: "key"})
+
+	// Errors as returned by jwt when parsing the token
+	parseError := func(key string, claims jwt.MapClaims) error {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		_, err := server.parseJWTToken(token, accessTokenType)
+		return err
+	}
+	_, malformedErr := server.parseJWTToken("not.a.token", accessTokenType)
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "missing", err: errMissingToken, expected: tokenFailureMissing},
+		{name: "not bearer", err: errMalformedToken, expected: tokenFailureMalformed},
+		{name: "malformed", err: malformedErr, expected: tokenFailureMalformed},
+		{name: "expired", err: parseError("key", jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}), expected: tokenFailureExpired},
+		{name: "not valid yet", err: parseError("key", jwt.MapClaims{"nbf": time.Now().Add(time.Minute).Unix()}), expected: tokenFailureNotValidYet},
+		{name: "invalid signature", err: parseError("other-key", jwt.MapClaims{}), expected: tokenFailureInvalidSignature},
+		{name: "wrong type", err: errUnexpectedTokenType, expected: tokenFailureWrongType},
+		{name: "invalid claims", err: errInvalidTokenClaims, expected: tokenFailureInvalidClaims},
+		{name: "revoked", err: errTokenRevoked, expected: tokenFailureRevoked},
+		{name: "revocation store down", err: errors.New("connection refused"), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.err)
+			assert.Equal(t, tt.expected, tokenValidationFailureCause(tt.err))
+		})
+	}
+}
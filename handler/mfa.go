@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/totp"
+)
+
+const (
+	// How long the user has to complete the second factor after the password is accepted
+	mfaChallengeTTL = 5 * time.Minute
+
+	// Number of consecutive failed logins after which the challenge is revoked, the password has to be entered again
+	mfaChallengeMaxFailures = 3
+
+	tooManyInvalidCodesMessage = "too many invalid codes, log in again"
+
+	// Number of one-time recovery codes issued on enrollment, and their size in random bytes
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateMFASecret generates a new TOTP secret and encrypts it for storage
+func (s *Server) generateMFASecret(userId uuid.UUID) (secret []byte, encryptedSecret string, err error) {
+	secret = make([]byte, totp.SecretSize)
+	if _, err = RandRead(secret); err != nil {
+		return nil, "", err
+	}
+
+	encryptedSecret, err = s.encryptMFASecret(userId, secret)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return secret, encryptedSecret, nil
+}
+
+// encryptMFASecret encrypts the TOTP secret with AES-GCM. The user ID is bound as additional data,
+// so a secret copied to another user's row fails to decrypt.
+func (s *Server) encryptMFASecret(userId uuid.UUID, secret []byte) (string, error) {
+	gcm, err := s.newMFACipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = RandRead(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, secret, userId[:])
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Server) decryptMFASecret(userId uuid.UUID, encryptedSecret string) ([]byte, error) {
+	gcm, err := s.newMFACipher()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encryptedSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted secret")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, userId[:])
+}
+
+func (s *Server) newMFACipher() (cipher.AEAD, error) {
+	if len(s.MFAEncryptionKey) == 0 {
+		return nil, errors.New("two-factor authentication is not configured")
+	}
+
+	block, err := aes.NewCipher(s.MFAEncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// generateRecoveryCodes generates the one-time recovery codes shown to the user, along with the hashes to store
+func generateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		randomBytes := make([]byte, recoveryCodeSize)
+		if _, err = RandRead(randomBytes); err != nil {
+			return nil, nil, err
+		}
+
+		// Group the code as xxxx-xxxx-xxxx-xxxx so it's easier to write down
+		encoded := strings.ToLower(recoveryCodeEncoding.EncodeToString(randomBytes))
+		groups := make([]string, 0, len(encoded)/4)
+		for j := 0; j < len(encoded); j += 4 {
+			groups = append(groups, encoded[j:j+4])
+		}
+
+		code := strings.Join(groups, "-")
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes the recovery code, ignoring the case and the separators the user typed
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// generateMFAChallengeToken generates the short-lived token proving the password was accepted.
+// It can only be exchanged on the MFA login endpoint, never used as an access token.
+func (s *Server) generateMFAChallengeToken(id string) (string, error) {
+	now := time.Now()
+	claims := &jwt.MapClaims{
+		"id":  id,
+		"jti": uuid.New().String(),
+		"typ": mfaChallengeTokenType,
+		"iat": jwt.NewNumericDate(now),
+		"exp": jwt.NewNumericDate(now.Add(mfaChallengeTTL)),
+	}
+
+	return s.signJWTToken(claims)
+}
+
+// verifyMFACode checks the code against the user's TOTP secret, falling back to the recovery codes.
+// A TOTP code is only accepted once, and so is a recovery code.
+func (s *Server) verifyMFACode(ctx context.Context, userMFA repository.GetUserMFAOutput, code string) (bool, error) {
+	secret, err := s.decryptMFASecret(userMFA.UserId, userMFA.EncryptedSecret)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		updateLastUsedStepInput := repository.UpdateUserMFALastUsedStepInput{
+			UserId: userMFA.UserId,
+			Step:   step,
+		}
+
+		err = s.Repository.UpdateUserMFALastUsedStep(ctx, updateLastUsedStepInput)
+		if err == common.ErrMFACodeAlreadyUsed {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	useRecoveryCodeInput := repository.UseMFARecoveryCodeInput{
+		UserId:   userMFA.UserId,
+		CodeHash: hashRecoveryCode(code),
+	}
+
+	err = s.Repository.UseMFARecoveryCode(ctx, useRecoveryCodeInput)
+	if err == common.ErrMFARecoveryCodeNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMFASecretEncryption(t *testing.T) {
+	var (
+		server = NewServer(NewServerOptions{MFAEncryptionKey: testMFAEncryptionKey})
+		userId = uuid.New()
+		secret = []byte("12345678901234567890")
+	)
+
+	t.Run("round trip", func(t *testing.T) {
+		encryptedSecret, err := server.encryptMFASecret(userId, secret)
+		assert.NoError(t, err)
+
+		decryptedSecret, err := server.decryptMFASecret(userId, encryptedSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, secret, decryptedSecret)
+	})
+
+	t.Run("secret is bound to the user", func(t *testing.T) {
+		encryptedSecret, err := server.encryptMFASecret(userId, secret)
+		assert.NoError(t, err)
+
+		_, err = server.decryptMFASecret(uuid.New(), encryptedSecret)
+		assert.Error(t, err)
+	})
+
+	t.Run("encryption key not configured", func(t *testing.T) {
+		_, err := NewServer(NewServerOptions{}).encryptMFASecret(userId, secret)
+		assert.Error(t, err)
+	})
+
+	t.Run("random read returns error", func(t *testing.T) {
+		// patch
+		tempFunc := RandRead
+		RandRead = func(b []byte) (n int, err error) {
+			return 0, errors.New("error")
+		}
+		defer func() { RandRead = tempFunc }()
+
+		_, err := server.encryptMFASecret(userId, secret)
+		assert.Error(t, err)
+	})
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.Len(t, hashes, recoveryCodeCount)
+
+	for i, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}-[a-z2-7]{4}$`, code)
+		assert.Equal(t, hashRecoveryCode(code), hashes[i])
+	}
+
+	// Users may type the code without the separators or in upper case
+	assert.Equal(t, hashes[0], hashRecoveryCode(fmt.Sprintf(" %s ", codes[0][:4]+codes[0][5:])))
+	assert.Equal(t, hashes[0], hashRecoveryCode(codes[0][:10]+" "+codes[0][10:]))
+}
+
+func TestMFAChallengeTokenIsNotAnAccessToken(t *testing.T) {
+	server := NewServer(NewServerOptions{JWTSecretKey: "key"})
+
+	challengeToken, err := server.generateMFAChallengeToken(uuid.New().String())
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", challengeToken))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	_, err = server.retrieveAndGetIdFromJWTToken(c)
+	assert.EqualError(t, err, "unexpected token type")
+
+	// And the other way around
+	accessToken, err := server.generateJWTToken(uuid.New().String(), uuid.New().String())
+	assert.NoError(t, err)
+
+	_, err = server.parseJWTToken(accessToken, mfaChallengeTokenType)
+	assert.EqualError(t, err, "unexpected token type")
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+const passwordReusedMessage = "New password must not be one of your recent passwords"
+
+// isPasswordReused tells whether the password is the current one or any other kept in the user's password history.
+// The current hash is checked on its own too, as users registered before the history was kept have none.
+func (s *Server) isPasswordReused(ctx context.Context, userId uuid.UUID, currentHash string, password string) (bool, error) {
+	history, err := s.Repository.GetPasswordHistory(ctx, repository.GetPasswordHistoryInput{UserId: userId})
+	if err != nil {
+		return false, err
+	}
+
+	passwordHashes := history.PasswordHashes
+	if len(passwordHashes) == 0 || passwordHashes[0] != currentHash {
+		passwordHashes = append([]string{currentHash}, passwordHashes...)
+	}
+
+	for _, passwordHash := range passwordHashes {
+		err = s.PasswordHasher.Compare(ctx, passwordHash, password)
+		if err == nil {
+			return true, nil
+		}
+
+		if err != hasher.ErrMismatchedHashAndPassword {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,234 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy is the set of rules a new password must follow. The same rules are described to users
+// in the validation message and served on GET /password-policy, so clients can check passwords before submitting.
+type PasswordPolicy struct {
+	// Length bounds, counted in characters rather than bytes
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+
+	// Character classes the password must contain at least one of. Letters and digits of any script count
+	// when Unicode is allowed, everything that is neither a letter nor a digit is a symbol.
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+
+	// Whether characters outside of ASCII may be used at all
+	AllowUnicode bool `json:"allow_unicode"`
+
+	// The same character may not appear more than this many times in a row, no limit when zero
+	MaxRepeatedCharacters int `json:"max_repeated_characters"`
+
+	// Minimum strength as estimated by passwordEntropyBits, no minimum when zero
+	MinEntropyBits float64 `json:"min_entropy_bits"`
+}
+
+// DefaultPasswordPolicy returns the rules passwords have always followed
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        6,
+		MaxLength:        64,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		AllowUnicode:     true,
+	}
+}
+
+// LoadPasswordPolicy reads the policy from a JSON file. Fields missing from the file keep their default value.
+func LoadPasswordPolicy(path string) (PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return policy, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&policy); err != nil {
+		return policy, fmt.Errorf("invalid password policy: %w", err)
+	}
+
+	return policy, policy.Check()
+}
+
+// Check tells whether the policy can be satisfied at all
+func (p PasswordPolicy) Check() error {
+	if p.MinLength < 1 {
+		return errors.New("invalid password policy: min_length must be at least 1")
+	}
+
+	if p.MaxLength < p.MinLength {
+		return errors.New("invalid password policy: max_length must not be less than min_length")
+	}
+
+	var requiredClasses int
+	for _, required := range []bool{p.RequireUppercase, p.RequireLowercase, p.RequireDigit, p.RequireSymbol} {
+		if required {
+			requiredClasses++
+		}
+	}
+
+	if requiredClasses > p.MaxLength {
+		return errors.New("invalid password policy: max_length is too short for the required characters")
+	}
+
+	if p.MaxRepeatedCharacters < 0 || p.MinEntropyBits < 0 {
+		return errors.New("invalid password policy: max_repeated_characters and min_entropy_bits must not be negative")
+	}
+
+	return nil
+}
+
+// Allows tells whether the password follows every rule of the policy
+func (p PasswordPolicy) Allows(password string) bool {
+	characters := []rune(password)
+	if len(characters) < p.MinLength || len(characters) > p.MaxLength {
+		return false
+	}
+
+	var hasUppercase, hasLowercase, hasDigit, hasSymbol bool
+	for i, char := range characters {
+		if char > unicode.MaxASCII && !p.AllowUnicode {
+			return false
+		}
+
+		switch {
+		case unicode.IsUpper(char):
+			hasUppercase = true
+		case unicode.IsLower(char):
+			hasLowercase = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case !unicode.IsLetter(char):
+			hasSymbol = true
+		}
+
+		if p.MaxRepeatedCharacters > 0 && i >= p.MaxRepeatedCharacters && repeatsPrevious(characters[i-p.MaxRepeatedCharacters:i+1]) {
+			return false
+		}
+	}
+
+	if (p.RequireUppercase && !hasUppercase) || (p.RequireLowercase && !hasLowercase) ||
+		(p.RequireDigit && !hasDigit) || (p.RequireSymbol && !hasSymbol) {
+		return false
+	}
+
+	return passwordEntropyBits(characters) >= p.MinEntropyBits
+}
+
+// Description describes the policy to users, e.g. "Minimum 6 characters, maximum 64 characters, containing
+// at least 1 capital character AND 1 number AND 1 special (non-alpha-numeric) character."
+func (p PasswordPolicy) Description() string {
+	description := fmt.Sprintf("Minimum %d characters, maximum %d characters", p.MinLength, p.MaxLength)
+
+	var classes []string
+	if p.RequireUppercase {
+		classes = append(classes, "1 capital character")
+	}
+	if p.RequireLowercase {
+		classes = append(classes, "1 lowercase character")
+	}
+	if p.RequireDigit {
+		classes = append(classes, "1 number")
+	}
+	if p.RequireSymbol {
+		classes = append(classes, "1 special (non-alpha-numeric) character")
+	}
+
+	if len(classes) > 0 {
+		description += ", containing at least " + strings.Join(classes, " AND ")
+	}
+
+	if !p.AllowUnicode {
+		description += ", using only ASCII characters"
+	}
+
+	if p.MaxRepeatedCharacters > 0 {
+		description += fmt.Sprintf(", with no character repeated more than %d times in a row", p.MaxRepeatedCharacters)
+	}
+
+	if p.MinEntropyBits > 0 {
+		description += fmt.Sprintf(", and hard enough to guess (at least %g bits of entropy)", p.MinEntropyBits)
+	}
+
+	return description + "."
+}
+
+func repeatsPrevious(characters []rune) bool {
+	for _, char := range characters[1:] {
+		if char != characters[0] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// passwordEntropyBits estimates how hard the password is to guess, in the spirit of zxcvbn but much simpler:
+// every character is worth the bits of the character classes used, except the ones repeating the previous
+// character or continuing a sequence like "abc" or "321", which are worth 1 bit.
+func passwordEntropyBits(characters []rune) float64 {
+	var lowercase, uppercase, digit, symbol, other bool
+	for _, char := range characters {
+		switch {
+		case char > unicode.MaxASCII:
+			other = true
+		case unicode.IsLower(char):
+			lowercase = true
+		case unicode.IsUpper(char):
+			uppercase = true
+		case unicode.IsDigit(char):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var poolSize float64
+	if lowercase {
+		poolSize += 26
+	}
+	if uppercase {
+		poolSize += 26
+	}
+	if digit {
+		poolSize += 10
+	}
+	if symbol {
+		poolSize += 33
+	}
+	if other {
+		// No way to know how many characters the user picks from, assume a small alphabet
+		poolSize += 100
+	}
+
+	if poolSize == 0 {
+		return 0
+	}
+
+	var bits float64
+	for i, char := range characters {
+		if i > 0 && math.Abs(float64(char-characters[i-1])) <= 1 {
+			bits++
+			continue
+		}
+
+		bits += math.Log2(poolSize)
+	}
+
+	return bits
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Allows(t *testing.T) {
+	t.Run("default policy", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+
+		for password, expected := range map[string]bool{
+			"Pass1!":                         true,
+			"Pass1":                          false,
+			"Pa1!":                           false,
+			"pass12!":                        false,
+			"Password!":                      false,
+			"Password12":                     false,
+			"Ünïcødé1!":                      true,
+			"Aa1!" + strings.Repeat("x", 61): false,
+		} {
+			assert.Equal(t, expected, policy.Allows(password), password)
+		}
+	})
+
+	t.Run("length is counted in characters", func(t *testing.T) {
+		policy := PasswordPolicy{MinLength: 4, MaxLength: 4, AllowUnicode: true}
+		assert.True(t, policy.Allows("ÄÖÜß"))
+		assert.False(t, policy.Allows("ÄÖÜßé"))
+	})
+
+	t.Run("ASCII only", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+		policy.AllowUnicode = false
+		assert.True(t, policy.Allows("Pass1!"))
+		assert.False(t, policy.Allows("Päss1!"))
+	})
+
+	t.Run("lowercase required", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+		policy.RequireLowercase = true
+		assert.True(t, policy.Allows("Pass1!"))
+		assert.False(t, policy.Allows("PASS1!"))
+	})
+
+	t.Run("repeated characters", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+		policy.MaxRepeatedCharacters = 2
+		assert.True(t, policy.Allows("Paass1!!"))
+		assert.False(t, policy.Allows("Paaass1!"))
+		assert.False(t, policy.Allows("Pass1!!!"))
+	})
+
+	t.Run("minimum entropy", func(t *testing.T) {
+		policy := DefaultPasswordPolicy()
+		policy.MinEntropyBits = 50
+		assert.True(t, policy.Allows("Kt7#qLw9!x"))
+		assert.False(t, policy.Allows("Abcdefgh1!"))
+		assert.False(t, policy.Allows("Aaaaaaaa1!"))
+	})
+}
+
+func TestPasswordEntropyBits(t *testing.T) {
+	assert.Zero(t, passwordEntropyBits(nil))
+	assert.InDelta(t, 4*4.7, passwordEntropyBits([]rune("qwzx")), 0.1)
+
+	// Sequences and repetitions are worth 1 bit per character after the first one
+	assert.InDelta(t, 4.7+3, passwordEntropyBits([]rune("abcd")), 0.1)
+	assert.InDelta(t, 4.7+3, passwordEntropyBits([]rune("zzzz")), 0.1)
+	assert.Less(t, passwordEntropyBits([]rune("Abcdefgh1!")), passwordEntropyBits([]rune("Kt7#qLw9!x")))
+}
+
+func TestPasswordPolicy_Description(t *testing.T) {
+	assert.Equal(t, "Minimum 6 characters, maximum 64 characters, containing at least 1 capital character AND 1 number "+
+		"AND 1 special (non-alpha-numeric) character.", DefaultPasswordPolicy().Description())
+
+	policy := PasswordPolicy{
+		MinLength:             12,
+		MaxLength:             128,
+		RequireLowercase:      true,
+		MaxRepeatedCharacters: 3,
+		MinEntropyBits:        50,
+	}
+	assert.Equal(t, "Minimum 12 characters, maximum 128 characters, containing at least 1 lowercase character, "+
+		"using only ASCII characters, with no character repeated more than 3 times in a row, "+
+		"and hard enough to guess (at least 50 bits of entropy).", policy.Description())
+}
+
+func TestPasswordPolicy_Check(t *testing.T) {
+	assert.NoError(t, DefaultPasswordPolicy().Check())
+
+	for name, policy := range map[string]PasswordPolicy{
+		"no minimum length":            {MaxLength: 64},
+		"maximum below minimum":        {MinLength: 8, MaxLength: 6},
+		"too short for the classes":    {MinLength: 1, MaxLength: 2, RequireUppercase: true, RequireDigit: true, RequireSymbol: true},
+		"negative repeated characters": {MinLength: 6, MaxLength: 64, MaxRepeatedCharacters: -1},
+		"negative entropy":             {MinLength: 6, MaxLength: 64, MinEntropyBits: -1},
+	} {
+		assert.Error(t, policy.Check(), name)
+	}
+}
+
+func TestLoadPasswordPolicy(t *testing.T) {
+	writePolicy := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "password-policy.json")
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		policy, err := LoadPasswordPolicy(writePolicy(t, `{"min_length": 12, "require_lowercase": true, "min_entropy_bits": 50}`))
+		assert.NoError(t, err)
+
+		expected := DefaultPasswordPolicy()
+		expected.MinLength = 12
+		expected.RequireLowercase = true
+		expected.MinEntropyBits = 50
+		assert.Equal(t, expected, policy)
+	})
+
+	t.Run("negative - unknown field", func(t *testing.T) {
+		_, err := LoadPasswordPolicy(writePolicy(t, `{"min_lenght": 12}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("negative - policy can't be satisfied", func(t *testing.T) {
+		_, err := LoadPasswordPolicy(writePolicy(t, `{"min_length": 100}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("negative - file doesn't exist", func(t *testing.T) {
+		_, err := LoadPasswordPolicy(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
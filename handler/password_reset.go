@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/sms"
+)
+
+const (
+	passwordResetCodeTTL        = 10 * time.Minute
+	passwordResetResendCooldown = time.Minute
+	passwordResetMaxAttempts    = 5
+
+	// Same response for every reset request, so it can't be used to find out which phone numbers are registered
+	passwordResetRequestedMessage = "If the phone number is registered, a reset code has been sent"
+
+	// Same error for an unknown phone number and a wrong, expired or exhausted code
+	invalidPasswordResetCodeMessage = "invalid or expired code"
+)
+
+// sendPasswordResetCode stores a new password reset code for the user and sends it by SMS.
+// It fails with common.ErrPasswordResetCooldown when the previous code was sent too recently.
+func (s *Server) sendPasswordResetCode(ctx context.Context, userId uuid.UUID, phoneNumber string) error {
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+
+	// Store the hash of the code, replacing the previous one once the cooldown has passed
+	now := time.Now()
+	upsertPasswordResetInput := repository.UpsertPasswordResetInput{
+		UserId:         userId,
+		CodeHash:       hashVerificationCode(s.CodeHashKey, userId, phoneNumber, code),
+		ExpiresAt:      now.Add(passwordResetCodeTTL),
+		SentAt:         now,
+		LastSentBefore: now.Add(-passwordResetResendCooldown),
+	}
+
+	err = s.Repository.UpsertPasswordReset(ctx, upsertPasswordResetInput)
+	if err != nil {
+		return err
+	}
+
+	sendSMSInput := sms.SendSMSInput{
+		PhoneNumber: phoneNumber,
+		Message: fmt.Sprintf("Your password reset code is %s. It expires in %d minutes. "+
+			"If you didn't request it, you can ignore this message.", code, int(passwordResetCodeTTL.Minutes())),
+	}
+
+	return s.SMSSender.SendSMS(ctx, sendSMSInput)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/sms"
+)
+
+const (
+	phoneVerificationCodeTTL        = 5 * time.Minute
+	phoneVerificationResendCooldown = time.Minute
+	phoneVerificationMaxAttempts    = 5
+
+	// Number of digits of the code sent by SMS
+	phoneVerificationCodeDigits = 6
+)
+
+var (
+	errVerificationCodeExpired = errors.New("verification code has expired")
+	errInvalidVerificationCode = errors.New("invalid code")
+)
+
+// generateVerificationCode generates a random numeric code of phoneVerificationCodeDigits digits
+func generateVerificationCode() (string, error) {
+	modulo := uint32(math.Pow10(phoneVerificationCodeDigits))
+
+	// Reject the top of the range so every code is equally likely
+	limit := math.MaxUint32 - math.MaxUint32%modulo
+	randomBytes := make([]byte, 4)
+	for {
+		if _, err := RandRead(randomBytes); err != nil {
+			return "", err
+		}
+
+		if n := binary.BigEndian.Uint32(randomBytes); n < limit {
+			return fmt.Sprintf("%0*d", phoneVerificationCodeDigits, n%modulo), nil
+		}
+	}
+}
+
+// sendPhoneVerificationCode stores a new verification code for the phone number and sends it by SMS.
+// It fails with common.ErrPhoneVerificationCooldown when the previous code was sent too recently.
+func (s *Server) sendPhoneVerificationCode(ctx context.Context, userId uuid.UUID, phoneNumber string) error {
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+
+	// Store the hash of the code, replacing the previous one once the cooldown has passed
+	now := time.Now()
+	upsertVerificationInput := repository.UpsertPhoneVerificationInput{
+		UserId:         userId,
+		PhoneNumber:    phoneNumber,
+		CodeHash:       hashVerificationCode(s.CodeHashKey, userId, phoneNumber, code),
+		ExpiresAt:      now.Add(phoneVerificationCodeTTL),
+		SentAt:         now,
+		LastSentBefore: now.Add(-phoneVerificationResendCooldown),
+	}
+
+	err = s.Repository.UpsertPhoneVerification(ctx, upsertVerificationInput)
+	if err != nil {
+		return err
+	}
+
+	// Send the code to the phone number
+	sendSMSInput := sms.SendSMSInput{
+		PhoneNumber: phoneNumber,
+		Message: fmt.Sprintf("Your verification code is %s. It expires in %d minutes.",
+			code, int(phoneVerificationCodeTTL.Minutes())),
+	}
+
+	return s.SMSSender.SendSMS(ctx, sendSMSInput)
+}
+
+// confirmPhoneVerification checks the code sent to the user, then marks the phone number it was sent to as verified.
+// The attempt is counted before comparing, so guessing stops at the limit. The pending verification is returned
+// along with the error, e.g. for when the next code can be sent.
+func (s *Server) confirmPhoneVerification(ctx context.Context, userId uuid.UUID, code string) (verification repository.GetPhoneVerificationOutput, err error) {
+	verification, err = s.Repository.GetPhoneVerification(ctx, repository.GetPhoneVerificationInput{UserId: userId})
+	if err != nil {
+		return verification, err
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		return verification, errVerificationCodeExpired
+	}
+
+	incrementAttemptsInput := repository.IncrementPhoneVerificationAttemptsInput{
+		UserId:      userId,
+		MaxAttempts: phoneVerificationMaxAttempts,
+	}
+
+	if err = s.Repository.IncrementPhoneVerificationAttempts(ctx, incrementAttemptsInput); err != nil {
+		return verification, err
+	}
+
+	codeHash := hashVerificationCode(s.CodeHashKey, userId, verification.PhoneNumber, code)
+	if subtle.ConstantTimeCompare([]byte(codeHash), []byte(verification.CodeHash)) != 1 {
+		return verification, errInvalidVerificationCode
+	}
+
+	verifyUserPhoneInput := repository.VerifyUserPhoneInput{
+		UserId:      userId,
+		PhoneNumber: verification.PhoneNumber,
+	}
+
+	err = s.Repository.VerifyUserPhone(ctx, verifyUserPhoneInput)
+	if err == common.ErrPhoneVerificationNotFound {
+		// The phone number has been changed since the code was sent
+		return verification, errInvalidVerificationCode
+	}
+
+	return verification, err
+}
+
+// hashVerificationCode hashes the code together with the user and the phone number it was sent to,
+// so a code can't be used for another number. The hash is keyed, the few possible codes would otherwise
+// be found from a copy of the database by trying them all.
+func hashVerificationCode(key []byte, userId uuid.UUID, phoneNumber string, code string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(userId.String() + ":" + phoneNumber + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// setRetryAfter tells the client how long to wait before trying again, in whole seconds
+func setRetryAfter(ctx echo.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	ctx.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+}
@@ -1,20 +1,215 @@
 package handler
 
-import "github.com/dityuiri/UserServiceTest/repository"
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dityuiri/UserServiceTest/hasher"
+	"github.com/dityuiri/UserServiceTest/metrics"
+	"github.com/dityuiri/UserServiceTest/repository"
+	"github.com/dityuiri/UserServiceTest/revocation"
+	"github.com/dityuiri/UserServiceTest/sms"
+)
+
+const (
+	defaultAccessTokenTTL  = 2 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+	defaultMFAIssuer       = "User Service"
+
+	// How long clients are asked to wait when too many passwords are being hashed already
+	busyHashingRetryAfter = time.Second
+
+	// How long the work left running after a response is given, e.g. sending a text message
+	backgroundTaskTimeout = 30 * time.Second
+)
 
 type Server struct {
-	JWTSecretKey string
-	Repository   repository.RepositoryInterface
+	JWTSecretKey     string
+	SigningKeys      *KeySet
+	Repository       repository.RepositoryInterface
+	RevocationStore  revocation.Store
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	MFAEncryptionKey []byte
+	MFAIssuer        string
+	SMSSender        sms.SMSSender
+	PasswordHasher   hasher.PasswordHasher
+	PasswordPolicy   PasswordPolicy
+
+	// Keys the hashes of the codes sent by SMS, so they can't be recovered from the stored hashes
+	CodeHashKey []byte
+
+	// Consecutive failed logins within LoginLockoutWindow before the account is locked for LoginLockoutDuration.
+	// Below the threshold, every failure after the first one delays the next attempt, starting at LoginRetryDelay.
+	LoginLockoutThreshold int
+	LoginLockoutWindow    time.Duration
+	LoginLockoutDuration  time.Duration
+	LoginRetryDelay       time.Duration
+
+	// EnumerationSafe makes login and registration respond the same whether the phone number is registered or not
+	EnumerationSafe bool
+
+	// Checked by GET /readyz along with the database and the signing keys, each within ReadinessTimeout
+	ReadinessChecks  map[string]ReadinessCheck
+	ReadinessTimeout time.Duration
+
+	// Served by GET /metrics, along with the logins, registrations and rejected tokens counted by the server
+	Metrics *metrics.Metrics
+
+	// Hash of a random password, compared against when the user doesn't exist
+	dummyPasswordHash   string
+	dummyPasswordHashMu sync.Mutex
+
+	// Work left running after the response, waited for by Close
+	backgroundTasks sync.WaitGroup
 }
 
 type NewServerOptions struct {
-	JWTSecretKey string
-	Repository   repository.RepositoryInterface
+	JWTSecretKey     string
+	SigningKeys      *KeySet
+	Repository       repository.RepositoryInterface
+	RevocationStore  revocation.Store
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	MFAEncryptionKey []byte
+	MFAIssuer        string
+	SMSSender        sms.SMSSender
+	PasswordHasher   hasher.PasswordHasher
+	PasswordPolicy   PasswordPolicy
+
+	// Keys the hashes of the codes sent by SMS, so they can't be recovered from the stored hashes
+	CodeHashKey []byte
+
+	// Consecutive failed logins within LoginLockoutWindow before the account is locked for LoginLockoutDuration.
+	// Below the threshold, every failure after the first one delays the next attempt, starting at LoginRetryDelay.
+	LoginLockoutThreshold int
+	LoginLockoutWindow    time.Duration
+	LoginLockoutDuration  time.Duration
+	LoginRetryDelay       time.Duration
+
+	// EnumerationSafe makes login and registration respond the same whether the phone number is registered or not
+	EnumerationSafe bool
+
+	// Checked by GET /readyz along with the database and the signing keys, each within ReadinessTimeout
+	ReadinessChecks  map[string]ReadinessCheck
+	ReadinessTimeout time.Duration
+
+	// Served by GET /metrics, along with the logins, registrations and rejected tokens counted by the server
+	Metrics *metrics.Metrics
 }
 
 func NewServer(opts NewServerOptions) *Server {
+	// Fallback to the default TTLs when they're not supplied
+	if opts.AccessTokenTTL == 0 {
+		opts.AccessTokenTTL = defaultAccessTokenTTL
+	}
+
+	if opts.RefreshTokenTTL == 0 {
+		opts.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+
+	// Revoked tokens are only kept in memory unless a shared store is supplied
+	if opts.RevocationStore == nil {
+		opts.RevocationStore = revocation.NewMemoryStore()
+	}
+
+	// Text messages are only written to the standard output unless a real sender is supplied
+	if opts.SMSSender == nil {
+		opts.SMSSender = sms.NewWriterSender(os.Stdout)
+	}
+
+	// Argon2id with the recommended parameters, while still accepting the existing bcrypt hashes
+	if opts.PasswordHasher == nil {
+		opts.PasswordHasher, _ = hasher.NewHasher(hasher.NewHasherOptions{})
+	}
+
+	// The rules passwords have always followed, unless configured otherwise
+	if opts.PasswordPolicy == (PasswordPolicy{}) {
+		opts.PasswordPolicy = DefaultPasswordPolicy()
+	}
+
+	// A random key only holds within this process, the codes sent before a restart are no longer accepted
+	if len(opts.CodeHashKey) == 0 {
+		opts.CodeHashKey = make([]byte, 32)
+		_, _ = rand.Read(opts.CodeHashKey)
+	}
+
+	if opts.MFAIssuer == "" {
+		opts.MFAIssuer = defaultMFAIssuer
+	}
+
+	if opts.LoginLockoutThreshold == 0 {
+		opts.LoginLockoutThreshold = defaultLoginLockoutThreshold
+	}
+
+	if opts.LoginLockoutWindow == 0 {
+		opts.LoginLockoutWindow = defaultLoginLockoutWindow
+	}
+
+	if opts.LoginLockoutDuration == 0 {
+		opts.LoginLockoutDuration = defaultLoginLockoutDuration
+	}
+
+	if opts.LoginRetryDelay == 0 {
+		opts.LoginRetryDelay = defaultLoginRetryDelay
+	}
+
+	if opts.ReadinessTimeout == 0 {
+		opts.ReadinessTimeout = defaultReadinessTimeout
+	}
+
+	// Still counted, just on a registry of their own
+	if opts.Metrics == nil {
+		opts.Metrics = metrics.NewMetrics(metrics.NewMetricsOptions{})
+	}
+
 	return &Server{
-		JWTSecretKey: opts.JWTSecretKey,
-		Repository:   opts.Repository,
+		JWTSecretKey:     opts.JWTSecretKey,
+		SigningKeys:      opts.SigningKeys,
+		Repository:       opts.Repository,
+		RevocationStore:  opts.RevocationStore,
+		AccessTokenTTL:   opts.AccessTokenTTL,
+		RefreshTokenTTL:  opts.RefreshTokenTTL,
+		MFAEncryptionKey: opts.MFAEncryptionKey,
+		MFAIssuer:        opts.MFAIssuer,
+		SMSSender:        opts.SMSSender,
+		PasswordHasher:   opts.PasswordHasher,
+		PasswordPolicy:   opts.PasswordPolicy,
+
+		CodeHashKey: opts.CodeHashKey,
+
+		LoginLockoutThreshold: opts.LoginLockoutThreshold,
+		LoginLockoutWindow:    opts.LoginLockoutWindow,
+		LoginLockoutDuration:  opts.LoginLockoutDuration,
+		LoginRetryDelay:       opts.LoginRetryDelay,
+
+		EnumerationSafe: opts.EnumerationSafe,
+
+		ReadinessChecks:  opts.ReadinessChecks,
+		ReadinessTimeout: opts.ReadinessTimeout,
+
+		Metrics: opts.Metrics,
 	}
 }
+
+// runInBackground runs the task once the response is given, within backgroundTaskTimeout
+func (s *Server) runInBackground(task func(ctx context.Context)) {
+	s.backgroundTasks.Add(1)
+	go func() {
+		defer s.backgroundTasks.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		defer cancel()
+
+		task(ctx)
+	}()
+}
+
+// Close waits for the work left running after the responses, so it's done before the database pool is closed
+func (s *Server) Close() error {
+	s.backgroundTasks.Wait()
+	return nil
+}
@@ -1,9 +1,13 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dityuiri/UserServiceTest/repository"
@@ -18,5 +22,39 @@ func TestNewServer(t *testing.T) {
 	t.Run("positive", func(t *testing.T) {
 		sv := NewServer(NewServerOptions{Repository: mockRepo})
 		assert.NotEmpty(t, sv.Repository)
+		assert.Equal(t, defaultAccessTokenTTL, sv.AccessTokenTTL)
+		assert.Equal(t, defaultRefreshTokenTTL, sv.RefreshTokenTTL)
 	})
+
+	t.Run("custom token ttl", func(t *testing.T) {
+		sv := NewServer(NewServerOptions{
+			Repository:      mockRepo,
+			AccessTokenTTL:  5 * time.Minute,
+			RefreshTokenTTL: time.Hour,
+		})
+		assert.Equal(t, 5*time.Minute, sv.AccessTokenTTL)
+		assert.Equal(t, time.Hour, sv.RefreshTokenTTL)
+	})
+
+	t.Run("random code hash key", func(t *testing.T) {
+		sv := NewServer(NewServerOptions{Repository: mockRepo})
+		other := NewServer(NewServerOptions{Repository: mockRepo})
+		assert.Len(t, sv.CodeHashKey, 32)
+		assert.NotEqual(t, sv.CodeHashKey, other.CodeHashKey)
+	})
+}
+
+func TestHashVerificationCode(t *testing.T) {
+	userId := uuid.New()
+	hash := hashVerificationCode(testCodeHashKey, userId, "+62123456789", "123456")
+	assert.Equal(t, hash, hashVerificationCode(testCodeHashKey, userId, "+62123456789", "123456"))
+
+	// Without the key, the code can't be found by hashing every possible one
+	unkeyed := sha256.Sum256([]byte(userId.String() + ":+62123456789:123456"))
+	assert.NotEqual(t, hex.EncodeToString(unkeyed[:]), hash)
+	assert.NotEqual(t, hash, hashVerificationCode([]byte("another-key-of-at-least-32-bytes"), userId, "+62123456789", "123456"))
+
+	// Nor used for another number or user
+	assert.NotEqual(t, hash, hashVerificationCode(testCodeHashKey, userId, "+62987654321", "123456"))
+	assert.NotEqual(t, hash, hashVerificationCode(testCodeHashKey, uuid.New(), "+62123456789", "123456"))
 }
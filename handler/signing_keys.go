@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/dityuiri/UserServiceTest/generated"
+)
+
+// SigningKey is an asymmetric key used to sign or verify access tokens.
+// A key without the private part can only verify, which is how the previous key is kept around after a rotation.
+type SigningKey struct {
+	Id         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the active signing key along with every key accepted for verification
+type KeySet struct {
+	signingKey SigningKey
+	keys       map[string]SigningKey
+	keyIds     []string
+}
+
+// NewKeySet creates a key set signing with signingKey, while still accepting tokens signed by verificationKeys
+func NewKeySet(signingKey SigningKey, verificationKeys ...SigningKey) (*KeySet, error) {
+	if signingKey.PrivateKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", signingKey.Id)
+	}
+
+	keySet := &KeySet{
+		signingKey: signingKey,
+		keys:       make(map[string]SigningKey),
+	}
+
+	for _, key := range append([]SigningKey{signingKey}, verificationKeys...) {
+		if _, ok := keySet.keys[key.Id]; ok {
+			return nil, fmt.Errorf("duplicate signing key id %q", key.Id)
+		}
+
+		keySet.keys[key.Id] = key
+		keySet.keyIds = append(keySet.keyIds, key.Id)
+	}
+
+	return keySet, nil
+}
+
+// SigningKey returns the key used to sign new tokens
+func (k *KeySet) SigningKey() SigningKey {
+	return k.signingKey
+}
+
+// VerificationKey returns the key with the given ID, if it's still accepted
+func (k *KeySet) VerificationKey(id string) (SigningKey, bool) {
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// JWKS returns the public part of every verification key as a JSON Web Key Set
+func (k *KeySet) JWKS() generated.JWKSResponse {
+	jwks := generated.JWKSResponse{Keys: []generated.JSONWebKey{}}
+	for _, id := range k.keyIds {
+		jwks.Keys = append(jwks.Keys, k.keys[id].JWK())
+	}
+
+	return jwks
+}
+
+// ParseSigningKey parses a PEM encoded private or public key. When id is empty,
+// the RFC 7638 thumbprint of the key is used as the key ID.
+func ParseSigningKey(id string, pemBytes []byte) (SigningKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return SigningKey{}, errors.New("no PEM data found")
+	}
+
+	var (
+		parsedKey interface{}
+		err       error
+	)
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsedKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsedKey, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsedKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	return NewSigningKey(id, parsedKey)
+}
+
+// NewSigningKey creates a signing key from a private key (crypto.Signer) or a public key,
+// choosing the signing method from the key type
+func NewSigningKey(id string, key interface{}) (SigningKey, error) {
+	signingKey := SigningKey{Id: id}
+	if signer, ok := key.(crypto.Signer); ok {
+		signingKey.PrivateKey = signer
+		key = signer.Public()
+	}
+
+	switch publicKey := key.(type) {
+	case *rsa.PublicKey:
+		signingKey.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch publicKey.Curve {
+		case elliptic.P256():
+			signingKey.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			signingKey.Method = jwt.SigningMethodES384
+		case elliptic.P521():
+			signingKey.Method = jwt.SigningMethodES512
+		default:
+			return SigningKey{}, errors.New("unsupported elliptic curve")
+		}
+	case ed25519.PublicKey:
+		signingKey.Method = jwt.SigningMethodEdDSA
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	signingKey.PublicKey = key
+	if signingKey.Id == "" {
+		signingKey.Id = signingKey.thumbprint()
+	}
+
+	return signingKey, nil
+}
+
+// JWK returns the public part of the key as a JSON Web Key
+func (k SigningKey) JWK() generated.JSONWebKey {
+	jwk := generated.JSONWebKey{
+		Kid: k.Id,
+		Alg: k.Method.Alg(),
+		Use: "sig",
+	}
+
+	switch publicKey := k.PublicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = stringPtr(encodeBase64URL(publicKey.N.Bytes()))
+		jwk.E = stringPtr(encodeBase64URL(big.NewInt(int64(publicKey.E)).Bytes()))
+	case *ecdsa.PublicKey:
+		size := (publicKey.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = stringPtr(publicKey.Curve.Params().Name)
+		jwk.X = stringPtr(encodeBase64URL(publicKey.X.FillBytes(make([]byte, size))))
+		jwk.Y = stringPtr(encodeBase64URL(publicKey.Y.FillBytes(make([]byte, size))))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = stringPtr("Ed25519")
+		jwk.X = stringPtr(encodeBase64URL(publicKey))
+	}
+
+	return jwk
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, the required members in lexicographic order
+func (k SigningKey) thumbprint() string {
+	jwk := k.JWK()
+
+	var members []string
+	switch jwk.Kty {
+	case "RSA":
+		members = []string{"e", *jwk.E, "kty", jwk.Kty, "n", *jwk.N}
+	case "EC":
+		members = []string{"crv", *jwk.Crv, "kty", jwk.Kty, "x", *jwk.X, "y", *jwk.Y}
+	case "OKP":
+		members = []string{"crv", *jwk.Crv, "kty", jwk.Kty, "x", *jwk.X}
+	}
+
+	canonical := []byte("{")
+	for i := 0; i < len(members); i += 2 {
+		if i > 0 {
+			canonical = append(canonical, ',')
+		}
+
+		name, _ := json.Marshal(members[i])
+		value, _ := json.Marshal(members[i+1])
+		canonical = append(append(append(canonical, name...), ':'), value...)
+	}
+	canonical = append(canonical, '}')
+
+	hash := sha256.Sum256(canonical)
+	return encodeBase64URL(hash[:])
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func generateEd25519SigningKey(t *testing.T, id string) SigningKey {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	key, err := NewSigningKey(id, privateKey)
+	if err != nil {
+		t.Fatalf("Error creating signing key: %v", err)
+	}
+
+	return key
+}
+
+func encodePEM(blockType string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParseSigningKey(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	rsaPKCS8, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	ecPKCS8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	ecSEC1, _ := x509.MarshalECPrivateKey(ecKey)
+	edPKCS8, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPublic, _ := x509.MarshalPKIXPublicKey(edKey.Public())
+
+	tests := []struct {
+		name           string
+		pem            []byte
+		expectedMethod jwt.SigningMethod
+		canSign        bool
+	}{
+		{"rsa pkcs8 private key", encodePEM("PRIVATE KEY", rsaPKCS8), jwt.SigningMethodRS256, true},
+		{"rsa pkcs1 private key", encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)), jwt.SigningMethodRS256, true},
+		{"ec pkcs8 private key", encodePEM("PRIVATE KEY", ecPKCS8), jwt.SigningMethodES256, true},
+		{"ec sec1 private key", encodePEM("EC PRIVATE KEY", ecSEC1), jwt.SigningMethodES256, true},
+		{"ed25519 private key", encodePEM("PRIVATE KEY", edPKCS8), jwt.SigningMethodEdDSA, true},
+		{"ed25519 public key", encodePEM("PUBLIC KEY", edPublic), jwt.SigningMethodEdDSA, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseSigningKey("kid", tt.pem)
+			if assert.NoError(t, err) {
+				assert.Equal(t, "kid", key.Id)
+				assert.Equal(t, tt.expectedMethod, key.Method)
+				assert.Equal(t, tt.canSign, key.PrivateKey != nil)
+				assert.NotNil(t, key.PublicKey)
+			}
+		})
+	}
+
+	t.Run("key id defaults to the thumbprint", func(t *testing.T) {
+		key, err := ParseSigningKey("", encodePEM("PRIVATE KEY", edPKCS8))
+		if assert.NoError(t, err) {
+			assert.Equal(t, key.thumbprint(), key.Id)
+			assert.NotEmpty(t, key.Id)
+		}
+	})
+
+	t.Run("no pem data", func(t *testing.T) {
+		_, err := ParseSigningKey("kid", []byte("random"))
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported pem block type", func(t *testing.T) {
+		_, err := ParseSigningKey("kid", encodePEM("CERTIFICATE", []byte("random")))
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid key bytes", func(t *testing.T) {
+		_, err := ParseSigningKey("kid", encodePEM("PRIVATE KEY", []byte("random")))
+		assert.Error(t, err)
+	})
+}
+
+func TestNewSigningKey(t *testing.T) {
+	t.Run("unsupported key type", func(t *testing.T) {
+		_, err := NewSigningKey("kid", []byte("secret"))
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported curve", func(t *testing.T) {
+		ecKey, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+		_, err := NewSigningKey("kid", ecKey)
+		assert.Error(t, err)
+	})
+}
+
+func TestSigningKey_thumbprint(t *testing.T) {
+	// Example from RFC 7638 section 3.1
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	key, err := NewSigningKey("", &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.Id)
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	signingKey := generateEd25519SigningKey(t, "new")
+	previousKey := generateEd25519SigningKey(t, "old")
+
+	t.Run("positive", func(t *testing.T) {
+		keySet, err := NewKeySet(signingKey, previousKey)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "new", keySet.SigningKey().Id)
+
+			_, ok := keySet.VerificationKey("old")
+			assert.True(t, ok)
+
+			jwks := keySet.JWKS()
+			assert.Len(t, jwks.Keys, 2)
+			assert.Equal(t, "new", jwks.Keys[0].Kid)
+			assert.Equal(t, "OKP", jwks.Keys[0].Kty)
+			assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+		}
+	})
+
+	t.Run("signing key without private key", func(t *testing.T) {
+		publicOnly := signingKey
+		publicOnly.PrivateKey = nil
+
+		_, err := NewKeySet(publicOnly)
+		assert.Error(t, err)
+	})
+
+	t.Run("duplicate key id", func(t *testing.T) {
+		_, err := NewKeySet(signingKey, generateEd25519SigningKey(t, "new"))
+		assert.Error(t, err)
+	})
+}
+
+func TestAsymmetricAccessToken(t *testing.T) {
+	var (
+		e      = echo.New()
+		userId = uuid.New().String()
+
+		oldKey = generateEd25519SigningKey(t, "old")
+		newKey = generateEd25519SigningKey(t, "new")
+	)
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecSigningKey, _ := NewSigningKey("ec", ecKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaSigningKey, _ := NewSigningKey("rsa", rsaKey)
+
+	newContext := func(token string) echo.Context {
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return e.NewContext(req, httptest.NewRecorder())
+	}
+
+	t.Run("token carries the key id", func(t *testing.T) {
+		for _, key := range []SigningKey{newKey, ecSigningKey, rsaSigningKey} {
+			keySet, _ := NewKeySet(key)
+			sv := NewServer(NewServerOptions{SigningKeys: keySet})
+
+			token, err := sv.generateJWTToken(userId, uuid.New().String())
+			if assert.NoError(t, err) {
+				parsed, _, _ := jwt.NewParser().ParseUnverified(token, &jwt.MapClaims{})
+				assert.Equal(t, key.Id, parsed.Header["kid"])
+				assert.Equal(t, key.Method.Alg(), parsed.Method.Alg())
+
+				id, err := sv.retrieveAndGetIdFromJWTToken(newContext(token))
+				assert.NoError(t, err)
+				assert.Equal(t, userId, id)
+			}
+		}
+	})
+
+	t.Run("token signed by the previous key survives rotation", func(t *testing.T) {
+		oldKeySet, _ := NewKeySet(oldKey)
+		oldToken, _ := NewServer(NewServerOptions{SigningKeys: oldKeySet}).generateJWTToken(userId, uuid.New().String())
+
+		publicOnly := oldKey
+		publicOnly.PrivateKey = nil
+		rotatedKeySet, _ := NewKeySet(newKey, publicOnly)
+		sv := NewServer(NewServerOptions{SigningKeys: rotatedKeySet})
+
+		id, err := sv.retrieveAndGetIdFromJWTToken(newContext(oldToken))
+		assert.NoError(t, err)
+		assert.Equal(t, userId, id)
+
+		// Once the previous key is dropped, its tokens are rejected
+		droppedKeySet, _ := NewKeySet(newKey)
+		sv = NewServer(NewServerOptions{SigningKeys: droppedKeySet})
+
+		_, err = sv.retrieveAndGetIdFromJWTToken(newContext(oldToken))
+		assert.Error(t, err)
+	})
+
+	t.Run("token signed with the shared secret is accepted while configured", func(t *testing.T) {
+		keySet, _ := NewKeySet(newKey)
+		token := generateNewToken(userId, "key")
+
+		sv := NewServer(NewServerOptions{JWTSecretKey: "key", SigningKeys: keySet})
+		_, err := sv.retrieveAndGetIdFromJWTToken(newContext(token))
+		assert.NoError(t, err)
+
+		sv = NewServer(NewServerOptions{SigningKeys: keySet})
+		_, err = sv.retrieveAndGetIdFromJWTToken(newContext(token))
+		assert.Error(t, err)
+	})
+
+	t.Run("algorithm confusion is rejected", func(t *testing.T) {
+		keySet, _ := NewKeySet(rsaSigningKey)
+		sv := NewServer(NewServerOptions{SigningKeys: keySet})
+
+		// HMAC signed with the public key, claiming the RSA key id
+		publicKeyBytes, _ := x509.MarshalPKIXPublicKey(rsaSigningKey.PublicKey)
+		claims := &jwt.MapClaims{
+			"id":  userId,
+			"jti": uuid.New().String(),
+			"iat": jwt.NewNumericDate(time.Now()),
+			"exp": jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		forged.Header["kid"] = rsaSigningKey.Id
+		token, _ := forged.SignedString(encodePEM("PUBLIC KEY", publicKeyBytes))
+
+		_, err := sv.retrieveAndGetIdFromJWTToken(newContext(token))
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown key id", func(t *testing.T) {
+		otherKeySet, _ := NewKeySet(generateEd25519SigningKey(t, "other"))
+		token, _ := NewServer(NewServerOptions{SigningKeys: otherKeySet}).generateJWTToken(userId, uuid.New().String())
+
+		keySet, _ := NewKeySet(newKey)
+		_, err := NewServer(NewServerOptions{SigningKeys: keySet}).retrieveAndGetIdFromJWTToken(newContext(token))
+		assert.Error(t, err)
+
+		// Same for a server only configured with the shared secret
+		_, err = NewServer(NewServerOptions{JWTSecretKey: "key"}).retrieveAndGetIdFromJWTToken(newContext(token))
+		assert.Error(t, err)
+	})
+}
@@ -1,10 +1,19 @@
 package handler
 
 import (
-	"regexp"
+	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
+
+	"github.com/dityuiri/UserServiceTest/passwordcheck"
+)
+
+// The password tag is an alias of these, so each check gets its own message
+const (
+	passwordCriteriaTag     = "password_criteria"
+	passwordCommonTag       = "password_common"
+	passwordPersonalInfoTag = "password_personal_info"
 )
 
 // Map to translate validation error to human readble message
@@ -13,7 +22,10 @@ var validationErrorMessages = map[string]string{
 	"min":        "{field} must be at least {param} characters long.",
 	"max":        "{field} must not exceed {param} characters.",
 	"startswith": "{field} must start with '{param}'.",
-	"password":   "{field} must meet password criteria. Minimum 6 characters, maximum 64 characters, containing at least 1 capital characters AND 1 number AND 1 special (non-alpha-numeric) characters.",
+	"password":   "{field} must meet password criteria. {policy}",
+
+	passwordCommonTag:       "{field} is too common or has appeared in a data breach, choose one that is harder to guess.",
+	passwordPersonalInfoTag: "{field} must not contain your name or phone number.",
 }
 
 type UserRegistrationValidator struct {
@@ -24,59 +36,77 @@ func (v *UserRegistrationValidator) Validate(i interface{}) error {
 	return v.Validator.Struct(i)
 }
 
-// ValidatePassword is a custom validator to validate password based on our rules
-func ValidatePassword(f1 validator.FieldLevel) bool {
-	password := f1.Field().String()
-
-	// Length checker
-	if len(password) < 6 || len(password) > 64 {
-		return false
+// RegisterPasswordValidation registers the password tag, which checks the password follows the policy,
+// isn't a common or breached password according to the checker and doesn't contain the user's name or phone number
+func RegisterPasswordValidation(validate *validator.Validate, policy PasswordPolicy, checker *passwordcheck.Checker) error {
+	err := validate.RegisterValidation(passwordCriteriaTag, func(f1 validator.FieldLevel) bool {
+		return policy.Allows(f1.Field().String())
+	})
+	if err != nil {
+		return err
 	}
 
-	// Capital letter checker
-	var hasCapital bool
-	for _, char := range password {
-		if char >= 'A' && char <= 'Z' {
-			hasCapital = true
-			break
-		}
+	err = validate.RegisterValidation(passwordCommonTag, func(f1 validator.FieldLevel) bool {
+		return !checker.IsCommon(f1.Field().String())
+	})
+	if err != nil {
+		return err
 	}
 
-	if !hasCapital {
-		return false
+	err = validate.RegisterValidation(passwordPersonalInfoTag, ValidatePasswordPersonalInfo)
+	if err != nil {
+		return err
 	}
 
-	// Numeric checker
-	var hasNumber bool
-	for _, char := range password {
-		if char >= '0' && char <= '9' {
-			hasNumber = true
-			break
-		}
-	}
-	if !hasNumber {
-		return false
+	validate.RegisterAlias("password", strings.Join([]string{passwordCriteriaTag, passwordCommonTag, passwordPersonalInfoTag}, ","))
+	return nil
+}
+
+// ValidatePasswordPersonalInfo is a custom validator rejecting passwords containing the user's name or phone number,
+// taken from the FullName and PhoneNumber fields of the same struct when it has them
+func ValidatePasswordPersonalInfo(f1 validator.FieldLevel) bool {
+	parent := reflect.Indirect(f1.Parent())
+	fullName, phoneNumber := stringFieldByName(parent, "FullName"), stringFieldByName(parent, "PhoneNumber")
+
+	return !passwordcheck.ContainsPersonalInfo(f1.Field().String(), fullName, phoneNumber)
+}
+
+func stringFieldByName(v reflect.Value, name string) string {
+	if v.Kind() != reflect.Struct {
+		return ""
 	}
 
-	// Non-Alphanumeric checker
-	specialCharacterRegex := regexp.MustCompile(`[^a-zA-Z0-9]`)
-	if !specialCharacterRegex.MatchString(password) {
-		return false
+	field := reflect.Indirect(v.FieldByName(name))
+	if field.Kind() != reflect.String {
+		return ""
 	}
 
-	return true
+	return field.String()
 }
 
-// TranslateErrorMessages returns list of human-readable error messages
-func TranslateErrorMessages(errs []validator.FieldError) []string {
+// passwordOfUser carries a new password along with the details of the user, for the requests which don't have them
+type passwordOfUser struct {
+	Password    string `validate:"password_personal_info"`
+	FullName    string
+	PhoneNumber string
+}
+
+// TranslateErrorMessages returns list of human-readable error messages, describing the password policy when needed
+func TranslateErrorMessages(errs []validator.FieldError, policy PasswordPolicy) []string {
 	var messages []string
 
 	for _, err := range errs {
 		field, param, tagName := err.Field(), err.Param(), err.Tag()
-		message := validationErrorMessages[tagName]
+
+		// The tags behind an alias may have a more precise message
+		message, ok := validationErrorMessages[err.ActualTag()]
+		if !ok {
+			message = validationErrorMessages[tagName]
+		}
 
 		message = strings.ReplaceAll(message, "{field}", field)
 		message = strings.ReplaceAll(message, "{param}", param)
+		message = strings.ReplaceAll(message, "{policy}", policy.Description())
 
 		messages = append(messages, message)
 	}
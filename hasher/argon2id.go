@@ -0,0 +1,102 @@
+package hasher
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2idHasher hashes passwords with Argon2id, encoded in the PHC string format,
+// e.g. "$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>" with unpadded base64 salt and hash
+type Argon2idHasher struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+const argon2idPrefix = "$argon2id$"
+
+var argon2idEncoding = base64.RawStdEncoding
+
+func (h Argon2idHasher) Hash(_ context.Context, password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2idPrefix, argon2.Version, h.Memory, h.Iterations,
+		h.Parallelism, argon2idEncoding.EncodeToString(salt), argon2idEncoding.EncodeToString(key)), nil
+}
+
+// Compare hashes the password again with the parameters of the encoded hash, not the configured ones
+func (h Argon2idHasher) Compare(_ context.Context, encodedHash string, password string) error {
+	decoded, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), decoded.salt, decoded.params.Iterations, decoded.params.Memory,
+		decoded.params.Parallelism, decoded.params.KeyLength)
+	if subtle.ConstantTimeCompare(key, decoded.key) != 1 {
+		return ErrMismatchedHashAndPassword
+	}
+
+	return nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encodedHash string) bool {
+	decoded, err := decodeArgon2id(encodedHash)
+	if err != nil {
+		return true
+	}
+
+	return decoded.params.Memory != h.Memory || decoded.params.Iterations != h.Iterations ||
+		decoded.params.Parallelism != h.Parallelism || decoded.params.KeyLength != h.KeyLength ||
+		uint32(len(decoded.salt)) != h.SaltLength
+}
+
+type decodedArgon2id struct {
+	params Argon2idHasher
+	salt   []byte
+	key    []byte
+}
+
+func decodeArgon2id(encodedHash string) (decoded decodedArgon2id, err error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encodedHash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return decoded, ErrInvalidHash
+	}
+
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return decoded, ErrInvalidHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.params.Memory, &decoded.params.Iterations,
+		&decoded.params.Parallelism)
+	if err != nil || decoded.params.Iterations == 0 || decoded.params.Parallelism == 0 {
+		return decoded, ErrInvalidHash
+	}
+
+	if decoded.salt, err = argon2idEncoding.DecodeString(parts[4]); err != nil {
+		return decoded, ErrInvalidHash
+	}
+
+	if decoded.key, err = argon2idEncoding.DecodeString(parts[5]); err != nil || len(decoded.key) == 0 {
+		return decoded, ErrInvalidHash
+	}
+
+	decoded.params.SaltLength = uint32(len(decoded.salt))
+	decoded.params.KeyLength = uint32(len(decoded.key))
+	return decoded, nil
+}
@@ -0,0 +1,68 @@
+package hasher
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	ctx := context.Background()
+
+	h := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	encodedHash, err := h.Hash(ctx, "correctPassword123!")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\$argon2id\$v=19\$m=64,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`, encodedHash)
+
+	t.Run("compare", func(t *testing.T) {
+		assert.NoError(t, h.Compare(ctx, encodedHash, "correctPassword123!"))
+		assert.Equal(t, ErrMismatchedHashAndPassword, h.Compare(ctx, encodedHash, "haguUruna123!"))
+
+		// Salted, so the same password never hashes the same
+		otherHash, _ := h.Hash(ctx, "correctPassword123!")
+		assert.NotEqual(t, encodedHash, otherHash)
+	})
+
+	t.Run("compare with the parameters of the hash", func(t *testing.T) {
+		stronger := Argon2idHasher{Memory: 128, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+		assert.NoError(t, stronger.Compare(ctx, encodedHash, "correctPassword123!"))
+	})
+
+	t.Run("reference hash", func(t *testing.T) {
+		// Test vector of golang.org/x/crypto/argon2, salted with "somesalt"
+		reference := "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7"
+		assert.NoError(t, h.Compare(ctx, reference, "password"))
+	})
+
+	t.Run("invalid hashes", func(t *testing.T) {
+		for _, invalidHash := range []string{
+			"",
+			"$argon2i$v=19$m=64,t=1,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=16$m=64,t=1,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=64,t=0,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ=$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8",
+			"$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$",
+			strings.TrimSuffix(encodedHash, "$"+strings.Split(encodedHash, "$")[5]),
+		} {
+			assert.Equal(t, ErrInvalidHash, h.Compare(ctx, invalidHash, "password"), invalidHash)
+			assert.True(t, h.NeedsRehash(invalidHash), invalidHash)
+		}
+	})
+
+	t.Run("needs rehash", func(t *testing.T) {
+		assert.False(t, h.NeedsRehash(encodedHash))
+
+		for _, changed := range []Argon2idHasher{
+			{Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+			{Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+			{Memory: 64, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+			{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 32, KeyLength: 32},
+			{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64},
+		} {
+			assert.True(t, changed.NeedsRehash(encodedHash), changed)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package hasher
+
+import (
+	"context"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptHasher hashes passwords with bcrypt, encoded in its usual modular crypt format, e.g. "$2a$10$..."
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(_ context.Context, password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Compare(_ context.Context, encodedHash string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encodedHash), []byte(password))
+	if err != nil && err != bcrypt.ErrMismatchedHashAndPassword {
+		return ErrInvalidHash
+	}
+
+	return err
+}
+
+func (h BcryptHasher) NeedsRehash(encodedHash string) bool {
+	cost, err := bcrypt.Cost([]byte(encodedHash))
+	return err != nil || cost != h.Cost
+}
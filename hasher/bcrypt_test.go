@@ -0,0 +1,31 @@
+package hasher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	ctx := context.Background()
+
+	h := BcryptHasher{Cost: bcrypt.MinCost}
+
+	encodedHash, err := h.Hash(ctx, "correctPassword123!")
+	assert.NoError(t, err)
+	assert.Regexp(t, `^\$2a\$04\$`, encodedHash)
+
+	t.Run("compare", func(t *testing.T) {
+		assert.NoError(t, h.Compare(ctx, encodedHash, "correctPassword123!"))
+		assert.Equal(t, ErrMismatchedHashAndPassword, h.Compare(ctx, encodedHash, "haguUruna123!"))
+		assert.Equal(t, ErrInvalidHash, h.Compare(ctx, "$2a$04$short", "correctPassword123!"))
+	})
+
+	t.Run("needs rehash", func(t *testing.T) {
+		assert.False(t, h.NeedsRehash(encodedHash))
+		assert.True(t, BcryptHasher{Cost: bcrypt.MinCost + 1}.NeedsRehash(encodedHash))
+		assert.True(t, h.NeedsRehash("not a hash"))
+	})
+}
@@ -0,0 +1,15 @@
+package hasher
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// Same error as bcrypt, whatever the algorithm of the hash
+	ErrMismatchedHashAndPassword = bcrypt.ErrMismatchedHashAndPassword
+
+	ErrInvalidHash          = errors.New("invalid password hash")
+	ErrUnsupportedAlgorithm = errors.New("unsupported password hashing algorithm")
+)
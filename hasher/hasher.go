@@ -0,0 +1,140 @@
+package hasher
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// Default Argon2id parameters, as recommended by OWASP
+const (
+	defaultArgon2idMemory      = 19 * 1024
+	defaultArgon2idIterations  = 2
+	defaultArgon2idParallelism = 1
+	defaultArgon2idSaltLength  = 16
+	defaultArgon2idKeyLength   = 32
+)
+
+// Hasher hashes new passwords with the configured algorithm, while still checking the hashes of every
+// supported algorithm. Hashes of another algorithm or with other parameters need a rehash.
+type Hasher struct {
+	Algorithm string
+	Bcrypt    BcryptHasher
+	Argon2id  Argon2idHasher
+
+	// Told how long every hash or compare took, if set
+	Observe ObserveFunc
+}
+
+// ObserveFunc is told the algorithm, the operation, either "hash" or "compare", and how long it took
+type ObserveFunc func(algorithm string, operation string, duration time.Duration)
+
+type NewHasherOptions struct {
+	// Algorithm of the new hashes, Argon2id by default
+	Algorithm string
+
+	BcryptCost int
+
+	Argon2idMemory      uint32
+	Argon2idIterations  uint32
+	Argon2idParallelism uint8
+
+	Observe ObserveFunc
+}
+
+func NewHasher(opts NewHasherOptions) (*Hasher, error) {
+	// Fallback to the defaults for everything not supplied
+	if opts.Algorithm == "" {
+		opts.Algorithm = AlgorithmArgon2id
+	}
+
+	if opts.Algorithm != AlgorithmBcrypt && opts.Algorithm != AlgorithmArgon2id {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	if opts.BcryptCost == 0 {
+		opts.BcryptCost = bcrypt.DefaultCost
+	}
+
+	if opts.Argon2idMemory == 0 {
+		opts.Argon2idMemory = defaultArgon2idMemory
+	}
+
+	if opts.Argon2idIterations == 0 {
+		opts.Argon2idIterations = defaultArgon2idIterations
+	}
+
+	if opts.Argon2idParallelism == 0 {
+		opts.Argon2idParallelism = defaultArgon2idParallelism
+	}
+
+	return &Hasher{
+		Algorithm: opts.Algorithm,
+		Bcrypt:    BcryptHasher{Cost: opts.BcryptCost},
+		Argon2id: Argon2idHasher{
+			Memory:      opts.Argon2idMemory,
+			Iterations:  opts.Argon2idIterations,
+			Parallelism: opts.Argon2idParallelism,
+			SaltLength:  defaultArgon2idSaltLength,
+			KeyLength:   defaultArgon2idKeyLength,
+		},
+		Observe: opts.Observe,
+	}, nil
+}
+
+func (h *Hasher) Hash(ctx context.Context, password string) (string, error) {
+	defer h.observe(h.Algorithm, "hash", time.Now())
+	return h.byAlgorithm(h.Algorithm).Hash(ctx, password)
+}
+
+func (h *Hasher) Compare(ctx context.Context, encodedHash string, password string) error {
+	algorithm := identify(encodedHash)
+	algorithmHasher := h.byAlgorithm(algorithm)
+	if algorithmHasher == nil {
+		return ErrUnsupportedAlgorithm
+	}
+
+	defer h.observe(algorithm, "compare", time.Now())
+	return algorithmHasher.Compare(ctx, encodedHash, password)
+}
+
+func (h *Hasher) observe(algorithm string, operation string, start time.Time) {
+	if h.Observe != nil {
+		h.Observe(algorithm, operation, time.Since(start))
+	}
+}
+
+func (h *Hasher) NeedsRehash(encodedHash string) bool {
+	return identify(encodedHash) != h.Algorithm || h.byAlgorithm(h.Algorithm).NeedsRehash(encodedHash)
+}
+
+func (h *Hasher) byAlgorithm(algorithm string) PasswordHasher {
+	switch algorithm {
+	case AlgorithmBcrypt:
+		return h.Bcrypt
+	case AlgorithmArgon2id:
+		return h.Argon2id
+	default:
+		return nil
+	}
+}
+
+// identify returns the algorithm of the encoded hash, from its prefix
+func identify(encodedHash string) string {
+	switch {
+	case strings.HasPrefix(encodedHash, argon2idPrefix):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(encodedHash, "$2a$"), strings.HasPrefix(encodedHash, "$2b$"),
+		strings.HasPrefix(encodedHash, "$2y$"):
+		return AlgorithmBcrypt
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,85 @@
+package hasher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestNewHasher(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		h, err := NewHasher(NewHasherOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, AlgorithmArgon2id, h.Algorithm)
+		assert.Equal(t, bcrypt.DefaultCost, h.Bcrypt.Cost)
+		assert.Equal(t, Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+			h.Argon2id)
+	})
+
+	t.Run("unsupported algorithm", func(t *testing.T) {
+		_, err := NewHasher(NewHasherOptions{Algorithm: "md5"})
+		assert.Equal(t, ErrUnsupportedAlgorithm, err)
+	})
+}
+
+func TestHasher(t *testing.T) {
+	var (
+		ctx = context.Background()
+
+		bcryptHasher, _   = NewHasher(NewHasherOptions{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost})
+		argon2idHasher, _ = NewHasher(NewHasherOptions{Algorithm: AlgorithmArgon2id, Argon2idMemory: 64,
+			Argon2idIterations: 1, BcryptCost: bcrypt.MinCost})
+
+		bcryptHash, _   = bcryptHasher.Hash(ctx, "correctPassword123!")
+		argon2idHash, _ = argon2idHasher.Hash(ctx, "correctPassword123!")
+	)
+
+	t.Run("hash with the configured algorithm", func(t *testing.T) {
+		assert.Equal(t, AlgorithmBcrypt, identify(bcryptHash))
+		assert.Equal(t, AlgorithmArgon2id, identify(argon2idHash))
+	})
+
+	t.Run("compare hashes of every algorithm", func(t *testing.T) {
+		for _, h := range []*Hasher{bcryptHasher, argon2idHasher} {
+			assert.NoError(t, h.Compare(ctx, bcryptHash, "correctPassword123!"))
+			assert.NoError(t, h.Compare(ctx, argon2idHash, "correctPassword123!"))
+			assert.Equal(t, ErrMismatchedHashAndPassword, h.Compare(ctx, bcryptHash, "haguUruna123!"))
+			assert.Equal(t, ErrMismatchedHashAndPassword, h.Compare(ctx, argon2idHash, "haguUruna123!"))
+			assert.Equal(t, ErrUnsupportedAlgorithm, h.Compare(ctx, "plain text", "plain text"))
+		}
+	})
+
+	t.Run("needs rehash", func(t *testing.T) {
+		assert.False(t, bcryptHasher.NeedsRehash(bcryptHash))
+		assert.True(t, bcryptHasher.NeedsRehash(argon2idHash))
+		assert.False(t, argon2idHasher.NeedsRehash(argon2idHash))
+		assert.True(t, argon2idHasher.NeedsRehash(bcryptHash))
+		assert.True(t, argon2idHasher.NeedsRehash("plain text"))
+
+		// Same algorithm, other parameters
+		strongerBcryptHasher, _ := NewHasher(NewHasherOptions{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost + 1})
+		assert.True(t, strongerBcryptHasher.NeedsRehash(bcryptHash))
+	})
+
+	t.Run("observed", func(t *testing.T) {
+		var observed []string
+		h, _ := NewHasher(NewHasherOptions{
+			Algorithm:  AlgorithmBcrypt,
+			BcryptCost: bcrypt.MinCost,
+			Observe: func(algorithm string, operation string, duration time.Duration) {
+				assert.Positive(t, duration)
+				observed = append(observed, algorithm+" "+operation)
+			},
+		})
+
+		_, _ = h.Hash(ctx, "correctPassword123!")
+		_ = h.Compare(ctx, argon2idHash, "correctPassword123!")
+		_ = h.Compare(ctx, "plain text", "plain text")
+
+		// Unsupported hashes aren't compared at all
+		assert.Equal(t, []string{"bcrypt hash", "argon2id compare"}, observed)
+	})
+}
@@ -0,0 +1,15 @@
+package hasher
+
+import "context"
+
+// PasswordHasher hashes passwords into encoded hashes carrying their algorithm and parameters,
+// so they can still be checked after the configuration changes
+type PasswordHasher interface {
+	Hash(ctx context.Context, password string) (encodedHash string, err error)
+
+	// Compare returns ErrMismatchedHashAndPassword when the password doesn't match the hash
+	Compare(ctx context.Context, encodedHash string, password string) (err error)
+
+	// NeedsRehash tells whether the hash was made with another algorithm or other parameters than configured
+	NeedsRehash(encodedHash string) bool
+}
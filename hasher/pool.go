@@ -0,0 +1,98 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+)
+
+// ErrBusy is returned right away when the queue of the pool is full
+var ErrBusy = errors.New("too many passwords being hashed, try again later")
+
+// Pool bounds how many passwords are hashed or compared at once, so a burst of logins can't take every core.
+// Up to QueueSize more callers wait for a free worker, the following ones get ErrBusy without waiting.
+type Pool struct {
+	PasswordHasher PasswordHasher
+	QueueSize      int64
+
+	workers chan struct{}
+	waiting atomic.Int64
+}
+
+type NewPoolOptions struct {
+	// Passwords hashed at once, half of the available cores by default
+	Workers int
+
+	// Callers waiting for a worker, four times the workers by default
+	QueueSize int
+}
+
+func NewPool(passwordHasher PasswordHasher, opts NewPoolOptions) *Pool {
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.GOMAXPROCS(0) / 2
+		if opts.Workers == 0 {
+			opts.Workers = 1
+		}
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 4 * opts.Workers
+	}
+
+	return &Pool{
+		PasswordHasher: passwordHasher,
+		QueueSize:      int64(opts.QueueSize),
+		workers:        make(chan struct{}, opts.Workers),
+	}
+}
+
+func (p *Pool) Hash(ctx context.Context, password string) (encodedHash string, err error) {
+	if err = p.acquire(ctx); err != nil {
+		return "", err
+	}
+
+	defer p.release()
+	return p.PasswordHasher.Hash(ctx, password)
+}
+
+func (p *Pool) Compare(ctx context.Context, encodedHash string, password string) (err error) {
+	if err = p.acquire(ctx); err != nil {
+		return err
+	}
+
+	defer p.release()
+	return p.PasswordHasher.Compare(ctx, encodedHash, password)
+}
+
+// NeedsRehash only parses the hash, it doesn't need a worker
+func (p *Pool) NeedsRehash(encodedHash string) bool {
+	return p.PasswordHasher.NeedsRehash(encodedHash)
+}
+
+// acquire waits for a free worker, unless the queue is full or the context is done first
+func (p *Pool) acquire(ctx context.Context) error {
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if p.waiting.Add(1) > p.QueueSize {
+		p.waiting.Add(-1)
+		return ErrBusy
+	}
+
+	defer p.waiting.Add(-1)
+
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	<-p.workers
+}
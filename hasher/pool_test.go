@@ -0,0 +1,99 @@
+package hasher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHasher holds every call until unblocked, counting the calls running at once
+type blockingHasher struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	unblock chan struct{}
+	started chan struct{}
+}
+
+func (h *blockingHasher) Hash(ctx context.Context, password string) (string, error) {
+	return password, h.Compare(ctx, password, password)
+}
+
+func (h *blockingHasher) Compare(context.Context, string, string) error {
+	h.mu.Lock()
+	h.running++
+	if h.running > h.peak {
+		h.peak = h.running
+	}
+	h.mu.Unlock()
+
+	h.started <- struct{}{}
+	<-h.unblock
+
+	h.mu.Lock()
+	h.running--
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *blockingHasher) NeedsRehash(string) bool {
+	return false
+}
+
+func TestNewPool(t *testing.T) {
+	pool := NewPool(&blockingHasher{}, NewPoolOptions{})
+	assert.GreaterOrEqual(t, cap(pool.workers), 1)
+	assert.Equal(t, int64(4*cap(pool.workers)), pool.QueueSize)
+}
+
+func TestPool(t *testing.T) {
+	var (
+		ctx            = context.Background()
+		blockingHasher = &blockingHasher{unblock: make(chan struct{}), started: make(chan struct{}, 10)}
+		pool           = NewPool(blockingHasher, NewPoolOptions{Workers: 2, QueueSize: 1})
+
+		wg sync.WaitGroup
+	)
+
+	// Two running and one waiting
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pool.Compare(ctx, "hash", "password"))
+		}()
+	}
+
+	<-blockingHasher.started
+	<-blockingHasher.started
+	assert.Eventually(t, func() bool { return pool.waiting.Load() == 1 }, time.Second, time.Millisecond)
+
+	t.Run("queue full", func(t *testing.T) {
+		_, err := pool.Hash(ctx, "password")
+		assert.Equal(t, ErrBusy, err)
+		assert.Equal(t, ErrBusy, pool.Compare(ctx, "hash", "password"))
+	})
+
+	t.Run("needs rehash doesn't wait", func(t *testing.T) {
+		assert.False(t, pool.NeedsRehash("hash"))
+	})
+
+	// Let every call through
+	close(blockingHasher.unblock)
+	wg.Wait()
+	assert.Equal(t, 2, blockingHasher.peak)
+
+	t.Run("context done while waiting", func(t *testing.T) {
+		pool := NewPool(blockingHasher, NewPoolOptions{Workers: 1, QueueSize: 1})
+		pool.workers <- struct{}{}
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		assert.Equal(t, context.Canceled, pool.Compare(cancelledCtx, "hash", "password"))
+		assert.Equal(t, int64(0), pool.waiting.Load())
+	})
+}
@@ -0,0 +1,24 @@
+package lifecycle
+
+import (
+	"context"
+	"time"
+)
+
+// RunPruner calls prune every interval until the context is cancelled, e.g. to remove the expired entries of a store.
+// Errors are handed to onError so the caller can decide how to log them.
+func RunPruner(ctx context.Context, interval time.Duration, prune func(context.Context) error, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := prune(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
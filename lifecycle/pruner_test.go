@@ -0,0 +1,62 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPruner(t *testing.T) {
+	t.Run("prunes until cancelled", func(t *testing.T) {
+		var calls atomic.Int32
+		prune := func(_ context.Context) error {
+			calls.Add(1)
+			return nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			RunPruner(ctx, time.Millisecond, prune, nil)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool {
+			return calls.Load() >= 2
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		<-done
+
+		stopped := calls.Load()
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, stopped, calls.Load())
+	})
+
+	t.Run("errors are reported", func(t *testing.T) {
+		prune := func(_ context.Context) error {
+			return errors.New("error")
+		}
+		errs := make(chan error, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go RunPruner(ctx, time.Millisecond, prune, func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		})
+
+		select {
+		case err := <-errs:
+			assert.EqualError(t, err, "error")
+		case <-time.After(time.Second):
+			t.Fatal("expected pruner error")
+		}
+	})
+}
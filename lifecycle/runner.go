@@ -0,0 +1,113 @@
+// Package lifecycle runs the HTTP server until the process is told to stop, then shuts it down
+// without cutting the requests in flight.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// Runner serves the requests until its context is done. Shutting down goes through, in order:
+//
+//   - failing the readiness, so the load balancers stop sending new requests
+//   - waiting DrainDelay for them to notice
+//   - closing the listener and waiting up to ShutdownTimeout for the requests in flight
+//   - closing the Closers, e.g. the database pool the requests were using
+type Runner struct {
+	Echo            *echo.Echo
+	ShutdownTimeout time.Duration
+	DrainDelay      time.Duration
+	Closers         []io.Closer
+
+	ready atomic.Bool
+}
+
+type NewRunnerOptions struct {
+	Echo *echo.Echo
+
+	// 30 seconds by default
+	ShutdownTimeout time.Duration
+
+	// No delay by default, it should be longer than the interval the load balancers check the readiness at
+	DrainDelay time.Duration
+
+	// Closed in order once the server is down
+	Closers []io.Closer
+}
+
+func NewRunner(opts NewRunnerOptions) *Runner {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	return &Runner{
+		Echo:            opts.Echo,
+		ShutdownTimeout: opts.ShutdownTimeout,
+		DrainDelay:      opts.DrainDelay,
+		Closers:         opts.Closers,
+	}
+}
+
+// Ready tells whether the server accepts new requests, it stops being ready as soon as the shutdown starts
+func (r *Runner) Ready() bool {
+	return r.ready.Load()
+}
+
+// Run listens on the address until the context is done, then shuts down. The error is the first one met,
+// either starting the server, waiting for the requests in flight or closing the Closers.
+func (r *Runner) Run(ctx context.Context, address string) (err error) {
+	// Bound first, so the server is only ready once it accepts connections
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return r.close(err)
+	}
+
+	r.Echo.Listener = listener
+	started := make(chan error, 1)
+	go func() {
+		started <- r.Echo.Start(address)
+	}()
+
+	r.ready.Store(true)
+	select {
+	case err = <-started:
+		r.ready.Store(false)
+		return r.close(err)
+	case <-ctx.Done():
+	}
+
+	r.ready.Store(false)
+	if r.DrainDelay > 0 {
+		time.Sleep(r.DrainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), r.ShutdownTimeout)
+	defer cancel()
+
+	// Start returns as soon as the listener is closed, Shutdown once the requests are done
+	err = r.Echo.Shutdown(shutdownCtx)
+	if startErr := <-started; err == nil && !errors.Is(startErr, http.ErrServerClosed) {
+		err = startErr
+	}
+
+	return r.close(err)
+}
+
+func (r *Runner) close(err error) error {
+	for _, closer := range r.Closers {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
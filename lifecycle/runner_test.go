@@ -0,0 +1,211 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCloser struct {
+	closed bool
+	err    error
+}
+
+func (c *fakeCloser) Close() error {
+	c.closed = true
+	return c.err
+}
+
+// startTestRunner runs a server whose /slow route blocks until release is closed, signaling entered first
+func startTestRunner(t *testing.T, opts NewRunnerOptions) (runner *Runner, url string, entered chan struct{}, release chan struct{}, cancel context.CancelFunc, done chan error) {
+	entered = make(chan struct{}, 1)
+	release = make(chan struct{})
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/slow", func(ctx echo.Context) error {
+		entered <- struct{}{}
+		<-release
+		return ctx.String(http.StatusOK, "done")
+	})
+
+	opts.Echo = e
+	runner = NewRunner(opts)
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	done = make(chan error, 1)
+	go func() {
+		done <- runner.Run(ctx, "127.0.0.1:0")
+	}()
+
+	// Listening as soon as it's ready
+	assert.Eventually(t, runner.Ready, time.Second, time.Millisecond)
+	assert.NotNil(t, e.ListenerAddr())
+	return runner, "http://" + e.ListenerAddr().String() + "/slow", entered, release, cancel, done
+}
+
+func TestRunner_Run(t *testing.T) {
+	t.Run("in-flight request completes during shutdown", func(t *testing.T) {
+		closer := &fakeCloser{}
+		runner, url, entered, release, cancel, done := startTestRunner(t, NewRunnerOptions{Closers: []io.Closer{closer}})
+		assert.True(t, runner.Ready())
+
+		type result struct {
+			status int
+			body   string
+			err    error
+		}
+		responses := make(chan result, 1)
+		go func() {
+			resp, err := http.Get(url)
+			if err != nil {
+				responses <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			responses <- result{status: resp.StatusCode, body: string(body), err: err}
+		}()
+
+		<-entered
+		cancel()
+
+		// Not ready anymore and no longer accepting connections, but still waiting for the request
+		assert.Eventually(t, func() bool { return !runner.Ready() }, time.Second, time.Millisecond)
+		assert.Eventually(t, func() bool {
+			_, err := http.Get(url)
+			return err != nil
+		}, time.Second, time.Millisecond)
+		assert.False(t, closer.closed)
+
+		select {
+		case <-done:
+			t.Fatal("Run returned before the request completed")
+		default:
+		}
+
+		close(release)
+
+		response := <-responses
+		assert.Nil(t, response.err)
+		assert.Equal(t, http.StatusOK, response.status)
+		assert.Equal(t, "done", response.body)
+
+		assert.Nil(t, <-done)
+		assert.True(t, closer.closed)
+	})
+
+	t.Run("shutdown timeout exceeded", func(t *testing.T) {
+		closer := &fakeCloser{}
+		_, url, entered, release, cancel, done := startTestRunner(t, NewRunnerOptions{
+			ShutdownTimeout: 10 * time.Millisecond,
+			Closers:         []io.Closer{closer},
+		})
+		defer close(release)
+
+		go func() {
+			resp, err := http.Get(url)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+
+		<-entered
+		cancel()
+
+		assert.ErrorIs(t, <-done, context.DeadlineExceeded)
+		assert.True(t, closer.closed)
+	})
+
+	t.Run("drain delay keeps serving while not ready", func(t *testing.T) {
+		runner, url, entered, release, cancel, done := startTestRunner(t, NewRunnerOptions{DrainDelay: 200 * time.Millisecond})
+		close(release)
+
+		cancel()
+		assert.Eventually(t, func() bool { return !runner.Ready() }, time.Second, time.Millisecond)
+
+		resp, err := http.Get(url)
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+		<-entered
+
+		assert.Nil(t, <-done)
+	})
+
+	t.Run("closer returns error", func(t *testing.T) {
+		first, second := &fakeCloser{err: errors.New("error")}, &fakeCloser{}
+		_, _, _, release, cancel, done := startTestRunner(t, NewRunnerOptions{Closers: []io.Closer{first, second}})
+		close(release)
+
+		cancel()
+		assert.EqualError(t, <-done, "error")
+		assert.True(t, second.closed)
+	})
+
+	t.Run("server fails to start", func(t *testing.T) {
+		closer := &fakeCloser{}
+		e := echo.New()
+		e.HideBanner = true
+		runner := NewRunner(NewRunnerOptions{Echo: e, Closers: []io.Closer{closer}})
+
+		err := runner.Run(context.Background(), "invalid address")
+		assert.NotNil(t, err)
+		assert.False(t, runner.Ready())
+		assert.True(t, closer.closed)
+	})
+
+	t.Run("address in use is never ready", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Error listening: %v", err)
+		}
+		defer listener.Close()
+
+		closer := &fakeCloser{}
+		e := echo.New()
+		e.HideBanner = true
+		runner := NewRunner(NewRunnerOptions{Echo: e, Closers: []io.Closer{closer}})
+
+		var wasReady atomic.Bool
+		stop := make(chan struct{})
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					if runner.Ready() {
+						wasReady.Store(true)
+					}
+				}
+			}
+		}()
+
+		err = runner.Run(context.Background(), listener.Addr().String())
+		close(stop)
+		<-watched
+
+		assert.ErrorContains(t, err, "address already in use")
+		assert.False(t, wasReady.Load())
+		assert.True(t, closer.closed)
+	})
+}
+
+func TestNewRunner(t *testing.T) {
+	runner := NewRunner(NewRunnerOptions{})
+	assert.Equal(t, defaultShutdownTimeout, runner.ShutdownTimeout)
+}
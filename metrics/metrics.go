@@ -0,0 +1,132 @@
+// Package metrics exposes what the service is doing in the Prometheus text format: the HTTP requests,
+// the outcome of the logins and registrations, the rejected tokens, the password hashing and the database calls.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "user_service"
+
+// Buckets of the password hashing durations, hashing is meant to take tens to hundreds of milliseconds
+var passwordHashBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	// By method, route template, e.g. /user/sessions/:id, and status code
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+
+	// Logins by outcome, either success, failure or mfa_challenge, and reason, e.g. wrong_password
+	Logins *prometheus.CounterVec
+
+	// Registrations by outcome, either created, duplicate or invalid
+	Registrations *prometheus.CounterVec
+
+	// Tokens rejected by type, e.g. access, and cause, e.g. expired
+	TokenValidationFailures *prometheus.CounterVec
+
+	// By algorithm, either bcrypt or argon2id, and operation, either hash or compare
+	PasswordHashDuration *prometheus.HistogramVec
+
+	// By method of the repository, e.g. GetUserById
+	RepositoryCallDuration *prometheus.HistogramVec
+	RepositoryCallErrors   *prometheus.CounterVec
+}
+
+type NewMetricsOptions struct {
+	// Where the metrics are registered and gathered from, a new registry by default.
+	// Tests pass their own to assert on the values.
+	Registry *prometheus.Registry
+
+	// Pool whose statistics are exposed, e.g. the connections in use, if any
+	Db *sql.DB
+}
+
+func NewMetrics(opts NewMetricsOptions) *Metrics {
+	if opts.Registry == nil {
+		opts.Registry = prometheus.NewRegistry()
+	}
+
+	m := &Metrics{
+		Registry: opts.Registry,
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle the HTTP requests, by method, route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts, by outcome and reason.",
+		}, []string{"outcome", "reason"}),
+		Registrations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Registration attempts, by outcome.",
+		}, []string{"outcome"}),
+		TokenValidationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validation_failures_total",
+			Help:      "Tokens rejected, by token type and cause.",
+		}, []string{"type", "cause"}),
+		PasswordHashDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Time taken to hash or compare a password, by algorithm and operation.",
+			Buckets:   passwordHashBuckets,
+		}, []string{"algorithm", "operation"}),
+		RepositoryCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_call_duration_seconds",
+			Help:      "Time taken by the repository calls, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		RepositoryCallErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_call_errors_total",
+			Help:      "Repository calls that failed on the database, by method.",
+		}, []string{"method"}),
+	}
+
+	m.Registry.MustRegister(
+		m.HTTPRequests,
+		m.HTTPRequestDuration,
+		m.Logins,
+		m.Registrations,
+		m.TokenValidationFailures,
+		m.PasswordHashDuration,
+		m.RepositoryCallDuration,
+		m.RepositoryCallErrors,
+	)
+
+	// The pool statistics are named go_sql_*, told apart by the db_name label
+	if opts.Db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(opts.Db, namespace))
+	}
+
+	return m
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// ObservePasswordHash records how long hashing or comparing a password took, see hasher.NewHasherOptions
+func (m *Metrics) ObservePasswordHash(algorithm string, operation string, duration time.Duration) {
+	m.PasswordHashDuration.WithLabelValues(algorithm, operation).Observe(duration.Seconds())
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMetrics(t *testing.T) {
+	t.Run("injected registry", func(t *testing.T) {
+		registry := prometheus.NewRegistry()
+		m := NewMetrics(NewMetricsOptions{Registry: registry})
+
+		m.Registrations.WithLabelValues("created").Inc()
+
+		assert.Same(t, registry, m.Registry)
+		assert.Equal(t, 1, testutil.CollectAndCount(registry, "user_service_registrations_total"))
+	})
+
+	t.Run("default registry", func(t *testing.T) {
+		m := NewMetrics(NewMetricsOptions{})
+		assert.NotNil(t, m.Registry)
+	})
+
+	t.Run("database pool", func(t *testing.T) {
+		db, _, err := sqlmock.New()
+		assert.NoError(t, err)
+		defer db.Close()
+
+		m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry(), Db: db})
+
+		assert.Equal(t, 1, testutil.CollectAndCount(m.Registry, "go_sql_max_open_connections"))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.Registry, "go_sql_in_use_connections"))
+	})
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+	m.Logins.WithLabelValues("failure", "wrong_password").Inc()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, _ := io.ReadAll(rec.Body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, string(body), `user_service_logins_total{outcome="failure",reason="wrong_password"} 1`)
+}
+
+func TestMetrics_ObservePasswordHash(t *testing.T) {
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+
+	m.ObservePasswordHash("bcrypt", "hash", 80*time.Millisecond)
+	m.ObservePasswordHash("bcrypt", "compare", 70*time.Millisecond)
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.PasswordHashDuration))
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Route of the requests that didn't match any, so scanners can't create a series per path they try
+const unmatchedRoute = "unmatched"
+
+// Middleware counts and times the requests by route template rather than path, so the IDs in the paths
+// don't create a series each
+func (m *Metrics) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			// The error is only turned into a response after the middlewares, see echo.DefaultHTTPErrorHandler
+			status := ctx.Response().Status
+			if err != nil && !ctx.Response().Committed {
+				status = http.StatusInternalServerError
+
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+
+			// Echo leaves the path empty when no route matched
+			route := ctx.Path()
+			if route == "" {
+				route = unmatchedRoute
+			}
+
+			labels := []string{ctx.Request().Method, route, strconv.Itoa(status)}
+			m.HTTPRequests.WithLabelValues(labels...).Inc()
+			m.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	m := NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+
+	e := echo.New()
+	e.Use(m.Middleware())
+	e.GET("/user/sessions/:id", func(ctx echo.Context) error {
+		if ctx.Param("id") == "missing" {
+			return ctx.JSON(http.StatusNotFound, map[string]string{"message": "session not found"})
+		}
+
+		return ctx.NoContent(http.StatusOK)
+	})
+	e.GET("/forbidden", func(ctx echo.Context) error {
+		return echo.NewHTTPError(http.StatusForbidden)
+	})
+	e.GET("/broken", func(ctx echo.Context) error {
+		return errors.New("error")
+	})
+
+	serve := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	t.Run("by route template", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, serve("/user/sessions/1"))
+		assert.Equal(t, http.StatusOK, serve("/user/sessions/2"))
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(http.MethodGet, "/user/sessions/:id", "200")))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.HTTPRequestDuration))
+	})
+
+	t.Run("not found by the handler", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/user/sessions/missing"))
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(http.MethodGet, "/user/sessions/:id", "404")))
+	})
+
+	t.Run("status of the returned error", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve("/forbidden"))
+		assert.Equal(t, http.StatusInternalServerError, serve("/broken"))
+
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(http.MethodGet, "/forbidden", "403")))
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(http.MethodGet, "/broken", "500")))
+	})
+
+	t.Run("unmatched route", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/wp-admin"))
+		assert.Equal(t, http.StatusNotFound, serve("/.env"))
+
+		assert.Equal(t, float64(2), testutil.ToFloat64(m.HTTPRequests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")))
+	})
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+// instrumentedRepository times every call to the repository and counts the ones the database failed
+type instrumentedRepository struct {
+	repository repository.RepositoryInterface
+	metrics    *Metrics
+}
+
+// InstrumentRepository wraps the repository so its calls are measured by method
+func InstrumentRepository(repo repository.RepositoryInterface, m *Metrics) repository.RepositoryInterface {
+	return &instrumentedRepository{repository: repo, metrics: m}
+}
+
+// observe records the call started at start, along with its error if any. The errors the repository reports
+// by design, e.g. a user not found, aren't failures of the database and aren't counted.
+func (r *instrumentedRepository) observe(method string, start time.Time, err error) {
+	r.metrics.RepositoryCallDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil && !common.IsExpected(err) {
+		r.metrics.RepositoryCallErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (r *instrumentedRepository) GetUserByPhoneNumber(ctx context.Context, input repository.GetUserByPhoneNumberInput) (output repository.GetUserByPhoneNumberOutput, err error) {
+	defer func(start time.Time) { r.observe("GetUserByPhoneNumber", start, err) }(time.Now())
+	return r.repository.GetUserByPhoneNumber(ctx, input)
+}
+
+func (r *instrumentedRepository) GetUserById(ctx context.Context, input repository.GetUserByIdInput) (output repository.GetUserByIdOutput, err error) {
+	defer func(start time.Time) { r.observe("GetUserById", start, err) }(time.Now())
+	return r.repository.GetUserById(ctx, input)
+}
+
+func (r *instrumentedRepository) InsertUser(ctx context.Context, input repository.InsertUserInput) (err error) {
+	defer func(start time.Time) { r.observe("InsertUser", start, err) }(time.Now())
+	return r.repository.InsertUser(ctx, input)
+}
+
+func (r *instrumentedRepository) UpdateUser(ctx context.Context, input repository.UpdateUserInput) (err error) {
+	defer func(start time.Time) { r.observe("UpdateUser", start, err) }(time.Now())
+	return r.repository.UpdateUser(ctx, input)
+}
+
+func (r *instrumentedRepository) UpdateUserPassword(ctx context.Context, input repository.UpdateUserPasswordInput) (err error) {
+	defer func(start time.Time) { r.observe("UpdateUserPassword", start, err) }(time.Now())
+	return r.repository.UpdateUserPassword(ctx, input)
+}
+
+func (r *instrumentedRepository) RehashUserPassword(ctx context.Context, input repository.RehashUserPasswordInput) (err error) {
+	defer func(start time.Time) { r.observe("RehashUserPassword", start, err) }(time.Now())
+	return r.repository.RehashUserPassword(ctx, input)
+}
+
+func (r *instrumentedRepository) UpsertUserLogin(ctx context.Context, input repository.UpsertUserLoginInput) (output repository.UpsertUserLoginOutput, err error) {
+	defer func(start time.Time) { r.observe("UpsertUserLogin", start, err) }(time.Now())
+	return r.repository.UpsertUserLogin(ctx, input)
+}
+
+func (r *instrumentedRepository) RecordFailedLogin(ctx context.Context, input repository.RecordFailedLoginInput) (output repository.RecordFailedLoginOutput, err error) {
+	defer func(start time.Time) { r.observe("RecordFailedLogin", start, err) }(time.Now())
+	return r.repository.RecordFailedLogin(ctx, input)
+}
+
+func (r *instrumentedRepository) InsertLoginEvent(ctx context.Context, input repository.InsertLoginEventInput) (err error) {
+	defer func(start time.Time) { r.observe("InsertLoginEvent", start, err) }(time.Now())
+	return r.repository.InsertLoginEvent(ctx, input)
+}
+
+func (r *instrumentedRepository) ListLoginEvents(ctx context.Context, input repository.ListLoginEventsInput) (output repository.ListLoginEventsOutput, err error) {
+	defer func(start time.Time) { r.observe("ListLoginEvents", start, err) }(time.Now())
+	return r.repository.ListLoginEvents(ctx, input)
+}
+
+func (r *instrumentedRepository) InsertRefreshToken(ctx context.Context, input repository.InsertRefreshTokenInput) (err error) {
+	defer func(start time.Time) { r.observe("InsertRefreshToken", start, err) }(time.Now())
+	return r.repository.InsertRefreshToken(ctx, input)
+}
+
+func (r *instrumentedRepository) GetRefreshTokenByHash(ctx context.Context, input repository.GetRefreshTokenByHashInput) (output repository.GetRefreshTokenByHashOutput, err error) {
+	defer func(start time.Time) { r.observe("GetRefreshTokenByHash", start, err) }(time.Now())
+	return r.repository.GetRefreshTokenByHash(ctx, input)
+}
+
+func (r *instrumentedRepository) MarkRefreshTokenUsed(ctx context.Context, input repository.MarkRefreshTokenUsedInput) (err error) {
+	defer func(start time.Time) { r.observe("MarkRefreshTokenUsed", start, err) }(time.Now())
+	return r.repository.MarkRefreshTokenUsed(ctx, input)
+}
+
+func (r *instrumentedRepository) RevokeRefreshTokenFamily(ctx context.Context, input repository.RevokeRefreshTokenFamilyInput) (err error) {
+	defer func(start time.Time) { r.observe("RevokeRefreshTokenFamily", start, err) }(time.Now())
+	return r.repository.RevokeRefreshTokenFamily(ctx, input)
+}
+
+func (r *instrumentedRepository) RevokeUserRefreshTokens(ctx context.Context, input repository.RevokeUserRefreshTokensInput) (err error) {
+	defer func(start time.Time) { r.observe("RevokeUserRefreshTokens", start, err) }(time.Now())
+	return r.repository.RevokeUserRefreshTokens(ctx, input)
+}
+
+func (r *instrumentedRepository) InsertUserSession(ctx context.Context, input repository.InsertUserSessionInput) (err error) {
+	defer func(start time.Time) { r.observe("InsertUserSession", start, err) }(time.Now())
+	return r.repository.InsertUserSession(ctx, input)
+}
+
+func (r *instrumentedRepository) TouchUserSession(ctx context.Context, input repository.TouchUserSessionInput) (err error) {
+	defer func(start time.Time) { r.observe("TouchUserSession", start, err) }(time.Now())
+	return r.repository.TouchUserSession(ctx, input)
+}
+
+func (r *instrumentedRepository) ListUserSessions(ctx context.Context, input repository.ListUserSessionsInput) (output repository.ListUserSessionsOutput, err error) {
+	defer func(start time.Time) { r.observe("ListUserSessions", start, err) }(time.Now())
+	return r.repository.ListUserSessions(ctx, input)
+}
+
+func (r *instrumentedRepository) RevokeUserSession(ctx context.Context, input repository.RevokeUserSessionInput) (err error) {
+	defer func(start time.Time) { r.observe("RevokeUserSession", start, err) }(time.Now())
+	return r.repository.RevokeUserSession(ctx, input)
+}
+
+func (r *instrumentedRepository) UpsertUserMFA(ctx context.Context, input repository.UpsertUserMFAInput) (err error) {
+	defer func(start time.Time) { r.observe("UpsertUserMFA", start, err) }(time.Now())
+	return r.repository.UpsertUserMFA(ctx, input)
+}
+
+func (r *instrumentedRepository) GetUserMFA(ctx context.Context, input repository.GetUserMFAInput) (output repository.GetUserMFAOutput, err error) {
+	defer func(start time.Time) { r.observe("GetUserMFA", start, err) }(time.Now())
+	return r.repository.GetUserMFA(ctx, input)
+}
+
+func (r *instrumentedRepository) ConfirmUserMFA(ctx context.Context, input repository.ConfirmUserMFAInput) (err error) {
+	defer func(start time.Time) { r.observe("ConfirmUserMFA", start, err) }(time.Now())
+	return r.repository.ConfirmUserMFA(ctx, input)
+}
+
+func (r *instrumentedRepository) UpdateUserMFALastUsedStep(ctx context.Context, input repository.UpdateUserMFALastUsedStepInput) (err error) {
+	defer func(start time.Time) { r.observe("UpdateUserMFALastUsedStep", start, err) }(time.Now())
+	return r.repository.UpdateUserMFALastUsedStep(ctx, input)
+}
+
+func (r *instrumentedRepository) UseMFARecoveryCode(ctx context.Context, input repository.UseMFARecoveryCodeInput) (err error) {
+	defer func(start time.Time) { r.observe("UseMFARecoveryCode", start, err) }(time.Now())
+	return r.repository.UseMFARecoveryCode(ctx, input)
+}
+
+func (r *instrumentedRepository) DeleteUserMFA(ctx context.Context, input repository.DeleteUserMFAInput) (err error) {
+	defer func(start time.Time) { r.observe("DeleteUserMFA", start, err) }(time.Now())
+	return r.repository.DeleteUserMFA(ctx, input)
+}
+
+func (r *instrumentedRepository) UpsertPhoneVerification(ctx context.Context, input repository.UpsertPhoneVerificationInput) (err error) {
+	defer func(start time.Time) { r.observe("UpsertPhoneVerification", start, err) }(time.Now())
+	return r.repository.UpsertPhoneVerification(ctx, input)
+}
+
+func (r *instrumentedRepository) GetPhoneVerification(ctx context.Context, input repository.GetPhoneVerificationInput) (output repository.GetPhoneVerificationOutput, err error) {
+	defer func(start time.Time) { r.observe("GetPhoneVerification", start, err) }(time.Now())
+	return r.repository.GetPhoneVerification(ctx, input)
+}
+
+func (r *instrumentedRepository) IncrementPhoneVerificationAttempts(ctx context.Context, input repository.IncrementPhoneVerificationAttemptsInput) (err error) {
+	defer func(start time.Time) { r.observe("IncrementPhoneVerificationAttempts", start, err) }(time.Now())
+	return r.repository.IncrementPhoneVerificationAttempts(ctx, input)
+}
+
+func (r *instrumentedRepository) VerifyUserPhone(ctx context.Context, input repository.VerifyUserPhoneInput) (err error) {
+	defer func(start time.Time) { r.observe("VerifyUserPhone", start, err) }(time.Now())
+	return r.repository.VerifyUserPhone(ctx, input)
+}
+
+func (r *instrumentedRepository) UpsertPasswordReset(ctx context.Context, input repository.UpsertPasswordResetInput) (err error) {
+	defer func(start time.Time) { r.observe("UpsertPasswordReset", start, err) }(time.Now())
+	return r.repository.UpsertPasswordReset(ctx, input)
+}
+
+func (r *instrumentedRepository) GetPasswordReset(ctx context.Context, input repository.GetPasswordResetInput) (output repository.GetPasswordResetOutput, err error) {
+	defer func(start time.Time) { r.observe("GetPasswordReset", start, err) }(time.Now())
+	return r.repository.GetPasswordReset(ctx, input)
+}
+
+func (r *instrumentedRepository) IncrementPasswordResetAttempts(ctx context.Context, input repository.IncrementPasswordResetAttemptsInput) (err error) {
+	defer func(start time.Time) { r.observe("IncrementPasswordResetAttempts", start, err) }(time.Now())
+	return r.repository.IncrementPasswordResetAttempts(ctx, input)
+}
+
+func (r *instrumentedRepository) ResetUserPassword(ctx context.Context, input repository.ResetUserPasswordInput) (err error) {
+	defer func(start time.Time) { r.observe("ResetUserPassword", start, err) }(time.Now())
+	return r.repository.ResetUserPassword(ctx, input)
+}
+
+func (r *instrumentedRepository) GetPasswordHistory(ctx context.Context, input repository.GetPasswordHistoryInput) (output repository.GetPasswordHistoryOutput, err error) {
+	defer func(start time.Time) { r.observe("GetPasswordHistory", start, err) }(time.Now())
+	return r.repository.GetPasswordHistory(ctx, input)
+}
+
+func (r *instrumentedRepository) Ping(ctx context.Context) (err error) {
+	defer func(start time.Time) { r.observe("Ping", start, err) }(time.Now())
+	return r.repository.Ping(ctx)
+}
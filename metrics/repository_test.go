@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/dityuiri/UserServiceTest/common"
+	"github.com/dityuiri/UserServiceTest/repository"
+)
+
+func TestInstrumentRepository(t *testing.T) {
+	var (
+		mockCtrl       = gomock.NewController(t)
+		mockRepository = repository.NewMockRepositoryInterface(mockCtrl)
+		m              = NewMetrics(NewMetricsOptions{Registry: prometheus.NewRegistry()})
+		repo           = InstrumentRepository(mockRepository, m)
+		ctx            = context.Background()
+	)
+
+	t.Run("positive", func(t *testing.T) {
+		id := uuid.New()
+		input := repository.GetUserByIdInput{Id: id.String()}
+		expected := repository.GetUserByIdOutput{Id: id, Name: "Ditya"}
+
+		mockRepository.EXPECT().GetUserById(ctx, input).Return(expected, nil)
+
+		output, err := repo.GetUserById(ctx, input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, output)
+		assert.Equal(t, 1, testutil.CollectAndCount(m.RepositoryCallDuration))
+		assert.Equal(t, 0, testutil.CollectAndCount(m.RepositoryCallErrors))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		mockRepository.EXPECT().Ping(ctx).Return(errors.New("error"))
+
+		err := repo.Ping(ctx)
+		assert.EqualError(t, err, "error")
+		assert.Equal(t, 2, testutil.CollectAndCount(m.RepositoryCallDuration))
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.RepositoryCallErrors.WithLabelValues("Ping")))
+	})
+
+	t.Run("expected errors aren't counted", func(t *testing.T) {
+		mockRepository.EXPECT().GetUserById(ctx, gomock.Any()).Return(repository.GetUserByIdOutput{}, common.ErrUserNotFound)
+		mockRepository.EXPECT().UpdateUser(ctx, gomock.Any()).Return(common.ErrUserVersionMismatch)
+		mockRepository.EXPECT().InsertUser(ctx, gomock.Any()).Return(&common.UniqueViolationError{Constraint: "phone_number_key"})
+
+		_, err := repo.GetUserById(ctx, repository.GetUserByIdInput{})
+		assert.Equal(t, common.ErrUserNotFound, err)
+		assert.Equal(t, common.ErrUserVersionMismatch, repo.UpdateUser(ctx, repository.UpdateUserInput{}))
+		assert.Error(t, repo.InsertUser(ctx, repository.InsertUserInput{}))
+
+		// Still timed, the only error counted being the one of Ping
+		assert.Equal(t, 4, testutil.CollectAndCount(m.RepositoryCallDuration))
+		assert.Equal(t, 1, testutil.CollectAndCount(m.RepositoryCallErrors))
+	})
+}
@@ -0,0 +1,191 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0010_add_index.up.sql":      {Data: []byte("CREATE INDEX idx ON t(c);")},
+			"0010_add_index.down.sql":    {Data: []byte("DROP INDEX idx;")},
+			"0002_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c INT);")},
+			"0002_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+			"README.md":                  {Data: []byte("not a migration")},
+		}
+
+		migrations, err := Load(fsys)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 2, Name: "create_table", Up: "CREATE TABLE t (c INT);", Down: "DROP TABLE t;"},
+			{Version: 10, Name: "add_index", Up: "CREATE INDEX idx ON t(c);", Down: "DROP INDEX idx;"},
+		}, migrations)
+	})
+
+	t.Run("missing down file", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_create_table.up.sql": {Data: []byte("CREATE TABLE t (c INT);")},
+		}
+
+		_, err := Load(fsys)
+		assert.EqualError(t, err, "migration 1 needs both an up and a down file")
+	})
+
+	t.Run("invalid file name", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"create_table.sql": {Data: []byte("CREATE TABLE t (c INT);")},
+		}
+
+		_, err := Load(fsys)
+		assert.EqualError(t, err, `invalid migration file name "create_table.sql"`)
+	})
+
+	t.Run("version zero", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0000_create_table.up.sql": {Data: []byte("CREATE TABLE t (c INT);")},
+		}
+
+		_, err := Load(fsys)
+		assert.EqualError(t, err, `invalid migration version in "0000_create_table.up.sql"`)
+	})
+
+	t.Run("version used twice", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c INT);")},
+			"0001_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+			"0001_add_index.up.sql":      {Data: []byte("CREATE INDEX idx ON t(c);")},
+		}
+
+		_, err := Load(fsys)
+		assert.Error(t, err)
+	})
+}
+
+func TestEmbedded(t *testing.T) {
+	migrations, err := Embedded()
+	assert.NoError(t, err)
+
+	if assert.NotEmpty(t, migrations) {
+		assert.Equal(t, 1, migrations[0].Version)
+		assert.Equal(t, "initial", migrations[0].Name)
+		assert.Contains(t, migrations[0].Up, "CREATE TABLE IF NOT EXISTS user_master")
+		assert.Contains(t, migrations[0].Down, "DROP TABLE IF EXISTS user_master")
+	}
+}
+
+var (
+	idempotentStatementPattern = regexp.MustCompile(`^(CREATE TABLE IF NOT EXISTS|CREATE INDEX IF NOT EXISTS|` +
+		`ALTER TABLE \w+ ADD COLUMN IF NOT EXISTS|UPDATE \w+ SET \w+ = NULL) |^ALTER TABLE \w+ ALTER COLUMN \w+ DROP NOT NULL$`)
+	createTablePattern = regexp.MustCompile(`(?s)^CREATE TABLE IF NOT EXISTS (\w+) \((.*)\)$`)
+	addColumnPattern   = regexp.MustCompile(`^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+) `)
+)
+
+// statements splits the script into its statements, leaving out the comments
+func statements(script string) (statements []string) {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+
+	return
+}
+
+// applySchema records the tables and columns the script creates when they're missing from the schema
+func applySchema(schema map[string]map[string]bool, script string) {
+	for _, statement := range statements(script) {
+		if match := createTablePattern.FindStringSubmatch(statement); match != nil {
+			if schema[match[1]] != nil {
+				continue
+			}
+
+			schema[match[1]] = make(map[string]bool)
+			for _, line := range strings.Split(match[2], "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 || fields[0] == "CONSTRAINT" || fields[0] == "PRIMARY" {
+					continue
+				}
+
+				schema[match[1]][fields[0]] = true
+			}
+		} else if match = addColumnPattern.FindStringSubmatch(statement); match != nil {
+			schema[match[1]][match[2]] = true
+		}
+	}
+}
+
+func TestEmbedded_upgradeFromBaseline(t *testing.T) {
+	// The schema of database.sql, which the databases were initialized from before the migrations
+	baseline, err := os.ReadFile("testdata/database.sql")
+	if err != nil {
+		t.Fatalf("Error reading the baseline schema: %v", err)
+	}
+
+	migrations, err := Embedded()
+	if err != nil {
+		t.Fatalf("Error loading the migrations: %v", err)
+	}
+
+	t.Run("initial migration is the baseline schema", func(t *testing.T) {
+		expected := strings.Replace(string(baseline), "CREATE INDEX idx_user_phone_number",
+			"CREATE INDEX IF NOT EXISTS idx_user_phone_number", 1)
+		assert.Equal(t, statements(expected), statements(migrations[0].Up))
+	})
+
+	t.Run("only changes what's missing", func(t *testing.T) {
+		for _, migration := range migrations {
+			for _, statement := range statements(migration.Up) {
+				assert.Regexp(t, idempotentStatementPattern, statement, "migration %d", migration.Version)
+			}
+		}
+	})
+
+	t.Run("same schema as a new database", func(t *testing.T) {
+		upgraded := make(map[string]map[string]bool)
+		applySchema(upgraded, string(baseline))
+
+		created := make(map[string]map[string]bool)
+		for _, migration := range migrations {
+			applySchema(upgraded, migration.Up)
+			applySchema(created, migration.Up)
+		}
+
+		assert.Equal(t, created, upgraded)
+		assert.True(t, upgraded["user_master"]["phone_verified_at"])
+		assert.True(t, upgraded["user_master"]["version"])
+		assert.True(t, upgraded["user_login"]["failed_login"])
+		assert.True(t, upgraded["user_login"]["last_failed_login_at"])
+		assert.Contains(t, upgraded, "user_refresh_token")
+		assert.Contains(t, upgraded, "user_session")
+		assert.Contains(t, upgraded, "rate_limit")
+	})
+
+	t.Run("applies every migration to a database without any", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+		migrator.Migrations = migrations
+
+		expectLocked(mock)
+		for _, migration := range migrations {
+			expectApply(mock, migration)
+		}
+		expectUnlock(mock)
+
+		err := migrator.Up(context.Background())
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
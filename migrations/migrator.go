@@ -0,0 +1,284 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Key of the advisory lock held while migrating, so instances started together don't apply the same migration twice
+const advisoryLockKey int64 = 7_245_301_986
+
+var createTableQuery = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT       PRIMARY KEY,
+		name       TEXT      NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT now()
+	)
+`
+
+// Migrator applies and reverts the migrations, recording the applied ones in the schema_migrations table.
+// Every migration runs in its own transaction along with its record, so a failed one leaves nothing behind.
+type Migrator struct {
+	Db         *sql.DB
+	Migrations []Migration
+}
+
+type NewMigratorOptions struct {
+	Db *sql.DB
+
+	// The embedded migrations when nil
+	Migrations []Migration
+}
+
+func NewMigrator(opts NewMigratorOptions) (*Migrator, error) {
+	if opts.Migrations == nil {
+		migrations, err := Embedded()
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Migrations = migrations
+	}
+
+	return &Migrator{
+		Db:         opts.Db,
+		Migrations: opts.Migrations,
+	}, nil
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Up applies every pending migration
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.Migrations) == 0 {
+		return nil
+	}
+
+	return m.To(ctx, m.Migrations[len(m.Migrations)-1].Version)
+}
+
+// Down reverts the latest applied migration, if any
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.Migrations) - 1; i >= 0; i-- {
+			if applied[m.Migrations[i].Version] {
+				return m.run(ctx, conn, m.Migrations[i], false)
+			}
+		}
+
+		return nil
+	})
+}
+
+// To applies or reverts the migrations until the schema is at the given version, zero reverting all of them
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && !m.has(version) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// Revert the newer migrations, the latest first
+		for i := len(m.Migrations) - 1; i >= 0; i-- {
+			if migration := m.Migrations[i]; migration.Version > version && applied[migration.Version] {
+				if err = m.run(ctx, conn, migration, false); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, migration := range m.Migrations {
+			if migration.Version <= version && !applied[migration.Version] {
+				if err = m.run(ctx, conn, migration, true); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Status lists the known migrations along with the applied ones this build doesn't know about, sorted by version
+func (m *Migrator) Status(ctx context.Context) (statuses []MigrationStatus, err error) {
+	if _, err = m.Db.ExecContext(ctx, createTableQuery); err != nil {
+		return
+	}
+
+	rows, err := m.Db.QueryContext(ctx, `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		status := MigrationStatus{Applied: true}
+		if err = rows.Scan(&status.Version, &status.Name, &status.AppliedAt); err != nil {
+			return
+		}
+
+		applied[status.Version] = status
+	}
+
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for _, migration := range m.Migrations {
+		status, ok := applied[migration.Version]
+		if !ok {
+			status = MigrationStatus{Version: migration.Version}
+		}
+
+		status.Name = migration.Name
+		statuses = append(statuses, status)
+		delete(applied, migration.Version)
+	}
+
+	for _, status := range applied {
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return
+}
+
+// Verify checks the schema is at the latest version this build knows, failing when a migration is pending.
+// Unlike Status, it only reads, so it's cheap enough for a readiness check.
+func (m *Migrator) Verify(ctx context.Context) error {
+	applied, err := m.appliedVersions(ctx, m.Db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range m.Migrations {
+		if !applied[migration.Version] {
+			return fmt.Errorf("migration %04d_%s is pending", migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// querier is either the pool or one of its connections
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// locked runs fn on a connection holding the advisory lock, other instances wait for it to be done
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) (err error) {
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// The lock belongs to the session, so it has to be released on the same connection
+	if _, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return
+	}
+
+	defer func() {
+		_, unlockErr := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+		if err == nil {
+			err = unlockErr
+		}
+	}()
+
+	if _, err = conn.ExecContext(ctx, createTableQuery); err != nil {
+		return
+	}
+
+	return fn(conn)
+}
+
+// appliedVersions reads the applied migrations, failing when one of them is unknown to this build
+func (m *Migrator) appliedVersions(ctx context.Context, db querier) (applied map[int]bool, err error) {
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	applied = make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return
+		}
+
+		if !m.has(version) {
+			return nil, fmt.Errorf("applied migration %d is unknown to this build", version)
+		}
+
+		applied[version] = true
+	}
+
+	err = rows.Err()
+	return
+}
+
+// run applies or reverts the migration and records it
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, migration Migration, up bool) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	script := migration.Up
+	if !up {
+		script = migration.Down
+	}
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`,
+			migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	}
+
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (m *Migrator) has(version int) bool {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,329 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMigrations = []Migration{
+	{Version: 1, Name: "create_table", Up: "CREATE TABLE t (c INT)", Down: "DROP TABLE t"},
+	{Version: 2, Name: "add_index", Up: "CREATE INDEX idx ON t(c)", Down: "DROP INDEX idx"},
+	{Version: 3, Name: "add_column", Up: "ALTER TABLE t ADD COLUMN d INT", Down: "ALTER TABLE t DROP COLUMN d"},
+}
+
+const (
+	expectedLockQuery        = "SELECT pg_advisory_lock\\(\\$1\\)"
+	expectedUnlockQuery      = "SELECT pg_advisory_unlock\\(\\$1\\)"
+	expectedCreateTableQuery = "CREATE TABLE IF NOT EXISTS schema_migrations (.+)"
+	expectedAppliedQuery     = "SELECT version FROM schema_migrations"
+	expectedInsertQuery      = "INSERT INTO schema_migrations \\(version, name\\) VALUES (.+)"
+	expectedDeleteQuery      = "DELETE FROM schema_migrations WHERE version = (.+)"
+)
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	migrator, err := NewMigrator(NewMigratorOptions{Db: db, Migrations: testMigrations})
+	if err != nil {
+		t.Fatalf("Error creating migrator: %v", err)
+	}
+
+	return migrator, mock
+}
+
+func expectLocked(mock sqlmock.Sqlmock, appliedVersions ...int) {
+	mock.ExpectExec(expectedLockQuery).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(expectedCreateTableQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, version := range appliedVersions {
+		rows.AddRow(version)
+	}
+	mock.ExpectQuery(expectedAppliedQuery).WillReturnRows(rows)
+}
+
+func expectApply(mock sqlmock.Sqlmock, migration Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(migration.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(expectedInsertQuery).WithArgs(migration.Version, migration.Name).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func expectRevert(mock sqlmock.Sqlmock, migration Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(migration.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(expectedDeleteQuery).WithArgs(migration.Version).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(expectedUnlockQuery).WithArgs(advisoryLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestMigrator_Up(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("applies the pending migrations in order", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1)
+		expectApply(mock, testMigrations[1])
+		expectApply(mock, testMigrations[2])
+		expectUnlock(mock)
+
+		err := migrator.Up(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nothing pending", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2, 3)
+		expectUnlock(mock)
+
+		err := migrator.Up(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("migration fails", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock)
+		expectApply(mock, testMigrations[0])
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(testMigrations[1].Up)).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		expectUnlock(mock)
+
+		// The following migrations aren't applied
+		err := migrator.Up(ctx)
+		assert.EqualError(t, err, "migration 0002_add_index: error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("applied migration unknown to this build", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2, 3, 4)
+		expectUnlock(mock)
+
+		err := migrator.Up(ctx)
+		assert.EqualError(t, err, "applied migration 4 is unknown to this build")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("lock returns error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectExec(expectedLockQuery).WithArgs(advisoryLockKey).WillReturnError(errors.New("error"))
+
+		err := migrator.Up(ctx)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unlock returns error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2, 3)
+		mock.ExpectExec(expectedUnlockQuery).WithArgs(advisoryLockKey).WillReturnError(errors.New("error"))
+
+		err := migrator.Up(ctx)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Down(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reverts the latest applied migration", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2)
+		expectRevert(mock, testMigrations[1])
+		expectUnlock(mock)
+
+		err := migrator.Down(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock)
+		expectUnlock(mock)
+
+		err := migrator.Down(ctx)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("recording returns error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(testMigrations[0].Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(expectedDeleteQuery).WithArgs(1).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+		expectUnlock(mock)
+
+		err := migrator.Down(ctx)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_To(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("up to the version", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock)
+		expectApply(mock, testMigrations[0])
+		expectApply(mock, testMigrations[1])
+		expectUnlock(mock)
+
+		err := migrator.To(ctx, 2)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("down to the version, the latest first", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2, 3)
+		expectRevert(mock, testMigrations[2])
+		expectRevert(mock, testMigrations[1])
+		expectUnlock(mock)
+
+		err := migrator.To(ctx, 1)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("zero reverts everything", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		expectLocked(mock, 1, 2)
+		expectRevert(mock, testMigrations[1])
+		expectRevert(mock, testMigrations[0])
+		expectUnlock(mock)
+
+		err := migrator.To(ctx, 0)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		err := migrator.To(ctx, 5)
+		assert.EqualError(t, err, "unknown migration version 5")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Status(t *testing.T) {
+	var (
+		ctx       = context.Background()
+		appliedAt = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+		expectedStatusQuery = "SELECT version, name, applied_at FROM schema_migrations ORDER BY version"
+	)
+
+	t.Run("positive", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectExec(expectedCreateTableQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(expectedStatusQuery).WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).
+			AddRow(1, "create_table", appliedAt).
+			AddRow(4, "from_a_newer_build", appliedAt))
+
+		statuses, err := migrator.Status(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, []MigrationStatus{
+			{Version: 1, Name: "create_table", Applied: true, AppliedAt: appliedAt},
+			{Version: 2, Name: "add_index"},
+			{Version: 3, Name: "add_column"},
+			{Version: 4, Name: "from_a_newer_build", Applied: true, AppliedAt: appliedAt},
+		}, statuses)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("query context returns error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectExec(expectedCreateTableQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(expectedStatusQuery).WillReturnError(errors.New("error"))
+
+		_, err := migrator.Status(ctx)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigrator_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("up to date", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectQuery(expectedAppliedQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(2).AddRow(3))
+
+		assert.Nil(t, migrator.Verify(ctx))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("migration pending", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectQuery(expectedAppliedQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+		assert.EqualError(t, migrator.Verify(ctx), "migration 0002_add_index is pending")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("applied migration unknown to this build", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectQuery(expectedAppliedQuery).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1).AddRow(4))
+
+		assert.EqualError(t, migrator.Verify(ctx), "applied migration 4 is unknown to this build")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("query context returns error", func(t *testing.T) {
+		migrator, mock := newTestMigrator(t)
+
+		mock.ExpectQuery(expectedAppliedQuery).WillReturnError(errors.New("error"))
+
+		assert.EqualError(t, migrator.Verify(ctx), "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestNewMigrator(t *testing.T) {
+	migrator, err := NewMigrator(NewMigratorOptions{Db: &sql.DB{}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrator.Migrations)
+}
@@ -0,0 +1,19 @@
+-- The schema as it was in database.sql, with the index also created only if missing. Databases initialized from
+-- database.sql can then adopt the migrations: this one changes nothing on them and the next ones bring them up to date.
+
+CREATE TABLE IF NOT EXISTS user_master (
+    id   UUID  PRIMARY KEY,
+    phone_number VARCHAR(13) NOT NULL,
+    name VARCHAR(60) NOT NULL,
+    password_hash TEXT NOT NULL,
+
+    CONSTRAINT phone_number_key UNIQUE(phone_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_phone_number ON user_master(phone_number);
+
+CREATE TABLE IF NOT EXISTS user_login (
+    user_id         UUID   PRIMARY KEY,
+    successful_login INT   NOT NULL DEFAULT 0,
+    last_login_at    TIMESTAMP NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_refresh_token (
+    id         UUID      PRIMARY KEY,
+    user_id    UUID      NOT NULL,
+    family_id  UUID      NOT NULL,
+    token_hash TEXT      NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    used_at    TIMESTAMP,
+    revoked_at TIMESTAMP,
+
+    CONSTRAINT token_hash_key UNIQUE(token_hash)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_refresh_token_family_id ON user_refresh_token(family_id);
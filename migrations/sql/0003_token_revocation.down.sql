@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS revoked_session;
+DROP TABLE IF EXISTS revoked_user_access_token;
+DROP TABLE IF EXISTS revoked_access_token;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS revoked_access_token (
+    token_id   UUID      PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_user_access_token (
+    user_id    UUID      PRIMARY KEY,
+    revoked_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS revoked_session (
+    session_id UUID      PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_mfa_recovery_code;
+DROP TABLE IF EXISTS user_mfa;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS user_mfa (
+    user_id          UUID      PRIMARY KEY,
+    encrypted_secret TEXT      NOT NULL,
+    confirmed_at     TIMESTAMP,
+    last_used_step   BIGINT    NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS user_mfa_recovery_code (
+    user_id   UUID      NOT NULL,
+    code_hash TEXT      NOT NULL,
+    used_at   TIMESTAMP,
+
+    PRIMARY KEY (user_id, code_hash)
+);
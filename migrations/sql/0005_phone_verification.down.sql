@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_phone_verification;
+ALTER TABLE user_master DROP COLUMN IF EXISTS phone_verified_at;
@@ -0,0 +1,10 @@
+ALTER TABLE user_master ADD COLUMN IF NOT EXISTS phone_verified_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS user_phone_verification (
+    user_id      UUID        PRIMARY KEY,
+    phone_number VARCHAR(13) NOT NULL,
+    code_hash    TEXT        NOT NULL,
+    attempts     INT         NOT NULL DEFAULT 0,
+    expires_at   TIMESTAMP   NOT NULL,
+    sent_at      TIMESTAMP   NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_password_reset (
+    user_id    UUID      PRIMARY KEY,
+    code_hash  TEXT      NOT NULL,
+    attempts   INT       NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    sent_at    TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE user_login DROP COLUMN IF EXISTS last_failed_login_at;
+ALTER TABLE user_login DROP COLUMN IF EXISTS failed_login;
@@ -0,0 +1,2 @@
+ALTER TABLE user_login ADD COLUMN IF NOT EXISTS failed_login INT NOT NULL DEFAULT 0;
+ALTER TABLE user_login ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMP;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS rate_limit (
+    key            TEXT PRIMARY KEY,
+    count          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    previous_count DOUBLE PRECISION NOT NULL DEFAULT 0,
+    since          TIMESTAMP,
+    expires_at     TIMESTAMP NOT NULL
+);
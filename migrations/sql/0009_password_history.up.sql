@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_password_history (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       UUID      NOT NULL,
+    password_hash TEXT      NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_password_history_user_id ON user_password_history(user_id, id);
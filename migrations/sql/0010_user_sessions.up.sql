@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_session (
+    id           UUID      PRIMARY KEY,
+    user_id      UUID      NOT NULL,
+    user_agent   TEXT      NOT NULL,
+    ip_address   TEXT      NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT now(),
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_session_user_id ON user_session(user_id);
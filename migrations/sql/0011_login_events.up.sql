@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_login_event (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    UUID      NOT NULL,
+    successful BOOLEAN   NOT NULL,
+    reason     TEXT      NOT NULL,
+    ip_address TEXT      NOT NULL,
+    user_agent TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_login_event_user_id ON user_login_event(user_id, id);
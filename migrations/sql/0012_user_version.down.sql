@@ -0,0 +1 @@
+ALTER TABLE user_master DROP COLUMN IF EXISTS version;
@@ -0,0 +1 @@
+ALTER TABLE user_master ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
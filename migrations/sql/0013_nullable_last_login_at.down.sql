@@ -0,0 +1,3 @@
+UPDATE user_login SET last_login_at = now() WHERE last_login_at IS NULL;
+
+ALTER TABLE user_login ALTER COLUMN last_login_at SET NOT NULL;
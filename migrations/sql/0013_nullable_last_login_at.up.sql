@@ -0,0 +1,4 @@
+-- A user who has only failed to log in has no last login yet
+ALTER TABLE user_login ALTER COLUMN last_login_at DROP NOT NULL;
+
+UPDATE user_login SET last_login_at = NULL WHERE successful_login = 0;
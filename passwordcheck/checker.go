@@ -0,0 +1,95 @@
+package passwordcheck
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A run of digits of the phone number at least this long in the password gives the number away
+const minPhoneNumberDigits = 6
+
+// A part of the name at least this long in the password makes it easy to guess
+const minNamePartLength = 3
+
+// Checker rejects passwords found in any of its corpora
+type Checker struct {
+	Corpora []Corpus
+
+	// Called when a corpus can't be searched. The password is accepted then, so an unreadable file
+	// doesn't stop every user from registering.
+	OnError func(err error)
+}
+
+type NewCheckerOptions struct {
+	// Only the embedded list of common passwords by default
+	Corpora []Corpus
+	OnError func(err error)
+}
+
+func NewChecker(opts NewCheckerOptions) *Checker {
+	if len(opts.Corpora) == 0 {
+		opts.Corpora = []Corpus{DefaultListCorpus()}
+	}
+
+	if opts.OnError == nil {
+		opts.OnError = func(error) {}
+	}
+
+	return &Checker{Corpora: opts.Corpora, OnError: opts.OnError}
+}
+
+// IsCommon tells whether the password is in one of the corpora
+func (c *Checker) IsCommon(password string) bool {
+	for _, corpus := range c.Corpora {
+		found, err := corpus.Contains(password)
+		if err != nil {
+			c.OnError(err)
+			continue
+		}
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContainsPersonalInfo tells whether the password contains a part of the user's name,
+// or a run of minPhoneNumberDigits digits or more taken from the phone number
+func ContainsPersonalInfo(password string, fullName string, phoneNumber string) bool {
+	password = strings.ToLower(password)
+
+	nameParts := strings.FieldsFunc(strings.ToLower(fullName), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	for _, part := range nameParts {
+		if len([]rune(part)) >= minNamePartLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	phoneDigits := onlyDigits(phoneNumber)
+	passwordDigitRuns := strings.FieldsFunc(password, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	for _, run := range passwordDigitRuns {
+		// Any window of the run found in the phone number is enough
+		for i := 0; i+minPhoneNumberDigits <= len(run); i++ {
+			if strings.Contains(phoneDigits, run[i:i+minPhoneNumberDigits]) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,77 @@
+package passwordcheck
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingCorpus can't be searched
+type failingCorpus struct{}
+
+func (failingCorpus) Contains(string) (bool, error) {
+	return false, errors.New("error")
+}
+
+func TestChecker_IsCommon(t *testing.T) {
+	t.Run("default corpus", func(t *testing.T) {
+		checker := NewChecker(NewCheckerOptions{})
+		assert.True(t, checker.IsCommon("Password1!"))
+		assert.False(t, checker.IsCommon("Kur0mi-Ruru#7"))
+	})
+
+	t.Run("found in any corpus", func(t *testing.T) {
+		first, _ := NewListCorpus(strings.NewReader("dragon"))
+		second, _ := NewListCorpus(strings.NewReader("monkey"))
+		checker := NewChecker(NewCheckerOptions{Corpora: []Corpus{first, second}})
+
+		assert.True(t, checker.IsCommon("Dragon1!"))
+		assert.True(t, checker.IsCommon("Monkey1!"))
+		assert.False(t, checker.IsCommon("Password1!"))
+	})
+
+	t.Run("corpus returning error", func(t *testing.T) {
+		var errs []error
+		list, _ := NewListCorpus(strings.NewReader("dragon"))
+		checker := NewChecker(NewCheckerOptions{
+			Corpora: []Corpus{failingCorpus{}, list},
+			OnError: func(err error) { errs = append(errs, err) },
+		})
+
+		assert.False(t, checker.IsCommon("Kur0mi-Ruru#7"))
+		assert.True(t, checker.IsCommon("Dragon1!"))
+		assert.Len(t, errs, 2)
+	})
+}
+
+func TestContainsPersonalInfo(t *testing.T) {
+	const (
+		fullName    = "Kurumi Ruru"
+		phoneNumber = "+628788889999"
+	)
+
+	for password, expected := range map[string]bool{
+		"Kurumi123!":     true,
+		"ruru#2024X":     true,
+		"X!KURUMI!":      true,
+		"Secret878888!":  true,
+		"A+628788889999": true,
+		"Pass-889999a":   true,
+		"Kuru-mi1!":      false,
+		"Rur1!abcdE":     false,
+		"Secret8788!":    false,
+		"Tr0ub4dor&3":    false,
+	} {
+		assert.Equal(t, expected, ContainsPersonalInfo(password, fullName, phoneNumber), password)
+	}
+
+	t.Run("short name parts are ignored", func(t *testing.T) {
+		assert.False(t, ContainsPersonalInfo("Al-Bo1!xyz", "Al Bo", ""))
+	})
+
+	t.Run("no personal info", func(t *testing.T) {
+		assert.False(t, ContainsPersonalInfo("Kurumi123!", "", ""))
+	})
+}
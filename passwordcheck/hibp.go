@@ -0,0 +1,85 @@
+package passwordcheck
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Length of the SHA-1 prefix naming the range files
+const hibpPrefixLength = 5
+
+// HIBPCorpus looks passwords up in an offline copy of the Have I Been Pwned passwords, split in range files
+// the same way as the k-anonymity API: the file named after the first 5 hex characters of the SHA-1 hash
+// (e.g. 5BAA6.txt) lists the remaining 35 characters of every breached hash starting with them, as SUFFIX:COUNT lines.
+// Such a copy can be downloaded with the official haveibeenpwned-downloader.
+//
+// Unlike ListCorpus, the lookup is exact, as nearly every word has been breached in some form.
+type HIBPCorpus struct {
+	// Directory holding the range files
+	Dir string
+
+	// Passwords seen fewer times than this in breaches are accepted, 1 by default
+	MinCount int
+}
+
+type NewHIBPCorpusOptions struct {
+	Dir      string
+	MinCount int
+}
+
+func NewHIBPCorpus(opts NewHIBPCorpusOptions) (*HIBPCorpus, error) {
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, errors.New("pwned passwords location must be a directory of range files")
+	}
+
+	if opts.MinCount <= 0 {
+		opts.MinCount = 1
+	}
+
+	return &HIBPCorpus{Dir: opts.Dir, MinCount: opts.MinCount}, nil
+}
+
+func (c *HIBPCorpus) Contains(password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+	encoded := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := encoded[:hibpPrefixLength], encoded[hibpPrefixLength:]
+
+	file, err := os.Open(filepath.Join(c.Dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Every prefix has breached hashes, but the copy may be partial
+			return false, nil
+		}
+
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineSuffix, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !found || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, err
+		}
+
+		return n >= c.MinCount, nil
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package passwordcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHIBPCorpus_Contains(t *testing.T) {
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8, and of "P@ssw0rd" 21BD12DC183F740EE76F27B78EB39C8AD972A757
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"),
+		[]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "21BD1.txt"),
+		[]byte("2dc183f740ee76f27b78eb39c8ad972a757:2\n"), 0600))
+
+	corpus, err := NewHIBPCorpus(NewHIBPCorpusOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, corpus.MinCount)
+
+	t.Run("breached", func(t *testing.T) {
+		found, err := corpus.Contains("password")
+		assert.NoError(t, err)
+		assert.True(t, found)
+
+		found, err = corpus.Contains("P@ssw0rd")
+		assert.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("the lookup is exact", func(t *testing.T) {
+		found, err := corpus.Contains("Password")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("seen fewer times than the minimum", func(t *testing.T) {
+		strictCorpus, err := NewHIBPCorpus(NewHIBPCorpusOptions{Dir: dir, MinCount: 10})
+		assert.NoError(t, err)
+
+		found, err := strictCorpus.Contains("P@ssw0rd")
+		assert.NoError(t, err)
+		assert.False(t, found)
+
+		found, err = strictCorpus.Contains("password")
+		assert.NoError(t, err)
+		assert.True(t, found)
+	})
+
+	t.Run("range file is missing", func(t *testing.T) {
+		found, err := corpus.Contains("Kur0mi-Ruru#7")
+		assert.NoError(t, err)
+		assert.False(t, found)
+	})
+
+	t.Run("range file is malformed", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "21BD1.txt"),
+			[]byte("2DC183F740EE76F27B78EB39C8AD972A757:many\n"), 0600))
+
+		_, err := corpus.Contains("P@ssw0rd")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewHIBPCorpus(t *testing.T) {
+	t.Run("directory doesn't exist", func(t *testing.T) {
+		_, err := NewHIBPCorpus(NewHIBPCorpusOptions{Dir: filepath.Join(t.TempDir(), "missing")})
+		assert.Error(t, err)
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+		assert.NoError(t, os.WriteFile(path, nil, 0600))
+
+		_, err := NewHIBPCorpus(NewHIBPCorpusOptions{Dir: path})
+		assert.Error(t, err)
+	})
+}
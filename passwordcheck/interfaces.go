@@ -0,0 +1,6 @@
+package passwordcheck
+
+// Corpus is a collection of passwords that must not be used, because they're too common or known to be breached
+type Corpus interface {
+	Contains(password string) (found bool, err error)
+}
@@ -0,0 +1,84 @@
+package passwordcheck
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// A short list of the most common passwords, used when no other list is configured
+//
+//go:embed common_passwords.txt
+var defaultCommonPasswords []byte
+
+// ListCorpus holds a list of common passwords in memory, such as a top-N list.
+// The comparison ignores the case and the digits and symbols around the password,
+// so "Password1!" is found as well as "password".
+type ListCorpus struct {
+	passwords map[string]struct{}
+}
+
+// NewListCorpus reads one password per line. Empty lines and lines starting with # are skipped.
+func NewListCorpus(reader io.Reader) (*ListCorpus, error) {
+	corpus := &ListCorpus{passwords: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		corpus.passwords[strings.ToLower(line)] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return corpus, nil
+}
+
+// LoadListCorpus reads the list from a file
+func LoadListCorpus(path string) (*ListCorpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return NewListCorpus(file)
+}
+
+// DefaultListCorpus returns the corpus of the embedded list
+func DefaultListCorpus() *ListCorpus {
+	corpus, err := NewListCorpus(bytes.NewReader(defaultCommonPasswords))
+	if err != nil {
+		panic(err)
+	}
+
+	return corpus
+}
+
+func (c *ListCorpus) Contains(password string) (bool, error) {
+	password = strings.ToLower(password)
+	if _, ok := c.passwords[password]; ok {
+		return true, nil
+	}
+
+	// Capitalizing a common password and adding a digit and a symbol around it doesn't make it any less common
+	base := strings.TrimFunc(password, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	_, ok := c.passwords[base]
+	return ok && base != "", nil
+}
+
+func (c *ListCorpus) Len() int {
+	return len(c.passwords)
+}
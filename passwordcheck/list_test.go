@@ -0,0 +1,64 @@
+package passwordcheck
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListCorpus_Contains(t *testing.T) {
+	corpus, err := NewListCorpus(strings.NewReader("# comment\n\npassword\nDragon\n  sunshine  \n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, corpus.Len())
+
+	for password, expected := range map[string]bool{
+		"password":         true,
+		"PASSWORD":         true,
+		"Password1!":       true,
+		"!!Dragon2024":     true,
+		"sunshine":         true,
+		"Pass word1!":      false,
+		"Passwords1!":      false,
+		"Sun-shine1!":      false,
+		"# comment":        false,
+		"":                 false,
+		"123!":             false,
+		"Tr0ub4dor&3Horse": false,
+	} {
+		found, err := corpus.Contains(password)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found, password)
+	}
+}
+
+func TestLoadListCorpus(t *testing.T) {
+	t.Run("positive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "passwords.txt")
+		assert.NoError(t, os.WriteFile(path, []byte("letmein\nwelcome\n"), 0600))
+
+		corpus, err := LoadListCorpus(path)
+		assert.NoError(t, err)
+
+		found, _ := corpus.Contains("Welcome1!")
+		assert.True(t, found)
+	})
+
+	t.Run("negative - file doesn't exist", func(t *testing.T) {
+		_, err := LoadListCorpus(filepath.Join(t.TempDir(), "missing.txt"))
+		assert.Error(t, err)
+	})
+}
+
+func TestDefaultListCorpus(t *testing.T) {
+	corpus := DefaultListCorpus()
+	assert.Greater(t, corpus.Len(), 100)
+
+	found, _ := corpus.Contains("Password1!")
+	assert.True(t, found)
+
+	found, _ = corpus.Contains("Kur0mi-Ruru#7")
+	assert.False(t, found)
+}
@@ -0,0 +1,20 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps the state of every rate limited key and applies the algorithm to it atomically
+type Store interface {
+	Take(ctx context.Context, input TakeInput) (result Result, err error)
+	PruneExpired(ctx context.Context) (err error)
+}
+
+// Algorithm decides whether a request is allowed, given the state stored for its key
+type Algorithm interface {
+	Take(state State, now time.Time) (next State, result Result)
+
+	// Policy describes the quota in the RateLimit-Policy header format, e.g. "10;w=60"
+	Policy() string
+}
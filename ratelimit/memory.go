@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store, every instance of the service then enforces the limits on its own
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: make(map[string]State),
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, input TakeInput) (result Result, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.states[input.Key]
+	if !state.ExpiresAt.After(input.Now) {
+		state = State{}
+	}
+
+	s.states[input.Key], result = input.Algorithm.Take(state, input.Now)
+	return
+}
+
+func (s *MemoryStore) PruneExpired(_ context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, state := range s.states {
+		if state.ExpiresAt.Before(now) {
+			delete(s.states, key)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		bucket = TokenBucket{Capacity: 1, Period: time.Minute}
+		now    = time.Now()
+	)
+
+	t.Run("keys are limited separately", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		result, err := store.Take(ctx, TakeInput{Key: "a", Algorithm: bucket, Now: now})
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+
+		result, err = store.Take(ctx, TakeInput{Key: "a", Algorithm: bucket, Now: now})
+		assert.Nil(t, err)
+		assert.False(t, result.Allowed)
+
+		result, err = store.Take(ctx, TakeInput{Key: "b", Algorithm: bucket, Now: now})
+		assert.Nil(t, err)
+		assert.True(t, result.Allowed)
+	})
+}
+
+func TestMemoryStore_PruneExpired(t *testing.T) {
+	var (
+		ctx    = context.Background()
+		bucket = TokenBucket{Capacity: 1, Period: time.Minute}
+	)
+
+	t.Run("positive", func(t *testing.T) {
+		store := NewMemoryStore()
+		_, _ = store.Take(ctx, TakeInput{Key: "expired", Algorithm: bucket, Now: time.Now().Add(-time.Hour)})
+		_, _ = store.Take(ctx, TakeInput{Key: "active", Algorithm: bucket, Now: time.Now()})
+
+		err := store.PruneExpired(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, store.states, 1)
+		assert.Contains(t, store.states, "active")
+	})
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Largest request body read to find the key of a rule, bigger bodies aren't rate limited by their content
+const maxKeyBodySize = 64 << 10
+
+// KeyFunc returns what the requests are counted by, false when the rule doesn't apply to the request
+type KeyFunc func(ctx echo.Context) (key string, ok bool)
+
+// Rule limits the requests to a route, counted separately for every key.
+// An empty Method or Path matches every method or route.
+type Rule struct {
+	Name      string
+	Method    string
+	Path      string
+	Key       KeyFunc
+	Algorithm Algorithm
+}
+
+func (r Rule) matches(ctx echo.Context) bool {
+	return (r.Method == "" || r.Method == ctx.Request().Method) && (r.Path == "" || r.Path == ctx.Path())
+}
+
+type Limiter struct {
+	Store Store
+	Rules []Rule
+
+	// OnError is called when the store fails, the request is then let through
+	OnError func(error)
+}
+
+type NewLimiterOptions struct {
+	Store   Store
+	Rules   []Rule
+	OnError func(error)
+}
+
+func NewLimiter(opts NewLimiterOptions) *Limiter {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+
+	return &Limiter{
+		Store:   opts.Store,
+		Rules:   opts.Rules,
+		OnError: opts.OnError,
+	}
+}
+
+// Middleware applies every matching rule to the request, answering 429 as soon as one of them is exceeded.
+// The RateLimit-* headers describe the most restrictive of the matching rules.
+func (l *Limiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			var (
+				reported *Result
+				policy   string
+			)
+
+			for _, rule := range l.Rules {
+				if !rule.matches(ctx) {
+					continue
+				}
+
+				key, ok := rule.Key(ctx)
+				if !ok {
+					continue
+				}
+
+				takeInput := TakeInput{
+					Key:       rule.Name + ":" + key,
+					Algorithm: rule.Algorithm,
+					Now:       time.Now(),
+				}
+
+				result, err := l.Store.Take(ctx.Request().Context(), takeInput)
+				if err != nil {
+					// An unavailable store shouldn't take the whole service down with it
+					if l.OnError != nil {
+						l.OnError(err)
+					}
+
+					continue
+				}
+
+				if reported == nil || !result.Allowed || result.Remaining < reported.Remaining {
+					reported, policy = &result, rule.Algorithm.Policy()
+				}
+
+				if !result.Allowed {
+					break
+				}
+			}
+
+			if reported == nil {
+				return next(ctx)
+			}
+
+			header := ctx.Response().Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(reported.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(reported.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(reported.Reset)))
+			header.Set("RateLimit-Policy", policy)
+
+			if !reported.Allowed {
+				header.Set("Retry-After", strconv.Itoa(int(math.Max(float64(ceilSeconds(reported.RetryAfter)), 1))))
+				return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests")
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ByIP counts the requests by client IP, as resolved by the IP extractor of the Echo instance
+func ByIP() KeyFunc {
+	return func(ctx echo.Context) (string, bool) {
+		ip := ctx.RealIP()
+		return ip, ip != ""
+	}
+}
+
+// ByPhoneNumber counts the requests by the phone_number field of their JSON body.
+// The body is put back, so the handler can still bind it.
+func ByPhoneNumber() KeyFunc {
+	return func(ctx echo.Context) (string, bool) {
+		req := ctx.Request()
+		if req.Body == nil {
+			return "", false
+		}
+
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxKeyBodySize+1))
+		req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+		if err != nil || len(body) > maxKeyBodySize {
+			return "", false
+		}
+
+		var fields struct {
+			PhoneNumber string `json:"phone_number"`
+		}
+
+		if err = json.Unmarshal(body, &fields); err != nil || fields.PhoneNumber == "" {
+			return "", false
+		}
+
+		return fields.PhoneNumber, true
+	}
+}
+
+// ByUser counts the requests by the authenticated user, as identified by the given function.
+// Requests that can't be identified are left to the handler to reject.
+func ByUser(identify func(ctx echo.Context) (string, error)) KeyFunc {
+	return func(ctx echo.Context) (string, bool) {
+		userId, err := identify(ctx)
+		if err != nil || userId == "" {
+			return "", false
+		}
+
+		return userId, true
+	}
+}
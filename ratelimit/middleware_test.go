@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, TakeInput) (Result, error) {
+	return Result{}, errors.New("error")
+}
+
+func (failingStore) PruneExpired(context.Context) error {
+	return nil
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	newServer := func(limiter *Limiter) *echo.Echo {
+		e := echo.New()
+		e.Use(limiter.Middleware())
+		e.POST("/user/login", func(ctx echo.Context) error {
+			body, _ := io.ReadAll(ctx.Request().Body)
+			return ctx.String(http.StatusOK, string(body))
+		})
+		e.GET("/user/profile", func(ctx echo.Context) error {
+			return ctx.NoContent(http.StatusOK)
+		})
+
+		return e
+	}
+
+	login := func(e *echo.Echo, ip string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/user/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderXRealIP, ip)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("limited per IP", func(t *testing.T) {
+		e := newServer(NewLimiter(NewLimiterOptions{Rules: []Rule{
+			{Name: "login", Method: http.MethodPost, Path: "/user/login", Key: ByIP(),
+				Algorithm: TokenBucket{Capacity: 2, Period: time.Minute}},
+		}}))
+
+		rec := login(e, "10.0.0.1", `{}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", rec.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "30", rec.Header().Get("RateLimit-Reset"))
+		assert.Equal(t, "2;w=60", rec.Header().Get("RateLimit-Policy"))
+
+		assert.Equal(t, http.StatusOK, login(e, "10.0.0.1", `{}`).Code)
+
+		rec = login(e, "10.0.0.1", `{}`)
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+		assert.Contains(t, rec.Body.String(), "too many requests")
+
+		// Other clients and routes aren't affected
+		assert.Equal(t, http.StatusOK, login(e, "10.0.0.2", `{}`).Code)
+
+		req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+		req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("RateLimit-Limit"))
+	})
+
+	t.Run("limited per phone number", func(t *testing.T) {
+		e := newServer(NewLimiter(NewLimiterOptions{Rules: []Rule{
+			{Name: "login", Method: http.MethodPost, Path: "/user/login", Key: ByPhoneNumber(),
+				Algorithm: SlidingWindow{Limit: 1, Window: time.Minute}},
+		}}))
+
+		body := `{"phone_number": "+62123456789", "password": "password"}`
+		rec := login(e, "10.0.0.1", body)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		// The handler still gets the whole body
+		assert.Equal(t, body, rec.Body.String())
+
+		// From another IP as well
+		assert.Equal(t, http.StatusTooManyRequests, login(e, "10.0.0.2", body).Code)
+		assert.Equal(t, http.StatusOK, login(e, "10.0.0.2", `{"phone_number": "+62987654321"}`).Code)
+
+		// Nothing to count by
+		assert.Equal(t, http.StatusOK, login(e, "10.0.0.2", `{perkedel}`).Code)
+	})
+
+	t.Run("limited per user", func(t *testing.T) {
+		identify := func(ctx echo.Context) (string, error) {
+			if ctx.Request().Header.Get(echo.HeaderAuthorization) == "" {
+				return "", errors.New("missing token")
+			}
+
+			return "user", nil
+		}
+
+		e := newServer(NewLimiter(NewLimiterOptions{Rules: []Rule{
+			{Name: "profile", Key: ByUser(identify), Algorithm: TokenBucket{Capacity: 1, Period: time.Minute}},
+		}}))
+
+		profile := func(authorization string) int {
+			req := httptest.NewRequest(http.MethodGet, "/user/profile", nil)
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			return rec.Code
+		}
+
+		assert.Equal(t, http.StatusOK, profile("Bearer token"))
+		assert.Equal(t, http.StatusTooManyRequests, profile("Bearer token"))
+
+		// Unauthenticated requests are left to the handler
+		assert.Equal(t, http.StatusOK, profile(""))
+	})
+
+	t.Run("most restrictive rule reported", func(t *testing.T) {
+		e := newServer(NewLimiter(NewLimiterOptions{Rules: []Rule{
+			{Name: "loose", Key: ByIP(), Algorithm: TokenBucket{Capacity: 10, Period: time.Minute}},
+			{Name: "strict", Key: ByIP(), Algorithm: SlidingWindow{Limit: 3, Window: time.Hour}},
+		}}))
+
+		rec := login(e, "10.0.0.1", `{}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "3", rec.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "2", rec.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "3;w=3600", rec.Header().Get("RateLimit-Policy"))
+	})
+
+	t.Run("store returns error", func(t *testing.T) {
+		var storeErr error
+		e := newServer(NewLimiter(NewLimiterOptions{
+			Store: failingStore{},
+			Rules: []Rule{
+				{Name: "login", Key: ByIP(), Algorithm: TokenBucket{Capacity: 1, Period: time.Minute}},
+			},
+			OnError: func(err error) { storeErr = err },
+		}))
+
+		rec := login(e, "10.0.0.1", `{}`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.EqualError(t, storeErr, "error")
+	})
+}
+
+func TestByIP(t *testing.T) {
+	key := func(extractor echo.IPExtractor, remoteAddr string, forwardedFor string) string {
+		e := echo.New()
+		e.IPExtractor = extractor
+
+		req := httptest.NewRequest(http.MethodPost, "/user/login", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+
+		ip, ok := ByIP()(e.NewContext(req, httptest.NewRecorder()))
+		assert.True(t, ok)
+		return ip
+	}
+
+	t.Run("forwarded headers ignored without trusted proxies", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.7", key(echo.ExtractIPDirect(), "203.0.113.7:4321", "198.51.100.1"))
+	})
+
+	t.Run("forwarded by a trusted proxy", func(t *testing.T) {
+		_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+		extractor := echo.ExtractIPFromXFFHeader(echo.TrustPrivateNet(false), echo.TrustIPRange(proxies))
+
+		assert.Equal(t, "198.51.100.1", key(extractor, "10.1.2.3:4321", "198.51.100.1"))
+		assert.Equal(t, "203.0.113.7", key(extractor, "203.0.113.7:4321", "198.51.100.1"))
+	})
+}
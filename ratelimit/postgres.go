@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore is a Store shared between every instance of the service, so the limits hold across replicas
+type PostgresStore struct {
+	Db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{Db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, input TakeInput) (result Result, err error) {
+	tx, err := s.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// The times are kept in UTC, the columns don't store the time zone
+
+	// Make sure the row exists, so concurrent requests for the same key wait on its lock
+	var insertQuery = `
+		INSERT INTO rate_limit (key, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO NOTHING
+	`
+
+	now := input.Now.UTC()
+	if _, err = tx.ExecContext(ctx, insertQuery, input.Key, now); err != nil {
+		return
+	}
+
+	var (
+		state     State
+		since     sql.NullTime
+		expiresAt sql.NullTime
+
+		selectQuery = `SELECT count, previous_count, since, expires_at FROM rate_limit WHERE key = $1 FOR UPDATE`
+	)
+
+	err = tx.QueryRowContext(ctx, selectQuery, input.Key).Scan(&state.Count, &state.PreviousCount, &since, &expiresAt)
+	if err != nil {
+		return
+	}
+
+	// Rows that expired but weren't pruned yet start over
+	if since.Valid && expiresAt.Time.After(now) {
+		state.Since, state.ExpiresAt = since.Time, expiresAt.Time
+	} else {
+		state = State{}
+	}
+
+	state, result = input.Algorithm.Take(state, now)
+
+	var updateQuery = `
+		UPDATE rate_limit
+		SET count = $2, previous_count = $3, since = $4, expires_at = $5
+		WHERE key = $1
+	`
+
+	_, err = tx.ExecContext(ctx, updateQuery, input.Key, state.Count, state.PreviousCount, state.Since, state.ExpiresAt)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (s *PostgresStore) PruneExpired(ctx context.Context) (err error) {
+	var query = `DELETE FROM rate_limit WHERE expires_at < $1`
+
+	_, err = s.Db.ExecContext(ctx, query, time.Now().UTC())
+	return
+}
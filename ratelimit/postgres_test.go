@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresStore_Take(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	var (
+		ctx    = context.Background()
+		store  = NewPostgresStore(db)
+		bucket = TokenBucket{Capacity: 2, Period: time.Minute}
+		now    = time.Now().UTC()
+		input  = TakeInput{Key: "key", Algorithm: bucket, Now: now}
+
+		expectedInsertQuery = "INSERT INTO rate_limit (.+) ON CONFLICT \\(key\\) DO NOTHING"
+		expectedSelectQuery = "SELECT count, previous_count, since, expires_at FROM rate_limit WHERE key = (.+) FOR UPDATE"
+		expectedUpdateQuery = "UPDATE rate_limit SET count = (.+) WHERE key = (.+)"
+		columns             = []string{"count", "previous_count", "since", "expires_at"}
+	)
+
+	t.Run("new key", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedInsertQuery).WithArgs(input.Key, now).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(expectedSelectQuery).WithArgs(input.Key).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(0, 0, nil, now))
+		mock.ExpectExec(expectedUpdateQuery).
+			WithArgs(input.Key, float64(1), float64(0), now, now.Add(30*time.Second)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		result, err := store.Take(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second}, result)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("existing key", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedInsertQuery).WithArgs(input.Key, now).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(expectedSelectQuery).WithArgs(input.Key).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(0, 0, now, now.Add(time.Minute)))
+		mock.ExpectExec(expectedUpdateQuery).
+			WithArgs(input.Key, float64(0), float64(0), now, now.Add(time.Minute)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		result, err := store.Take(ctx, input)
+		assert.Nil(t, err)
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 30*time.Second, result.RetryAfter)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		result, err := store.Take(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, result)
+	})
+
+	t.Run("select returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedInsertQuery).WithArgs(input.Key, now).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(expectedSelectQuery).WithArgs(input.Key).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		_, err := store.Take(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedInsertQuery).WithArgs(input.Key, now).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(expectedSelectQuery).WithArgs(input.Key).
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(0, 0, nil, now))
+		mock.ExpectExec(expectedUpdateQuery).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		_, err := store.Take(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPostgresStore_PruneExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	expectedQuery := "DELETE FROM rate_limit WHERE expires_at < (.+)"
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		err := store.PruneExpired(ctx)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WillReturnError(errors.New("error"))
+
+		err := store.PruneExpired(ctx)
+		assert.EqualError(t, err, "error")
+	})
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRules parses rules written one per line or separated by semicolons, as
+//
+//	<method> <path> <key> <algorithm> <limit>/<period>
+//
+// e.g. "POST /user/login ip token_bucket 20/1m". The key is one of keyFuncs, the algorithm is either
+// token_bucket or sliding_window, and the period is a Go duration.
+func ParseRules(spec string, keyFuncs map[string]KeyFunc) ([]Rule, error) {
+	var rules []Rule
+	for _, line := range strings.FieldsFunc(spec, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid rate limit rule %q", strings.TrimSpace(line))
+		}
+
+		method, path, keyName, algorithmName, quota := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+		keyFunc, ok := keyFuncs[keyName]
+		if !ok {
+			return nil, fmt.Errorf("unknown rate limit key %q", keyName)
+		}
+
+		limit, period, err := parseQuota(quota)
+		if err != nil {
+			return nil, err
+		}
+
+		var algorithm Algorithm
+		switch algorithmName {
+		case "token_bucket":
+			algorithm = TokenBucket{Capacity: limit, Period: period}
+		case "sliding_window":
+			algorithm = SlidingWindow{Limit: limit, Window: period}
+		default:
+			return nil, fmt.Errorf("unknown rate limit algorithm %q", algorithmName)
+		}
+
+		if method == "*" {
+			method = ""
+		}
+
+		if path == "*" {
+			path = ""
+		}
+
+		rules = append(rules, Rule{
+			Name:      strings.Join(fields[:3], " "),
+			Method:    strings.ToUpper(method),
+			Path:      path,
+			Key:       keyFunc,
+			Algorithm: algorithm,
+		})
+	}
+
+	return rules, nil
+}
+
+func parseQuota(quota string) (limit int, period time.Duration, err error) {
+	i := strings.Index(quota, "/")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit quota %q", quota)
+	}
+
+	limit, err = strconv.Atoi(quota[:i])
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit %q", quota[:i])
+	}
+
+	period, err = time.ParseDuration(quota[i+1:])
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit period %q", quota[i+1:])
+	}
+
+	return limit, period, nil
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRules(t *testing.T) {
+	keyFuncs := map[string]KeyFunc{"ip": ByIP(), "phone_number": ByPhoneNumber()}
+
+	t.Run("positive", func(t *testing.T) {
+		rules, err := ParseRules(`
+			POST /user/login ip token_bucket 20/1m
+			post /user/login phone_number sliding_window 10/15m; * * ip sliding_window 1000/1h
+		`, keyFuncs)
+		assert.Nil(t, err)
+
+		if assert.Len(t, rules, 3) {
+			assert.Equal(t, "POST /user/login ip", rules[0].Name)
+			assert.Equal(t, "POST", rules[0].Method)
+			assert.Equal(t, "/user/login", rules[0].Path)
+			assert.Equal(t, TokenBucket{Capacity: 20, Period: time.Minute}, rules[0].Algorithm)
+
+			assert.Equal(t, "POST", rules[1].Method)
+			assert.Equal(t, SlidingWindow{Limit: 10, Window: 15 * time.Minute}, rules[1].Algorithm)
+
+			assert.Empty(t, rules[2].Method)
+			assert.Empty(t, rules[2].Path)
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		rules, err := ParseRules("", keyFuncs)
+		assert.Nil(t, err)
+		assert.Empty(t, rules)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for spec, expectedErr := range map[string]string{
+			"POST /user/login ip token_bucket":          `invalid rate limit rule "POST /user/login ip token_bucket"`,
+			"POST /user/login user token_bucket 20/1m":  `unknown rate limit key "user"`,
+			"POST /user/login ip leaky_bucket 20/1m":    `unknown rate limit algorithm "leaky_bucket"`,
+			"POST /user/login ip token_bucket 20":       `invalid rate limit quota "20"`,
+			"POST /user/login ip token_bucket 0/1m":     `invalid rate limit "0"`,
+			"POST /user/login ip token_bucket 20/often": `invalid rate limit period "often"`,
+		} {
+			_, err := ParseRules(spec, keyFuncs)
+			assert.EqualError(t, err, expectedErr, spec)
+		}
+	})
+}
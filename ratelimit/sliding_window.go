@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// SlidingWindow allows Limit requests in any Window. It approximates the requests in the sliding window from
+// the counts of the current and the previous fixed windows, the previous one weighted by how much it still overlaps.
+// The state holds the count of the window starting at Since in Count, and of the window before it in PreviousCount.
+type SlidingWindow struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (w SlidingWindow) Take(state State, now time.Time) (next State, result Result) {
+	var (
+		windowStart = now.Truncate(w.Window)
+		elapsed     = now.Sub(windowStart)
+		limit       = float64(w.Limit)
+
+		current, previous float64
+	)
+
+	switch {
+	case state.Since.Equal(windowStart):
+		current, previous = state.Count, state.PreviousCount
+	case state.Since.Equal(windowStart.Add(-w.Window)):
+		previous = state.Count
+	}
+
+	estimate := previous*(1-float64(elapsed)/float64(w.Window)) + current
+
+	result.Limit = w.Limit
+	if estimate+1 <= limit {
+		result.Allowed = true
+		current++
+		estimate++
+	} else {
+		result.RetryAfter = w.retryAfter(current, previous, elapsed)
+	}
+
+	result.Remaining = int(math.Max(math.Floor(limit-estimate), 0))
+	switch {
+	case current > 0:
+		result.Reset = 2*w.Window - elapsed
+	case previous > 0:
+		result.Reset = w.Window - elapsed
+	}
+
+	next = State{Count: current, PreviousCount: previous, Since: windowStart, ExpiresAt: windowStart.Add(2 * w.Window)}
+	return
+}
+
+// retryAfter returns how long until the estimate leaves room for another request
+func (w SlidingWindow) retryAfter(current float64, previous float64, elapsed time.Duration) time.Duration {
+	limit := float64(w.Limit)
+
+	// Still within this window, once enough of the previous one slid out
+	if current+1 <= limit && previous > 0 {
+		return time.Duration(float64(w.Window)*(1-(limit-current-1)/previous)) - elapsed
+	}
+
+	// Otherwise in the next window, once enough of this one slid out
+	return w.Window - elapsed + time.Duration(float64(w.Window)*(1-(limit-1)/current))
+}
+
+func (w SlidingWindow) Policy() string {
+	return fmt.Sprintf("%d;w=%d", w.Limit, int(w.Window.Seconds()))
+}
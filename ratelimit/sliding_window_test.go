@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlidingWindow_Take(t *testing.T) {
+	var (
+		window      = SlidingWindow{Limit: 4, Window: time.Minute}
+		windowStart = time.Now().Truncate(time.Minute)
+		state       State
+		result      Result
+	)
+
+	t.Run("up to the limit within the window", func(t *testing.T) {
+		for i := 3; i >= 0; i-- {
+			state, result = window.Take(state, windowStart.Add(30*time.Second))
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 4, result.Limit)
+			assert.Equal(t, i, result.Remaining)
+		}
+
+		assert.Equal(t, 90*time.Second, result.Reset)
+	})
+
+	t.Run("limit exceeded", func(t *testing.T) {
+		state, result = window.Take(state, windowStart.Add(45*time.Second))
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		// A quarter of this window has to slide out of the next one
+		assert.Equal(t, 30*time.Second, result.RetryAfter)
+	})
+
+	t.Run("previous window partially slid out", func(t *testing.T) {
+		// Half of the previous window still counts, i.e. two requests
+		state, result = window.Take(state, windowStart.Add(90*time.Second))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 1, result.Remaining)
+
+		state, result = window.Take(state, windowStart.Add(90*time.Second))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		state, result = window.Take(state, windowStart.Add(90*time.Second))
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 15*time.Second, result.RetryAfter)
+
+		state, result = window.Take(state, windowStart.Add(105*time.Second))
+		assert.True(t, result.Allowed)
+	})
+
+	t.Run("state older than the previous window", func(t *testing.T) {
+		_, result = window.Take(state, windowStart.Add(10*time.Minute))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Remaining)
+	})
+}
+
+func TestSlidingWindow_Policy(t *testing.T) {
+	assert.Equal(t, "3;w=3600", SlidingWindow{Limit: 3, Window: time.Hour}.Policy())
+}
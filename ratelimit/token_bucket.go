@@ -0,0 +1,45 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TokenBucket allows bursts of up to Capacity requests, refilled at Capacity tokens per Period.
+// The state holds the number of tokens left in Count and when they were counted in Since.
+type TokenBucket struct {
+	Capacity int
+	Period   time.Duration
+}
+
+func (b TokenBucket) Take(state State, now time.Time) (next State, result Result) {
+	var (
+		capacity = float64(b.Capacity)
+		interval = b.Period / time.Duration(b.Capacity) // to refill a single token
+		tokens   = capacity
+	)
+
+	if !state.Since.IsZero() {
+		refilled := float64(now.Sub(state.Since)) / float64(interval)
+		tokens = math.Min(capacity, state.Count+math.Max(refilled, 0))
+	}
+
+	result.Limit = b.Capacity
+	if tokens >= 1 {
+		result.Allowed = true
+		tokens--
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(interval))
+	}
+
+	result.Remaining = int(math.Floor(tokens))
+	result.Reset = time.Duration((capacity - tokens) * float64(interval))
+
+	next = State{Count: tokens, Since: now, ExpiresAt: now.Add(result.Reset)}
+	return
+}
+
+func (b TokenBucket) Policy() string {
+	return fmt.Sprintf("%d;w=%d", b.Capacity, int(b.Period.Seconds()))
+}
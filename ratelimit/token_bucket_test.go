@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket_Take(t *testing.T) {
+	var (
+		bucket = TokenBucket{Capacity: 3, Period: 3 * time.Second}
+		now    = time.Now()
+		state  State
+		result Result
+	)
+
+	t.Run("burst up to the capacity", func(t *testing.T) {
+		for i := 2; i >= 0; i-- {
+			state, result = bucket.Take(state, now)
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 3, result.Limit)
+			assert.Equal(t, i, result.Remaining)
+		}
+
+		assert.Equal(t, 3*time.Second, result.Reset)
+	})
+
+	t.Run("empty bucket", func(t *testing.T) {
+		state, result = bucket.Take(state, now.Add(500*time.Millisecond))
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+		assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+	})
+
+	t.Run("refilled over time", func(t *testing.T) {
+		state, result = bucket.Take(state, now.Add(time.Second))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+
+		// Never more than the capacity
+		state, result = bucket.Take(state, now.Add(time.Hour))
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Remaining)
+		assert.Equal(t, now.Add(time.Hour+time.Second), state.ExpiresAt)
+	})
+}
+
+func TestTokenBucket_Policy(t *testing.T) {
+	assert.Equal(t, "20;w=60", TokenBucket{Capacity: 20, Period: time.Minute}.Policy())
+}
@@ -0,0 +1,32 @@
+// This file contains types that are used by the rate limiting stores and algorithms.
+package ratelimit
+
+import "time"
+
+// State is what is stored for a key between requests, its meaning depends on the algorithm.
+// The zero State is the state of a key that hasn't been seen yet.
+type State struct {
+	Count         float64
+	PreviousCount float64
+	Since         time.Time
+
+	// The state can be forgotten after ExpiresAt, it's then the same as the zero State
+	ExpiresAt time.Time
+}
+
+type TakeInput struct {
+	Key       string
+	Algorithm Algorithm
+	Now       time.Time
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is how long until the quota is fully available again,
+	// RetryAfter how long until the next request is allowed when this one isn't
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
@@ -9,12 +9,14 @@ import (
 
 func (r *Repository) GetUserByPhoneNumber(ctx context.Context, input GetUserByPhoneNumberInput) (output GetUserByPhoneNumberOutput, err error) {
 	var query = `
-	SELECT um.id, um.name, um.password_hash, ul.successful_login 
+	SELECT um.id, um.name, um.password_hash, um.phone_verified_at, ul.successful_login, ul.failed_login,
+		ul.last_failed_login_at
 	FROM user_master um 
 	LEFT JOIN user_login ul ON um.id = ul.user_id
 	WHERE um.phone_number = $1`
 
-	err = r.Db.QueryRowContext(ctx, query, input.PhoneNumber).Scan(&output.Id, &output.Name, &output.Password, &output.NumOfSuccessfulLogin)
+	err = r.Db.QueryRowContext(ctx, query, input.PhoneNumber).Scan(&output.Id, &output.Name, &output.Password,
+		&output.PhoneVerifiedAt, &output.NumOfSuccessfulLogin, &output.NumOfFailedLogin, &output.LastFailedLoginAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return output, common.ErrUserNotFound
@@ -28,12 +30,16 @@ func (r *Repository) GetUserByPhoneNumber(ctx context.Context, input GetUserByPh
 
 func (r *Repository) GetUserById(ctx context.Context, input GetUserByIdInput) (output GetUserByIdOutput, err error) {
 	var query = `
-		SELECT id, name, phone_number
-		FROM user_master
-		WHERE id = $1
+		SELECT um.id, um.name, um.phone_number, um.password_hash, um.phone_verified_at, ul.successful_login,
+			ul.failed_login, ul.last_failed_login_at, um.version
+		FROM user_master um
+		LEFT JOIN user_login ul ON um.id = ul.user_id
+		WHERE um.id = $1
 	`
 
-	err = r.Db.QueryRowContext(ctx, query, input.Id).Scan(&output.Id, &output.Name, &output.PhoneNumber)
+	err = r.Db.QueryRowContext(ctx, query, input.Id).Scan(&output.Id, &output.Name, &output.PhoneNumber,
+		&output.Password, &output.PhoneVerifiedAt, &output.NumOfSuccessfulLogin, &output.NumOfFailedLogin,
+		&output.LastFailedLoginAt, &output.Version)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return output, common.ErrUserNotFound
@@ -46,6 +52,17 @@ func (r *Repository) GetUserById(ctx context.Context, input GetUserByIdInput) (o
 }
 
 func (r *Repository) InsertUser(ctx context.Context, input InsertUserInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
 	var query = `
 		INSERT INTO user_master
 		    (id, phone_number, name, password_hash)
@@ -53,32 +70,911 @@ func (r *Repository) InsertUser(ctx context.Context, input InsertUserInput) (err
 			($1, $2, $3, $4)
 	`
 
-	_, err = r.Db.ExecContext(ctx, query, input.Id, input.PhoneNumber, input.Name, input.Password)
+	_, err = tx.ExecContext(ctx, query, input.Id, input.PhoneNumber, input.Name, input.Password)
+	if err != nil {
+		err = translateError(err)
+		return
+	}
+
+	// The first password starts the history
+	err = r.recordPasswordHistory(ctx, tx, input.Id.String(), input.Password)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
 	return
 }
 
-func (r *Repository) UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) (err error) {
+// UpsertUserLogin counts a successful login and returns the new count. The count is incremented in a single
+// statement, so concurrent logins of the same user aren't lost.
+func (r *Repository) UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) (output UpsertUserLoginOutput, err error) {
 	var query = `
 		INSERT INTO user_login (user_id, successful_login, last_login_at)
-		VALUES ($1, $2, NOW())
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (user_id)
+		DO UPDATE
+		SET successful_login = user_login.successful_login + 1, last_login_at = EXCLUDED.last_login_at,
+			failed_login = 0, last_failed_login_at = NULL
+		RETURNING successful_login
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.UserId).Scan(&output.NumOfSuccessfulLogin)
+	return
+}
+
+func (r *Repository) RecordFailedLogin(ctx context.Context, input RecordFailedLoginInput) (output RecordFailedLoginOutput, err error) {
+	// Counted in a single statement, so concurrent failures from several instances aren't lost.
+	// A user failing to log in first has never logged in, hence no last login.
+	var query = `
+		INSERT INTO user_login (user_id, successful_login, last_login_at, failed_login, last_failed_login_at)
+		VALUES ($1, 0, NULL, 1, $2)
 		ON CONFLICT (user_id)
 		DO UPDATE
-		SET successful_login = EXCLUDED.successful_login, last_login_at = EXCLUDED.last_login_at
+		SET failed_login = CASE
+				WHEN user_login.last_failed_login_at IS NULL OR user_login.last_failed_login_at < $3 THEN 1
+				ELSE user_login.failed_login + 1
+			END,
+			last_failed_login_at = EXCLUDED.last_failed_login_at
+		RETURNING failed_login
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.UserId, input.FailedAt, input.WindowStart).Scan(&output.NumOfFailedLogin)
+	return
+}
+
+// InsertLoginEvent appends the outcome of a login attempt to the user's login history
+func (r *Repository) InsertLoginEvent(ctx context.Context, input InsertLoginEventInput) (err error) {
+	var query = `
+		INSERT INTO user_login_event
+			(user_id, successful, reason, ip_address, user_agent)
+		VALUES
+			($1, $2, $3, $4, $5)
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, input.UserId, input.Successful, input.Reason, input.IpAddress, input.UserAgent)
+	return
+}
+
+// ListLoginEvents returns up to Limit login events of the user older than BeforeId, the most recent first.
+// A zero BeforeId starts from the most recent one.
+func (r *Repository) ListLoginEvents(ctx context.Context, input ListLoginEventsInput) (output ListLoginEventsOutput, err error) {
+	var query = `
+		SELECT id, successful, reason, ip_address, user_agent, created_at
+		FROM user_login_event
+		WHERE user_id = $1 AND ($2 = 0 OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
 	`
 
-	_, err = r.Db.ExecContext(ctx, query, input.UserId, input.NumOfSuccessfulLogin)
+	rows, err := r.Db.QueryContext(ctx, query, input.UserId, input.BeforeId, input.Limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event LoginEvent
+		if err = rows.Scan(&event.Id, &event.Successful, &event.Reason, &event.IpAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+			return
+		}
+
+		output.Events = append(output.Events, event)
+	}
+
+	err = rows.Err()
 	return
 }
 
+// UpdateUser fails with common.ErrUserVersionMismatch when the profile was changed since it was read at input.Version
 func (r *Repository) UpdateUser(ctx context.Context, input UpdateUserInput) (err error) {
 	var query = `
 		UPDATE user_master
 		SET
-			phone_number = $2, name = $3
+			phone_number = $2, name = $3,
+			phone_verified_at = CASE WHEN phone_number = $2 THEN phone_verified_at ELSE NULL END,
+			version = version + 1
 		WHERE	
-			id = $1
+			id = $1 AND version = $4
+	`
+	result, err := r.Db.ExecContext(ctx, query, input.Id, input.PhoneNumber, input.Name, input.Version)
+	if err != nil {
+		err = translateError(err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrUserVersionMismatch
+	}
+
+	return
+}
+
+func (r *Repository) UpdateUserPassword(ctx context.Context, input UpdateUserPasswordInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var query = `
+		UPDATE user_master
+		SET password_hash = $2
+		WHERE id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, input.Id, input.Password)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrUserNotFound
+		return
+	}
+
+	err = r.recordPasswordHistory(ctx, tx, input.Id, input.Password)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) RehashUserPassword(ctx context.Context, input RehashUserPasswordInput) (err error) {
+	// Nothing is updated when the password was changed in the meantime, the new password must be kept
+	var query = `
+		UPDATE user_master
+		SET password_hash = $3
+		WHERE id = $1 AND password_hash = $2
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, input.Id, input.CurrentPassword, input.Password)
+	return
+}
+
+func (r *Repository) InsertRefreshToken(ctx context.Context, input InsertRefreshTokenInput) (err error) {
+	var query = `
+		INSERT INTO user_refresh_token
+			(id, user_id, family_id, token_hash, expires_at)
+		VALUES
+			($1, $2, $3, $4, $5)
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, input.Id, input.UserId, input.FamilyId, input.TokenHash, input.ExpiresAt)
+	return
+}
+
+func (r *Repository) GetRefreshTokenByHash(ctx context.Context, input GetRefreshTokenByHashInput) (output GetRefreshTokenByHashOutput, err error) {
+	var query = `
+		SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+		FROM user_refresh_token
+		WHERE token_hash = $1
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.TokenHash).Scan(&output.Id, &output.UserId, &output.FamilyId,
+		&output.ExpiresAt, &output.UsedAt, &output.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return output, common.ErrRefreshTokenNotFound
+		}
+
+		return
+	}
+
+	return
+}
+
+// MarkRefreshTokenUsed flags the refresh token as consumed. The update only succeeds once,
+// so two concurrent refreshes with the same token can't both get through.
+func (r *Repository) MarkRefreshTokenUsed(ctx context.Context, input MarkRefreshTokenUsedInput) (err error) {
+	var query = `
+		UPDATE user_refresh_token
+		SET used_at = NOW()
+		WHERE id = $1 AND used_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.Id)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrRefreshTokenAlreadyUsed
+	}
+
+	return
+}
+
+// RevokeRefreshTokenFamily revokes the refresh tokens of the family, ending the session it belongs to
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, input RevokeRefreshTokenFamilyInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var query = `
+		UPDATE user_refresh_token
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err = tx.ExecContext(ctx, query, input.FamilyId)
+	if err != nil {
+		return
+	}
+
+	query = `
+		UPDATE user_session
+		SET revoked_at = NOW()
+		WHERE id = $1 AND revoked_at IS NULL
+	`
+
+	_, err = tx.ExecContext(ctx, query, input.FamilyId)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+// RevokeUserRefreshTokens revokes the refresh tokens of the user, ending every session
+func (r *Repository) RevokeUserRefreshTokens(ctx context.Context, input RevokeUserRefreshTokensInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var query = `
+		UPDATE user_refresh_token
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err = tx.ExecContext(ctx, query, input.UserId)
+	if err != nil {
+		return
+	}
+
+	query = `
+		UPDATE user_session
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND revoked_at IS NULL
+	`
+
+	_, err = tx.ExecContext(ctx, query, input.UserId)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) InsertUserSession(ctx context.Context, input InsertUserSessionInput) (err error) {
+	var query = `
+		INSERT INTO user_session
+			(id, user_id, user_agent, ip_address)
+		VALUES
+			($1, $2, $3, $4)
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, input.Id, input.UserId, input.UserAgent, input.IpAddress)
+	return
+}
+
+// TouchUserSession records that the session has just been used, from the given IP address
+func (r *Repository) TouchUserSession(ctx context.Context, input TouchUserSessionInput) (err error) {
+	var query = `
+		UPDATE user_session
+		SET last_seen_at = NOW(), ip_address = $2
+		WHERE id = $1
+	`
+
+	_, err = r.Db.ExecContext(ctx, query, input.Id, input.IpAddress)
+	return
+}
+
+// ListUserSessions returns the sessions of the user that are neither revoked nor unused since LastSeenAfter,
+// the most recently used first
+func (r *Repository) ListUserSessions(ctx context.Context, input ListUserSessionsInput) (output ListUserSessionsOutput, err error) {
+	var query = `
+		SELECT id, user_agent, ip_address, created_at, last_seen_at
+		FROM user_session
+		WHERE user_id = $1 AND revoked_at IS NULL AND last_seen_at > $2
+		ORDER BY last_seen_at DESC
+	`
+
+	rows, err := r.Db.QueryContext(ctx, query, input.UserId, input.LastSeenAfter)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var session UserSession
+		if err = rows.Scan(&session.Id, &session.UserAgent, &session.IpAddress, &session.CreatedAt, &session.LastSeenAt); err != nil {
+			return
+		}
+
+		output.Sessions = append(output.Sessions, session)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// RevokeUserSession revokes the session along with its refresh tokens.
+// It fails with common.ErrSessionNotFound when the user has no such session, or it's already revoked.
+func (r *Repository) RevokeUserSession(ctx context.Context, input RevokeUserSessionInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var query = `
+		UPDATE user_session
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, query, input.Id, input.UserId)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrSessionNotFound
+		return
+	}
+
+	query = `
+		UPDATE user_refresh_token
+		SET revoked_at = NOW()
+		WHERE family_id = $1 AND revoked_at IS NULL
 	`
-	_, err = r.Db.ExecContext(ctx, query, input.Id, input.PhoneNumber, input.Name)
+
+	_, err = tx.ExecContext(ctx, query, input.Id)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
 	return
+}
+
+// UpsertUserMFA starts (or restarts) the TOTP enrollment of the user and replaces the recovery codes.
+// An enrollment that is already confirmed is never overwritten.
+func (r *Repository) UpsertUserMFA(ctx context.Context, input UpsertUserMFAInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var upsertQuery = `
+		INSERT INTO user_mfa (user_id, encrypted_secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id)
+		DO UPDATE
+		SET encrypted_secret = EXCLUDED.encrypted_secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.confirmed_at IS NULL
+	`
+
+	result, err := tx.ExecContext(ctx, upsertQuery, input.UserId, input.EncryptedSecret)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrMFAAlreadyEnabled
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa_recovery_code WHERE user_id = $1`, input.UserId)
+	if err != nil {
+		return
+	}
+
+	var insertCodeQuery = `
+		INSERT INTO user_mfa_recovery_code (user_id, code_hash)
+		VALUES ($1, $2)
+	`
+
+	for _, codeHash := range input.RecoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, insertCodeQuery, input.UserId, codeHash)
+		if err != nil {
+			return
+		}
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) GetUserMFA(ctx context.Context, input GetUserMFAInput) (output GetUserMFAOutput, err error) {
+	var query = `
+		SELECT user_id, encrypted_secret, confirmed_at, last_used_step
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.UserId).Scan(&output.UserId, &output.EncryptedSecret,
+		&output.ConfirmedAt, &output.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return output, common.ErrMFANotFound
+		}
+
+		return
+	}
+
+	return
+}
+
+func (r *Repository) ConfirmUserMFA(ctx context.Context, input ConfirmUserMFAInput) (err error) {
+	var query = `
+		UPDATE user_mfa
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND confirmed_at IS NULL
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.Step)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrMFAAlreadyEnabled
+	}
+
+	return
+}
+
+// UpdateUserMFALastUsedStep records the time step of an accepted code. It only moves forward,
+// so the same code (or an older one) can't be replayed within its validity window.
+func (r *Repository) UpdateUserMFALastUsedStep(ctx context.Context, input UpdateUserMFALastUsedStepInput) (err error) {
+	var query = `
+		UPDATE user_mfa
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.Step)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrMFACodeAlreadyUsed
+	}
+
+	return
+}
+
+func (r *Repository) UseMFARecoveryCode(ctx context.Context, input UseMFARecoveryCodeInput) (err error) {
+	var query = `
+		UPDATE user_mfa_recovery_code
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.CodeHash)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrMFARecoveryCodeNotFound
+	}
+
+	return
+}
+
+func (r *Repository) DeleteUserMFA(ctx context.Context, input DeleteUserMFAInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa_recovery_code WHERE user_id = $1`, input.UserId)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, input.UserId)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) UpsertPhoneVerification(ctx context.Context, input UpsertPhoneVerificationInput) (err error) {
+	// A new code resets the attempts, but only once the previous one is old enough
+	var query = `
+		INSERT INTO user_phone_verification (user_id, phone_number, code_hash, attempts, expires_at, sent_at)
+		VALUES ($1, $2, $3, 0, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET phone_number = EXCLUDED.phone_number, code_hash = EXCLUDED.code_hash, attempts = 0,
+			expires_at = EXCLUDED.expires_at, sent_at = EXCLUDED.sent_at
+		WHERE user_phone_verification.sent_at <= $6
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt,
+		input.SentAt, input.LastSentBefore)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrPhoneVerificationCooldown
+	}
+
+	return
+}
+
+func (r *Repository) GetPhoneVerification(ctx context.Context, input GetPhoneVerificationInput) (output GetPhoneVerificationOutput, err error) {
+	var query = `
+		SELECT user_id, phone_number, code_hash, attempts, expires_at, sent_at
+		FROM user_phone_verification
+		WHERE user_id = $1
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.UserId).Scan(&output.UserId, &output.PhoneNumber, &output.CodeHash,
+		&output.Attempts, &output.ExpiresAt, &output.SentAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return output, common.ErrPhoneVerificationNotFound
+		}
+
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementPhoneVerificationAttempts(ctx context.Context, input IncrementPhoneVerificationAttemptsInput) (err error) {
+	// Counting the attempt before the code is compared keeps concurrent guesses within the limit
+	var query = `
+		UPDATE user_phone_verification
+		SET attempts = attempts + 1
+		WHERE user_id = $1 AND attempts < $2
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.MaxAttempts)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrPhoneVerificationAttemptsExceeded
+	}
+
+	return
+}
+
+func (r *Repository) VerifyUserPhone(ctx context.Context, input VerifyUserPhoneInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// The phone number may have been changed since the code was sent
+	var query = `
+		UPDATE user_master
+		SET phone_verified_at = NOW(), version = version + 1
+		WHERE id = $1 AND phone_number = $2
+	`
+
+	result, err := tx.ExecContext(ctx, query, input.UserId, input.PhoneNumber)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrPhoneVerificationNotFound
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM user_phone_verification WHERE user_id = $1`, input.UserId)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) UpsertPasswordReset(ctx context.Context, input UpsertPasswordResetInput) (err error) {
+	// A new code resets the attempts, but only once the previous one is old enough
+	var query = `
+		INSERT INTO user_password_reset (user_id, code_hash, attempts, expires_at, sent_at)
+		VALUES ($1, $2, 0, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET code_hash = EXCLUDED.code_hash, attempts = 0, expires_at = EXCLUDED.expires_at, sent_at = EXCLUDED.sent_at
+		WHERE user_password_reset.sent_at <= $5
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.CodeHash, input.ExpiresAt, input.SentAt,
+		input.LastSentBefore)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrPasswordResetCooldown
+	}
+
+	return
+}
+
+func (r *Repository) GetPasswordReset(ctx context.Context, input GetPasswordResetInput) (output GetPasswordResetOutput, err error) {
+	var query = `
+		SELECT user_id, code_hash, attempts, expires_at, sent_at
+		FROM user_password_reset
+		WHERE user_id = $1
+	`
+
+	err = r.Db.QueryRowContext(ctx, query, input.UserId).Scan(&output.UserId, &output.CodeHash, &output.Attempts,
+		&output.ExpiresAt, &output.SentAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return output, common.ErrPasswordResetNotFound
+		}
+
+		return
+	}
+
+	return
+}
+
+func (r *Repository) IncrementPasswordResetAttempts(ctx context.Context, input IncrementPasswordResetAttemptsInput) (err error) {
+	var query = `
+		UPDATE user_password_reset
+		SET attempts = attempts + 1
+		WHERE user_id = $1 AND attempts < $2
+	`
+
+	result, err := r.Db.ExecContext(ctx, query, input.UserId, input.MaxAttempts)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		return common.ErrPasswordResetAttemptsExceeded
+	}
+
+	return
+}
+
+func (r *Repository) ResetUserPassword(ctx context.Context, input ResetUserPasswordInput) (err error) {
+	tx, err := r.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Consuming the code first makes it single use, even with concurrent requests
+	var query = `
+		DELETE FROM user_password_reset
+		WHERE user_id = $1 AND code_hash = $2
+	`
+
+	result, err := tx.ExecContext(ctx, query, input.UserId, input.CodeHash)
+	if err != nil {
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+
+	if rowsAffected == 0 {
+		err = common.ErrPasswordResetNotFound
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_master SET password_hash = $2 WHERE id = $1`, input.UserId, input.Password)
+	if err != nil {
+		return
+	}
+
+	err = r.recordPasswordHistory(ctx, tx, input.UserId.String(), input.Password)
+	if err != nil {
+		return
+	}
+
+	// Sessions started with the old password are revoked along with their refresh tokens
+	_, err = tx.ExecContext(ctx, `UPDATE user_refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		input.UserId)
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE user_session SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		input.UserId)
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	return
+}
+
+func (r *Repository) GetPasswordHistory(ctx context.Context, input GetPasswordHistoryInput) (output GetPasswordHistoryOutput, err error) {
+	var query = `
+		SELECT password_hash
+		FROM user_password_history
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.Db.QueryContext(ctx, query, input.UserId, r.passwordHistoryDepth())
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var passwordHash string
+		if err = rows.Scan(&passwordHash); err != nil {
+			return
+		}
+
+		output.PasswordHashes = append(output.PasswordHashes, passwordHash)
+	}
+
+	err = rows.Err()
+	return
+}
+
+// recordPasswordHistory adds the new password hash to the user's history, within the transaction setting it,
+// and forgets the ones beyond the history depth
+func (r *Repository) recordPasswordHistory(ctx context.Context, tx *sql.Tx, userId string, passwordHash string) (err error) {
+	var query = `
+		INSERT INTO user_password_history (user_id, password_hash)
+		VALUES ($1, $2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, userId, passwordHash)
+	if err != nil {
+		return
+	}
+
+	query = `
+		DELETE FROM user_password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM user_password_history
+			WHERE user_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		)
+	`
+
+	_, err = tx.ExecContext(ctx, query, userId, r.passwordHistoryDepth())
+	return
+}
+
+func (r *Repository) passwordHistoryDepth() int {
+	if r.PasswordHistoryDepth <= 0 {
+		return defaultPasswordHistoryDepth
+	}
 
+	return r.PasswordHistoryDepth
 }
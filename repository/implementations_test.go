@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/dityuiri/UserServiceTest/common"
@@ -28,8 +31,8 @@ func TestRepository_GetUserByPhoneNumber(t *testing.T) {
 
 	ctx := context.Background()
 	repo := &Repository{Db: db}
-	expectedQuery := "SELECT um.id, um.name, um.password_hash, ul.successful_login FROM user_master um " +
-		"LEFT JOIN user_login ul ON um.id = ul.user_id WHERE um.phone_number = (.+)"
+	expectedQuery := "SELECT um.id, um.name, um.password_hash, um.phone_verified_at, ul.successful_login, ul.failed_login, " +
+		"ul.last_failed_login_at FROM user_master um LEFT JOIN user_login ul ON um.id = ul.user_id WHERE um.phone_number = (.+)"
 
 	t.Run("positive", func(t *testing.T) {
 		var (
@@ -38,15 +41,17 @@ func TestRepository_GetUserByPhoneNumber(t *testing.T) {
 			}
 
 			expectedOutput = GetUserByPhoneNumberOutput{
-				Id:   uuid.New(),
-				Name: "Sakino Yui",
+				Id:              uuid.New(),
+				Name:            "Sakino Yui",
+				PhoneVerifiedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
 			}
 		)
 
 		mock.ExpectQuery(expectedQuery).
 			WithArgs(input.PhoneNumber).WillReturnRows(sqlmock.NewRows([]string{"id", "name",
-			"password", "successful_login"}).AddRow(expectedOutput.Id, expectedOutput.Name,
-			expectedOutput.Password, expectedOutput.NumOfSuccessfulLogin))
+			"password", "phone_verified_at", "successful_login", "failed_login", "last_failed_login_at"}).AddRow(expectedOutput.Id,
+			expectedOutput.Name, expectedOutput.Password, expectedOutput.PhoneVerifiedAt.Time, expectedOutput.NumOfSuccessfulLogin,
+			expectedOutput.NumOfFailedLogin, expectedOutput.LastFailedLoginAt))
 
 		output, err := repo.GetUserByPhoneNumber(ctx, input)
 		assert.Equal(t, expectedOutput, output)
@@ -98,39 +103,73 @@ func TestRepository_InsertUser(t *testing.T) {
 	}(db)
 
 	ctx := context.Background()
-	repo := &Repository{Db: db}
+	repo := &Repository{Db: db, PasswordHistoryDepth: 3}
+	input := InsertUserInput{
+		Id:          uuid.New(),
+		Name:        "Sakino Yui",
+		PhoneNumber: "+6285320993",
+		Password:    "polarBearYui!",
+	}
 
 	t.Run("positive", func(t *testing.T) {
-		var (
-			input = InsertUserInput{
-				Id:          uuid.New(),
-				Name:        "Sakino Yui",
-				PhoneNumber: "+6285320993",
-				Password:    "polarBearYui!",
-			}
-		)
-
+		mock.ExpectBegin()
 		mock.ExpectExec("INSERT INTO user_master (.+)").
 			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Password).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO user_password_history (.+)").
+			WithArgs(input.Id.String(), input.Password).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("DELETE FROM user_password_history (.+)").
+			WithArgs(input.Id.String(), 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
 
 		err := repo.InsertUser(ctx, input)
 		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("exec context returns error", func(t *testing.T) {
-		var (
-			input = InsertUserInput{
-				Id:          uuid.New(),
-				Name:        "Sakino Yui",
-				PhoneNumber: "+6285320993",
-				Password:    "polarBearYui!",
-			}
-		)
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO user_master (.+)").
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Password).
+			WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.InsertUser(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("phone number already registered", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO user_master (.+)").
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Password).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "phone_number_key"})
+		mock.ExpectRollback()
 
+		err := repo.InsertUser(ctx, input)
+		assert.Equal(t, &common.UniqueViolationError{Constraint: "phone_number_key"}, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("record password history returns error", func(t *testing.T) {
+		mock.ExpectBegin()
 		mock.ExpectExec("INSERT INTO user_master (.+)").
 			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Password).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO user_password_history (.+)").
+			WithArgs(input.Id.String(), input.Password).
 			WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.InsertUser(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
 
 		err := repo.InsertUser(ctx, input)
 		assert.EqualError(t, err, "error")
@@ -152,39 +191,65 @@ func TestRepository_UpsertUserLogin(t *testing.T) {
 
 	ctx := context.Background()
 	repo := &Repository{Db: db}
-	expectedQuery := "INSERT INTO user_login (.+)"
+	expectedQuery := "INSERT INTO user_login (.+) ON CONFLICT \\(user_id\\) DO UPDATE " +
+		"SET successful_login = user_login.successful_login \\+ 1, (.+) RETURNING successful_login"
+	input := UpsertUserLoginInput{UserId: uuid.New()}
 
 	t.Run("positive", func(t *testing.T) {
-		var (
-			input = UpsertUserLoginInput{
-				UserId:               uuid.New(),
-				NumOfSuccessfulLogin: 1,
-			}
-		)
-
-		mock.ExpectExec(expectedQuery).
-			WithArgs(input.UserId, input.NumOfSuccessfulLogin).
-			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.UserId).
+			WillReturnRows(sqlmock.NewRows([]string{"successful_login"}).AddRow(7))
 
-		err := repo.UpsertUserLogin(ctx, input)
+		output, err := repo.UpsertUserLogin(ctx, input)
 		assert.Nil(t, err)
+		assert.Equal(t, int32(7), output.NumOfSuccessfulLogin)
 	})
 
-	t.Run("exec context returns error", func(t *testing.T) {
-		var (
-			input = UpsertUserLoginInput{
-				UserId:               uuid.New(),
-				NumOfSuccessfulLogin: 1,
-			}
-		)
-
-		mock.ExpectExec(expectedQuery).
-			WithArgs(input.UserId, input.NumOfSuccessfulLogin).
+	t.Run("query row context returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.UserId).
 			WillReturnError(errors.New("error"))
 
-		err := repo.UpsertUserLogin(ctx, input)
+		_, err := repo.UpsertUserLogin(ctx, input)
 		assert.EqualError(t, err, "error")
 	})
+
+	t.Run("concurrent logins are counted by the database", func(t *testing.T) {
+		const logins = 20
+
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("Error creating mock database: %v", err)
+		}
+		defer db.Close()
+
+		// A single statement per login, incrementing the stored count rather than one read before it.
+		// Anything else, e.g. a SELECT first, isn't expected and fails the call.
+		mock.MatchExpectationsInOrder(false)
+		for i := 1; i <= logins; i++ {
+			mock.ExpectQuery("^INSERT INTO user_login \\(user_id, successful_login, last_login_at\\) VALUES \\(\\$1, 1, NOW\\(\\)\\) " +
+				"ON CONFLICT \\(user_id\\) DO UPDATE SET successful_login = user_login.successful_login \\+ 1, (.+) RETURNING successful_login$").
+				WithArgs(input.UserId).
+				WillReturnRows(sqlmock.NewRows([]string{"successful_login"}).AddRow(i))
+		}
+
+		repo := &Repository{Db: db}
+		var wg sync.WaitGroup
+		errs := make([]error, logins)
+		for i := 0; i < logins; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = repo.UpsertUserLogin(ctx, input)
+			}(i)
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestRepository_GetUserById(t *testing.T) {
@@ -202,7 +267,9 @@ func TestRepository_GetUserById(t *testing.T) {
 
 	ctx := context.Background()
 	repo := &Repository{Db: db}
-	expectedQuery := "SELECT id, name, phone_number FROM user_master WHERE id = (.+)"
+	expectedQuery := "SELECT um.id, um.name, um.phone_number, um.password_hash, um.phone_verified_at, ul.successful_login, " +
+		"ul.failed_login, ul.last_failed_login_at, um.version FROM user_master um " +
+		"LEFT JOIN user_login ul ON um.id = ul.user_id WHERE um.id = (.+)"
 
 	t.Run("positive", func(t *testing.T) {
 		var (
@@ -212,15 +279,21 @@ func TestRepository_GetUserById(t *testing.T) {
 			}
 
 			expectedOutput = GetUserByIdOutput{
-				Id:          id,
-				Name:        "Sakino Yui",
-				PhoneNumber: "+6287341234234",
+				Id:               id,
+				Name:             "Sakino Yui",
+				PhoneNumber:      "+6287341234234",
+				Password:         "hashedPassword",
+				NumOfFailedLogin: sql.NullInt32{Int32: 2, Valid: true},
+				Version:          3,
 			}
 		)
 
 		mock.ExpectQuery(expectedQuery).
 			WithArgs(input.Id).WillReturnRows(sqlmock.NewRows([]string{"id", "name",
-			"phone_number"}).AddRow(expectedOutput.Id, expectedOutput.Name, expectedOutput.PhoneNumber))
+			"phone_number", "password_hash", "phone_verified_at", "successful_login", "failed_login", "last_failed_login_at",
+			"version"}).AddRow(expectedOutput.Id, expectedOutput.Name, expectedOutput.PhoneNumber, expectedOutput.Password,
+			expectedOutput.PhoneVerifiedAt, expectedOutput.NumOfSuccessfulLogin, expectedOutput.NumOfFailedLogin,
+			expectedOutput.LastFailedLoginAt, expectedOutput.Version))
 
 		output, err := repo.GetUserById(ctx, input)
 		assert.Equal(t, expectedOutput, output)
@@ -260,6 +333,143 @@ func TestRepository_GetUserById(t *testing.T) {
 	})
 }
 
+func TestRepository_RecordFailedLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_login \\(user_id, successful_login, last_login_at, failed_login, last_failed_login_at\\) " +
+		"VALUES \\(\\$1, 0, NULL, 1, \\$2\\) ON CONFLICT \\(user_id\\) DO UPDATE SET failed_login = CASE (.+) " +
+		"RETURNING failed_login"
+	now := time.Now()
+	input := RecordFailedLoginInput{UserId: uuid.New(), FailedAt: now, WindowStart: now.Add(-15 * time.Minute)}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.FailedAt, input.WindowStart).
+			WillReturnRows(sqlmock.NewRows([]string{"failed_login"}).AddRow(3))
+
+		output, err := repo.RecordFailedLogin(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, RecordFailedLoginOutput{NumOfFailedLogin: 3}, output)
+	})
+
+	t.Run("query row context returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.FailedAt, input.WindowStart).
+			WillReturnError(errors.New("error"))
+
+		output, err := repo.RecordFailedLogin(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, output)
+	})
+}
+
+func TestRepository_InsertLoginEvent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_login_event (.+) VALUES (.+)"
+	input := InsertLoginEventInput{
+		UserId:     uuid.New(),
+		Successful: false,
+		Reason:     "wrong_password",
+		IpAddress:  "203.0.113.7",
+		UserAgent:  "curl/8.4.0",
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.Successful, input.Reason, input.IpAddress, input.UserAgent).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.InsertLoginEvent(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.Successful, input.Reason, input.IpAddress, input.UserAgent).
+			WillReturnError(errors.New("error"))
+
+		err := repo.InsertLoginEvent(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_ListLoginEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT id, successful, reason, ip_address, user_agent, created_at FROM user_login_event WHERE user_id = (.+) ORDER BY id DESC LIMIT (.+)"
+	input := ListLoginEventsInput{UserId: uuid.New(), BeforeId: 42, Limit: 2}
+	columns := []string{"id", "successful", "reason", "ip_address", "user_agent", "created_at"}
+	events := []LoginEvent{
+		{Id: 41, Successful: true, Reason: "password", IpAddress: "203.0.113.7", UserAgent: "curl/8.4.0", CreatedAt: time.Now()},
+		{Id: 40, Successful: false, Reason: "wrong_password", IpAddress: "198.51.100.23", UserAgent: "okhttp/4.12.0",
+			CreatedAt: time.Now().Add(-time.Minute)},
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns)
+		for _, event := range events {
+			rows.AddRow(event.Id, event.Successful, event.Reason, event.IpAddress, event.UserAgent, event.CreatedAt)
+		}
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.BeforeId, input.Limit).WillReturnRows(rows)
+
+		output, err := repo.ListLoginEvents(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, events, output.Events)
+	})
+
+	t.Run("no events", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.BeforeId, input.Limit).WillReturnRows(sqlmock.NewRows(columns))
+
+		output, err := repo.ListLoginEvents(ctx, input)
+		assert.Nil(t, err)
+		assert.Empty(t, output.Events)
+	})
+
+	t.Run("query returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.BeforeId, input.Limit).WillReturnError(errors.New("error"))
+
+		_, err := repo.ListLoginEvents(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("rows return error", func(t *testing.T) {
+		event := events[0]
+		rows := sqlmock.NewRows(columns).
+			AddRow(event.Id, event.Successful, event.Reason, event.IpAddress, event.UserAgent, event.CreatedAt).
+			RowError(0, errors.New("error"))
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.BeforeId, input.Limit).WillReturnRows(rows)
+
+		_, err := repo.ListLoginEvents(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
 func TestRepository_UpdateUser(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -275,7 +485,7 @@ func TestRepository_UpdateUser(t *testing.T) {
 
 	ctx := context.Background()
 	repo := &Repository{Db: db}
-	expectedQuery := "UPDATE user_master (.+)"
+	expectedQuery := "UPDATE user_master SET (.+) version = version \\+ 1 WHERE id = (.+) AND version = (.+)"
 
 	t.Run("positive", func(t *testing.T) {
 		var (
@@ -283,11 +493,12 @@ func TestRepository_UpdateUser(t *testing.T) {
 				Id:          uuid.New().String(),
 				PhoneNumber: "+628787878",
 				Name:        "Ruru's Mirapas",
+				Version:     2,
 			}
 		)
 
 		mock.ExpectExec(expectedQuery).
-			WithArgs(input.Id, input.PhoneNumber, input.Name).
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Version).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
 		err := repo.UpdateUser(ctx, input)
@@ -300,14 +511,1503 @@ func TestRepository_UpdateUser(t *testing.T) {
 				Id:          uuid.New().String(),
 				PhoneNumber: "+628787878",
 				Name:        "Ruru's Mirapas",
+				Version:     2,
 			}
 		)
 
 		mock.ExpectExec(expectedQuery).
-			WithArgs(input.Id, input.PhoneNumber, input.Name).
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Version).
 			WillReturnError(errors.New("error"))
 
 		err := repo.UpdateUser(ctx, input)
 		assert.EqualError(t, err, "error")
 	})
+
+	t.Run("phone number already registered", func(t *testing.T) {
+		var (
+			input = UpdateUserInput{
+				Id:          uuid.New().String(),
+				PhoneNumber: "+628787878",
+				Name:        "Ruru's Mirapas",
+				Version:     2,
+			}
+		)
+
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Version).
+			WillReturnError(&pq.Error{Code: "23505", Constraint: "phone_number_key"})
+
+		err := repo.UpdateUser(ctx, input)
+		assert.Equal(t, &common.UniqueViolationError{Constraint: "phone_number_key"}, err)
+	})
+
+	t.Run("version mismatch", func(t *testing.T) {
+		var (
+			input = UpdateUserInput{
+				Id:          uuid.New().String(),
+				PhoneNumber: "+628787878",
+				Name:        "Ruru's Mirapas",
+				Version:     2,
+			}
+		)
+
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Version).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UpdateUser(ctx, input)
+		assert.Equal(t, common.ErrUserVersionMismatch, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		var (
+			input = UpdateUserInput{
+				Id:          uuid.New().String(),
+				PhoneNumber: "+628787878",
+				Name:        "Ruru's Mirapas",
+				Version:     2,
+			}
+		)
+
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.PhoneNumber, input.Name, input.Version).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.UpdateUser(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_UpdateUserPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db, PasswordHistoryDepth: 3}
+	expectedQuery := "UPDATE user_master SET password_hash = (.+) WHERE id = (.+)"
+	insertHistoryQuery := "INSERT INTO user_password_history (.+)"
+	pruneHistoryQuery := "DELETE FROM user_password_history WHERE user_id = (.+) AND id NOT IN (.+) LIMIT (.+)"
+	input := UpdateUserPasswordInput{Id: uuid.New().String(), Password: "hashedPassword"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertHistoryQuery).WithArgs(input.Id, input.Password).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(pruneHistoryQuery).WithArgs(input.Id, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.Password).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.Equal(t, common.ErrUserNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.Password).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+		mock.ExpectRollback()
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.Password).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("prune password history returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertHistoryQuery).WithArgs(input.Id, input.Password).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(pruneHistoryQuery).WithArgs(input.Id, 3).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.UpdateUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_RehashUserPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_master SET password_hash = (.+) WHERE id = (.+) AND password_hash = (.+)"
+	input := RehashUserPasswordInput{Id: uuid.New(), CurrentPassword: "bcryptHash", Password: "argon2idHash"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.CurrentPassword, input.Password).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.RehashUserPassword(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("password changed in the meantime", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.CurrentPassword, input.Password).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.RehashUserPassword(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.Id, input.CurrentPassword, input.Password).
+			WillReturnError(errors.New("error"))
+
+		err := repo.RehashUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_InsertRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_refresh_token (.+)"
+	input := InsertRefreshTokenInput{
+		Id:        uuid.New(),
+		UserId:    uuid.New(),
+		FamilyId:  uuid.New(),
+		TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.UserId, input.FamilyId, input.TokenHash, input.ExpiresAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.InsertRefreshToken(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.UserId, input.FamilyId, input.TokenHash, input.ExpiresAt).
+			WillReturnError(errors.New("error"))
+
+		err := repo.InsertRefreshToken(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_GetRefreshTokenByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT id, user_id, family_id, expires_at, used_at, revoked_at FROM user_refresh_token WHERE token_hash = (.+)"
+	input := GetRefreshTokenByHashInput{TokenHash: "hash"}
+
+	t.Run("positive", func(t *testing.T) {
+		expectedOutput := GetRefreshTokenByHashOutput{
+			Id:        uuid.New(),
+			UserId:    uuid.New(),
+			FamilyId:  uuid.New(),
+			ExpiresAt: time.Now().Add(time.Hour),
+			UsedAt:    sql.NullTime{Time: time.Now(), Valid: true},
+		}
+
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenHash).WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "family_id",
+			"expires_at", "used_at", "revoked_at"}).AddRow(expectedOutput.Id, expectedOutput.UserId,
+			expectedOutput.FamilyId, expectedOutput.ExpiresAt, expectedOutput.UsedAt.Time, nil))
+
+		output, err := repo.GetRefreshTokenByHash(ctx, input)
+		assert.Equal(t, expectedOutput, output)
+		assert.Nil(t, err)
+	})
+
+	t.Run("query row context returns no rows", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenHash).WillReturnError(sql.ErrNoRows)
+
+		output, err := repo.GetRefreshTokenByHash(ctx, input)
+		assert.EqualError(t, common.ErrRefreshTokenNotFound, err.Error())
+		assert.Empty(t, output)
+	})
+
+	t.Run("query row context returns other error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenHash).WillReturnError(errors.New("error"))
+
+		output, err := repo.GetRefreshTokenByHash(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, output)
+	})
+}
+
+func TestRepository_MarkRefreshTokenUsed(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_refresh_token SET used_at = NOW\\(\\) WHERE id = (.+) AND used_at IS NULL AND revoked_at IS NULL"
+	input := MarkRefreshTokenUsedInput{Id: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.MarkRefreshTokenUsed(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("refresh token already used", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.MarkRefreshTokenUsed(ctx, input)
+		assert.Equal(t, common.ErrRefreshTokenAlreadyUsed, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.MarkRefreshTokenUsed(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id).
+			WillReturnError(errors.New("error"))
+
+		err := repo.MarkRefreshTokenUsed(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_RevokeRefreshTokenFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	revokeTokensQuery := "UPDATE user_refresh_token SET revoked_at = NOW\\(\\) WHERE family_id = (.+)"
+	revokeSessionQuery := "UPDATE user_session SET revoked_at = NOW\\(\\) WHERE id = (.+)"
+	input := RevokeRefreshTokenFamilyInput{FamilyId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.FamilyId).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.FamilyId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.RevokeRefreshTokenFamily(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.RevokeRefreshTokenFamily(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("revoke refresh tokens returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.FamilyId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeRefreshTokenFamily(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke session returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.FamilyId).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.FamilyId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeRefreshTokenFamily(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_RevokeUserRefreshTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	revokeTokensQuery := "UPDATE user_refresh_token SET revoked_at = NOW\\(\\) WHERE user_id = (.+)"
+	revokeSessionsQuery := "UPDATE user_session SET revoked_at = NOW\\(\\) WHERE user_id = (.+)"
+	input := RevokeUserRefreshTokensInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(revokeSessionsQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err := repo.RevokeUserRefreshTokens(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.RevokeUserRefreshTokens(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("revoke refresh tokens returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeUserRefreshTokens(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke sessions returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(revokeSessionsQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeUserRefreshTokens(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_InsertUserSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_session (.+) VALUES (.+)"
+	input := InsertUserSessionInput{Id: uuid.New(), UserId: uuid.New(), UserAgent: "curl/8.4.0", IpAddress: "203.0.113.7"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.UserId, input.UserAgent, input.IpAddress).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.InsertUserSession(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.UserId, input.UserAgent, input.IpAddress).
+			WillReturnError(errors.New("error"))
+
+		err := repo.InsertUserSession(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_TouchUserSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_session SET last_seen_at = NOW\\(\\), ip_address = (.+) WHERE id = (.+)"
+	input := TouchUserSessionInput{Id: uuid.New(), IpAddress: "203.0.113.7"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.IpAddress).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.TouchUserSession(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.Id, input.IpAddress).
+			WillReturnError(errors.New("error"))
+
+		err := repo.TouchUserSession(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_ListUserSessions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT id, user_agent, ip_address, created_at, last_seen_at FROM user_session WHERE user_id = (.+) ORDER BY last_seen_at DESC"
+	input := ListUserSessionsInput{UserId: uuid.New(), LastSeenAfter: time.Now().Add(-time.Hour)}
+	columns := []string{"id", "user_agent", "ip_address", "created_at", "last_seen_at"}
+	session := UserSession{
+		Id:         uuid.New(),
+		UserAgent:  "curl/8.4.0",
+		IpAddress:  "203.0.113.7",
+		CreatedAt:  time.Now().Add(-time.Minute),
+		LastSeenAt: time.Now(),
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow(session.Id, session.UserAgent, session.IpAddress, session.CreatedAt, session.LastSeenAt)
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.LastSeenAfter).WillReturnRows(rows)
+
+		output, err := repo.ListUserSessions(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, []UserSession{session}, output.Sessions)
+	})
+
+	t.Run("no sessions", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.LastSeenAfter).WillReturnRows(sqlmock.NewRows(columns))
+
+		output, err := repo.ListUserSessions(ctx, input)
+		assert.Nil(t, err)
+		assert.Empty(t, output.Sessions)
+	})
+
+	t.Run("query returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.LastSeenAfter).WillReturnError(errors.New("error"))
+
+		_, err := repo.ListUserSessions(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("rows return error", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow(session.Id, session.UserAgent, session.IpAddress, session.CreatedAt, session.LastSeenAt).
+			RowError(0, errors.New("error"))
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, input.LastSeenAfter).WillReturnRows(rows)
+
+		_, err := repo.ListUserSessions(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_RevokeUserSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	revokeSessionQuery := "UPDATE user_session SET revoked_at = NOW\\(\\) WHERE id = (.+) AND user_id = (.+)"
+	revokeTokensQuery := "UPDATE user_refresh_token SET revoked_at = NOW\\(\\) WHERE family_id = (.+)"
+	input := RevokeUserSessionInput{Id: uuid.New(), UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.Id, input.UserId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.Id).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.RevokeUserSession(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("session not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.Id, input.UserId).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.RevokeUserSession(ctx, input)
+		assert.Equal(t, common.ErrSessionNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.RevokeUserSession(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("revoke session returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.Id, input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeUserSession(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke refresh tokens returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(revokeSessionQuery).WithArgs(input.Id, input.UserId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(revokeTokensQuery).WithArgs(input.Id).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.RevokeUserSession(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_UpsertUserMFA(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	upsertQuery := "INSERT INTO user_mfa (.+) ON CONFLICT \\(user_id\\) DO UPDATE (.+) WHERE user_mfa.confirmed_at IS NULL"
+	deleteCodesQuery := "DELETE FROM user_mfa_recovery_code WHERE user_id = (.+)"
+	insertCodeQuery := "INSERT INTO user_mfa_recovery_code (.+)"
+	input := UpsertUserMFAInput{
+		UserId:             uuid.New(),
+		EncryptedSecret:    "encrypted",
+		RecoveryCodeHashes: []string{"hash1", "hash2"},
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(insertCodeQuery).WithArgs(input.UserId, "hash1").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(insertCodeQuery).WithArgs(input.UserId, "hash2").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.Equal(t, common.ErrMFAAlreadyEnabled, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("upsert returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+		mock.ExpectRollback()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete recovery codes returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("insert recovery code returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertQuery).WithArgs(input.UserId, input.EncryptedSecret).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(insertCodeQuery).WithArgs(input.UserId, "hash1").WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.UpsertUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_GetUserMFA(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT user_id, encrypted_secret, confirmed_at, last_used_step FROM user_mfa WHERE user_id = (.+)"
+	input := GetUserMFAInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		expectedOutput := GetUserMFAOutput{
+			UserId:          input.UserId,
+			EncryptedSecret: "encrypted",
+			ConfirmedAt:     sql.NullTime{Time: time.Now(), Valid: true},
+			LastUsedStep:    100,
+		}
+
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.UserId).WillReturnRows(sqlmock.NewRows([]string{"user_id", "encrypted_secret",
+			"confirmed_at", "last_used_step"}).AddRow(expectedOutput.UserId, expectedOutput.EncryptedSecret,
+			expectedOutput.ConfirmedAt.Time, expectedOutput.LastUsedStep))
+
+		output, err := repo.GetUserMFA(ctx, input)
+		assert.Equal(t, expectedOutput, output)
+		assert.Nil(t, err)
+	})
+
+	t.Run("query row context returns no rows", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(sql.ErrNoRows)
+
+		output, err := repo.GetUserMFA(ctx, input)
+		assert.EqualError(t, common.ErrMFANotFound, err.Error())
+		assert.Empty(t, output)
+	})
+
+	t.Run("query row context returns other error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+
+		output, err := repo.GetUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, output)
+	})
+}
+
+func TestRepository_ConfirmUserMFA(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_mfa SET confirmed_at = NOW\\(\\), last_used_step = (.+) WHERE user_id = (.+) AND confirmed_at IS NULL"
+	input := ConfirmUserMFAInput{UserId: uuid.New(), Step: 100}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.ConfirmUserMFA(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("already confirmed", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.ConfirmUserMFA(ctx, input)
+		assert.Equal(t, common.ErrMFAAlreadyEnabled, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.ConfirmUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnError(errors.New("error"))
+
+		err := repo.ConfirmUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_UpdateUserMFALastUsedStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_mfa SET last_used_step = (.+) WHERE user_id = (.+) AND last_used_step < (.+)"
+	input := UpdateUserMFALastUsedStepInput{UserId: uuid.New(), Step: 100}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpdateUserMFALastUsedStep(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("code replayed", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UpdateUserMFALastUsedStep(ctx, input)
+		assert.Equal(t, common.ErrMFACodeAlreadyUsed, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.UpdateUserMFALastUsedStep(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.Step).WillReturnError(errors.New("error"))
+
+		err := repo.UpdateUserMFALastUsedStep(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_UseMFARecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_mfa_recovery_code SET used_at = NOW\\(\\) WHERE user_id = (.+) AND code_hash = (.+) AND used_at IS NULL"
+	input := UseMFARecoveryCodeInput{UserId: uuid.New(), CodeHash: "hash"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UseMFARecoveryCode(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("recovery code not found or used", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UseMFARecoveryCode(ctx, input)
+		assert.Equal(t, common.ErrMFARecoveryCodeNotFound, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.CodeHash).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.UseMFARecoveryCode(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.CodeHash).WillReturnError(errors.New("error"))
+
+		err := repo.UseMFARecoveryCode(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_DeleteUserMFA(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	deleteCodesQuery := "DELETE FROM user_mfa_recovery_code WHERE user_id = (.+)"
+	deleteMFAQuery := "DELETE FROM user_mfa WHERE user_id = (.+)"
+	input := DeleteUserMFAInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectExec(deleteMFAQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.DeleteUserMFA(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.DeleteUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("delete recovery codes returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.DeleteUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete mfa returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(deleteCodesQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectExec(deleteMFAQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.DeleteUserMFA(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_UpsertPhoneVerification(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_phone_verification (.+) ON CONFLICT \\(user_id\\) DO UPDATE (.+) " +
+		"WHERE user_phone_verification.sent_at <= (.+)"
+	now := time.Now()
+	input := UpsertPhoneVerificationInput{
+		UserId:         uuid.New(),
+		PhoneNumber:    "+62123456789",
+		CodeHash:       "hash",
+		ExpiresAt:      now.Add(5 * time.Minute),
+		SentAt:         now,
+		LastSentBefore: now.Add(-time.Minute),
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpsertPhoneVerification(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("previous code sent too recently", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UpsertPhoneVerification(ctx, input)
+		assert.Equal(t, common.ErrPhoneVerificationCooldown, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.UpsertPhoneVerification(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.PhoneNumber, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnError(errors.New("error"))
+
+		err := repo.UpsertPhoneVerification(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_GetPhoneVerification(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT user_id, phone_number, code_hash, attempts, expires_at, sent_at " +
+		"FROM user_phone_verification WHERE user_id = (.+)"
+	input := GetPhoneVerificationInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		now := time.Now()
+		expectedOutput := GetPhoneVerificationOutput{
+			UserId:      input.UserId,
+			PhoneNumber: "+62123456789",
+			CodeHash:    "hash",
+			Attempts:    2,
+			ExpiresAt:   now.Add(5 * time.Minute),
+			SentAt:      now,
+		}
+
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "phone_number", "code_hash", "attempts", "expires_at", "sent_at"}).
+				AddRow(expectedOutput.UserId, expectedOutput.PhoneNumber, expectedOutput.CodeHash, expectedOutput.Attempts,
+					expectedOutput.ExpiresAt, expectedOutput.SentAt))
+
+		output, err := repo.GetPhoneVerification(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedOutput, output)
+	})
+
+	t.Run("query row context returns no rows", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(sql.ErrNoRows)
+
+		output, err := repo.GetPhoneVerification(ctx, input)
+		assert.Equal(t, common.ErrPhoneVerificationNotFound, err)
+		assert.Empty(t, output)
+	})
+
+	t.Run("query row context returns other error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+
+		output, err := repo.GetPhoneVerification(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, output)
+	})
+}
+
+func TestRepository_IncrementPhoneVerificationAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_phone_verification SET attempts = attempts \\+ 1 WHERE user_id = (.+) AND attempts < (.+)"
+	input := IncrementPhoneVerificationAttemptsInput{UserId: uuid.New(), MaxAttempts: 5}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.IncrementPhoneVerificationAttempts(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("attempts exceeded", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.IncrementPhoneVerificationAttempts(ctx, input)
+		assert.Equal(t, common.ErrPhoneVerificationAttemptsExceeded, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.IncrementPhoneVerificationAttempts(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnError(errors.New("error"))
+
+		err := repo.IncrementPhoneVerificationAttempts(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_VerifyUserPhone(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	verifyQuery := "UPDATE user_master SET phone_verified_at = NOW\\(\\), version = version \\+ 1 WHERE id = (.+) AND phone_number = (.+)"
+	deleteQuery := "DELETE FROM user_phone_verification WHERE user_id = (.+)"
+	input := VerifyUserPhoneInput{UserId: uuid.New(), PhoneNumber: "+62123456789"}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(verifyQuery).WithArgs(input.UserId, input.PhoneNumber).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(deleteQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := repo.VerifyUserPhone(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.VerifyUserPhone(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("phone number changed", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(verifyQuery).WithArgs(input.UserId, input.PhoneNumber).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.VerifyUserPhone(ctx, input)
+		assert.Equal(t, common.ErrPhoneVerificationNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("verify returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(verifyQuery).WithArgs(input.UserId, input.PhoneNumber).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.VerifyUserPhone(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("delete returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(verifyQuery).WithArgs(input.UserId, input.PhoneNumber).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(deleteQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.VerifyUserPhone(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_UpsertPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "INSERT INTO user_password_reset (.+) ON CONFLICT \\(user_id\\) DO UPDATE (.+) " +
+		"WHERE user_password_reset.sent_at <= (.+)"
+	now := time.Now()
+	input := UpsertPasswordResetInput{
+		UserId:         uuid.New(),
+		CodeHash:       "hash",
+		ExpiresAt:      now.Add(5 * time.Minute),
+		SentAt:         now,
+		LastSentBefore: now.Add(-time.Minute),
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.UpsertPasswordReset(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("previous code sent too recently", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.UpsertPasswordReset(ctx, input)
+		assert.Equal(t, common.ErrPasswordResetCooldown, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.UpsertPasswordReset(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.CodeHash, input.ExpiresAt, input.SentAt, input.LastSentBefore).
+			WillReturnError(errors.New("error"))
+
+		err := repo.UpsertPasswordReset(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_GetPasswordReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "SELECT user_id, code_hash, attempts, expires_at, sent_at FROM user_password_reset WHERE user_id = (.+)"
+	input := GetPasswordResetInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		now := time.Now()
+		expectedOutput := GetPasswordResetOutput{
+			UserId:    input.UserId,
+			CodeHash:  "hash",
+			Attempts:  1,
+			ExpiresAt: now.Add(5 * time.Minute),
+			SentAt:    now,
+		}
+
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "code_hash", "attempts", "expires_at", "sent_at"}).
+				AddRow(expectedOutput.UserId, expectedOutput.CodeHash, expectedOutput.Attempts, expectedOutput.ExpiresAt,
+					expectedOutput.SentAt))
+
+		output, err := repo.GetPasswordReset(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedOutput, output)
+	})
+
+	t.Run("query row context returns no rows", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(sql.ErrNoRows)
+
+		output, err := repo.GetPasswordReset(ctx, input)
+		assert.Equal(t, common.ErrPasswordResetNotFound, err)
+		assert.Empty(t, output)
+	})
+
+	t.Run("query row context returns other error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+
+		output, err := repo.GetPasswordReset(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Empty(t, output)
+	})
+}
+
+func TestRepository_IncrementPasswordResetAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	expectedQuery := "UPDATE user_password_reset SET attempts = attempts \\+ 1 WHERE user_id = (.+) AND attempts < (.+)"
+	input := IncrementPasswordResetAttemptsInput{UserId: uuid.New(), MaxAttempts: 5}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := repo.IncrementPasswordResetAttempts(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("attempts exceeded", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := repo.IncrementPasswordResetAttempts(ctx, input)
+		assert.Equal(t, common.ErrPasswordResetAttemptsExceeded, err)
+	})
+
+	t.Run("rows affected returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).
+			WillReturnResult(sqlmock.NewErrorResult(errors.New("error")))
+
+		err := repo.IncrementPasswordResetAttempts(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).WithArgs(input.UserId, input.MaxAttempts).WillReturnError(errors.New("error"))
+
+		err := repo.IncrementPasswordResetAttempts(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestRepository_ResetUserPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db}
+	consumeQuery := "DELETE FROM user_password_reset WHERE user_id = (.+) AND code_hash = (.+)"
+	updatePasswordQuery := "UPDATE user_master SET password_hash = (.+) WHERE id = (.+)"
+	revokeQuery := "UPDATE user_refresh_token SET revoked_at = NOW\\(\\) WHERE user_id = (.+) AND revoked_at IS NULL"
+	revokeSessionsQuery := "UPDATE user_session SET revoked_at = NOW\\(\\) WHERE user_id = (.+) AND revoked_at IS NULL"
+	insertHistoryQuery := "INSERT INTO user_password_history (.+)"
+	pruneHistoryQuery := "DELETE FROM user_password_history (.+)"
+	input := ResetUserPasswordInput{UserId: uuid.New(), CodeHash: "hash", Password: "hashedPassword"}
+
+	expectRecordPasswordHistory := func() {
+		mock.ExpectExec(insertHistoryQuery).WithArgs(input.UserId.String(), input.Password).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(pruneHistoryQuery).WithArgs(input.UserId.String(), defaultPasswordHistoryDepth).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(consumeQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updatePasswordQuery).WithArgs(input.UserId, input.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRecordPasswordHistory()
+		mock.ExpectExec(revokeQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(revokeSessionsQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.Nil(t, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("begin returns error", func(t *testing.T) {
+		mock.ExpectBegin().WillReturnError(errors.New("error"))
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("code already consumed", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(consumeQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.Equal(t, common.ErrPasswordResetNotFound, err)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("update password returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(consumeQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updatePasswordQuery).WithArgs(input.UserId, input.Password).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke refresh tokens returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(consumeQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updatePasswordQuery).WithArgs(input.UserId, input.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRecordPasswordHistory()
+		mock.ExpectExec(revokeQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("revoke sessions returns error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(consumeQuery).WithArgs(input.UserId, input.CodeHash).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(updatePasswordQuery).WithArgs(input.UserId, input.Password).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectRecordPasswordHistory()
+		mock.ExpectExec(revokeQuery).WithArgs(input.UserId).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec(revokeSessionsQuery).WithArgs(input.UserId).WillReturnError(errors.New("error"))
+		mock.ExpectRollback()
+
+		err := repo.ResetUserPassword(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_GetPasswordHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	repo := &Repository{Db: db, PasswordHistoryDepth: 3}
+	expectedQuery := "SELECT password_hash FROM user_password_history WHERE user_id = (.+) ORDER BY id DESC LIMIT (.+)"
+	input := GetPasswordHistoryInput{UserId: uuid.New()}
+
+	t.Run("positive", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"password_hash"}).AddRow("hash3").AddRow("hash2").AddRow("hash1")
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, 3).WillReturnRows(rows)
+
+		output, err := repo.GetPasswordHistory(ctx, input)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"hash3", "hash2", "hash1"}, output.PasswordHashes)
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, 3).WillReturnRows(sqlmock.NewRows([]string{"password_hash"}))
+
+		output, err := repo.GetPasswordHistory(ctx, input)
+		assert.Nil(t, err)
+		assert.Empty(t, output.PasswordHashes)
+	})
+
+	t.Run("query returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, 3).WillReturnError(errors.New("error"))
+
+		_, err := repo.GetPasswordHistory(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+
+	t.Run("rows return error", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"password_hash"}).AddRow("hash3").RowError(0, errors.New("error"))
+		mock.ExpectQuery(expectedQuery).WithArgs(input.UserId, 3).WillReturnRows(rows)
+
+		_, err := repo.GetPasswordHistory(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
 }
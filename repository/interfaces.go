@@ -7,5 +7,35 @@ type RepositoryInterface interface {
 	GetUserById(ctx context.Context, input GetUserByIdInput) (output GetUserByIdOutput, err error)
 	InsertUser(ctx context.Context, input InsertUserInput) (err error)
 	UpdateUser(ctx context.Context, input UpdateUserInput) (err error)
-	UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) (err error)
+	UpdateUserPassword(ctx context.Context, input UpdateUserPasswordInput) (err error)
+	RehashUserPassword(ctx context.Context, input RehashUserPasswordInput) (err error)
+	UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) (output UpsertUserLoginOutput, err error)
+	RecordFailedLogin(ctx context.Context, input RecordFailedLoginInput) (output RecordFailedLoginOutput, err error)
+	InsertLoginEvent(ctx context.Context, input InsertLoginEventInput) (err error)
+	ListLoginEvents(ctx context.Context, input ListLoginEventsInput) (output ListLoginEventsOutput, err error)
+	InsertRefreshToken(ctx context.Context, input InsertRefreshTokenInput) (err error)
+	GetRefreshTokenByHash(ctx context.Context, input GetRefreshTokenByHashInput) (output GetRefreshTokenByHashOutput, err error)
+	MarkRefreshTokenUsed(ctx context.Context, input MarkRefreshTokenUsedInput) (err error)
+	RevokeRefreshTokenFamily(ctx context.Context, input RevokeRefreshTokenFamilyInput) (err error)
+	RevokeUserRefreshTokens(ctx context.Context, input RevokeUserRefreshTokensInput) (err error)
+	InsertUserSession(ctx context.Context, input InsertUserSessionInput) (err error)
+	TouchUserSession(ctx context.Context, input TouchUserSessionInput) (err error)
+	ListUserSessions(ctx context.Context, input ListUserSessionsInput) (output ListUserSessionsOutput, err error)
+	RevokeUserSession(ctx context.Context, input RevokeUserSessionInput) (err error)
+	UpsertUserMFA(ctx context.Context, input UpsertUserMFAInput) (err error)
+	GetUserMFA(ctx context.Context, input GetUserMFAInput) (output GetUserMFAOutput, err error)
+	ConfirmUserMFA(ctx context.Context, input ConfirmUserMFAInput) (err error)
+	UpdateUserMFALastUsedStep(ctx context.Context, input UpdateUserMFALastUsedStepInput) (err error)
+	UseMFARecoveryCode(ctx context.Context, input UseMFARecoveryCodeInput) (err error)
+	DeleteUserMFA(ctx context.Context, input DeleteUserMFAInput) (err error)
+	UpsertPhoneVerification(ctx context.Context, input UpsertPhoneVerificationInput) (err error)
+	GetPhoneVerification(ctx context.Context, input GetPhoneVerificationInput) (output GetPhoneVerificationOutput, err error)
+	IncrementPhoneVerificationAttempts(ctx context.Context, input IncrementPhoneVerificationAttemptsInput) (err error)
+	VerifyUserPhone(ctx context.Context, input VerifyUserPhoneInput) (err error)
+	UpsertPasswordReset(ctx context.Context, input UpsertPasswordResetInput) (err error)
+	GetPasswordReset(ctx context.Context, input GetPasswordResetInput) (output GetPasswordResetOutput, err error)
+	IncrementPasswordResetAttempts(ctx context.Context, input IncrementPasswordResetAttemptsInput) (err error)
+	ResetUserPassword(ctx context.Context, input ResetUserPasswordInput) (err error)
+	GetPasswordHistory(ctx context.Context, input GetPasswordHistoryInput) (output GetPasswordHistoryOutput, err error)
+	Ping(ctx context.Context) (err error)
 }
@@ -34,6 +34,94 @@ func (m *MockRepositoryInterface) EXPECT() *MockRepositoryInterfaceMockRecorder
 	return m.recorder
 }
 
+// ConfirmUserMFA mocks base method.
+func (m *MockRepositoryInterface) ConfirmUserMFA(ctx context.Context, input ConfirmUserMFAInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmUserMFA", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConfirmUserMFA indicates an expected call of ConfirmUserMFA.
+func (mr *MockRepositoryInterfaceMockRecorder) ConfirmUserMFA(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmUserMFA", reflect.TypeOf((*MockRepositoryInterface)(nil).ConfirmUserMFA), ctx, input)
+}
+
+// DeleteUserMFA mocks base method.
+func (m *MockRepositoryInterface) DeleteUserMFA(ctx context.Context, input DeleteUserMFAInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserMFA", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserMFA indicates an expected call of DeleteUserMFA.
+func (mr *MockRepositoryInterfaceMockRecorder) DeleteUserMFA(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserMFA", reflect.TypeOf((*MockRepositoryInterface)(nil).DeleteUserMFA), ctx, input)
+}
+
+// GetPasswordHistory mocks base method.
+func (m *MockRepositoryInterface) GetPasswordHistory(ctx context.Context, input GetPasswordHistoryInput) (GetPasswordHistoryOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPasswordHistory", ctx, input)
+	ret0, _ := ret[0].(GetPasswordHistoryOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPasswordHistory indicates an expected call of GetPasswordHistory.
+func (mr *MockRepositoryInterfaceMockRecorder) GetPasswordHistory(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPasswordHistory", reflect.TypeOf((*MockRepositoryInterface)(nil).GetPasswordHistory), ctx, input)
+}
+
+// GetPasswordReset mocks base method.
+func (m *MockRepositoryInterface) GetPasswordReset(ctx context.Context, input GetPasswordResetInput) (GetPasswordResetOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPasswordReset", ctx, input)
+	ret0, _ := ret[0].(GetPasswordResetOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPasswordReset indicates an expected call of GetPasswordReset.
+func (mr *MockRepositoryInterfaceMockRecorder) GetPasswordReset(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPasswordReset", reflect.TypeOf((*MockRepositoryInterface)(nil).GetPasswordReset), ctx, input)
+}
+
+// GetPhoneVerification mocks base method.
+func (m *MockRepositoryInterface) GetPhoneVerification(ctx context.Context, input GetPhoneVerificationInput) (GetPhoneVerificationOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPhoneVerification", ctx, input)
+	ret0, _ := ret[0].(GetPhoneVerificationOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPhoneVerification indicates an expected call of GetPhoneVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) GetPhoneVerification(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPhoneVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).GetPhoneVerification), ctx, input)
+}
+
+// GetRefreshTokenByHash mocks base method.
+func (m *MockRepositoryInterface) GetRefreshTokenByHash(ctx context.Context, input GetRefreshTokenByHashInput) (GetRefreshTokenByHashOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRefreshTokenByHash", ctx, input)
+	ret0, _ := ret[0].(GetRefreshTokenByHashOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRefreshTokenByHash indicates an expected call of GetRefreshTokenByHash.
+func (mr *MockRepositoryInterfaceMockRecorder) GetRefreshTokenByHash(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRefreshTokenByHash", reflect.TypeOf((*MockRepositoryInterface)(nil).GetRefreshTokenByHash), ctx, input)
+}
+
 // GetUserById mocks base method.
 func (m *MockRepositoryInterface) GetUserById(ctx context.Context, input GetUserByIdInput) (GetUserByIdOutput, error) {
 	m.ctrl.T.Helper()
@@ -64,6 +152,77 @@ func (mr *MockRepositoryInterfaceMockRecorder) GetUserByPhoneNumber(ctx, input i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByPhoneNumber", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUserByPhoneNumber), ctx, input)
 }
 
+// GetUserMFA mocks base method.
+func (m *MockRepositoryInterface) GetUserMFA(ctx context.Context, input GetUserMFAInput) (GetUserMFAOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserMFA", ctx, input)
+	ret0, _ := ret[0].(GetUserMFAOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserMFA indicates an expected call of GetUserMFA.
+func (mr *MockRepositoryInterfaceMockRecorder) GetUserMFA(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserMFA", reflect.TypeOf((*MockRepositoryInterface)(nil).GetUserMFA), ctx, input)
+}
+
+// IncrementPasswordResetAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementPasswordResetAttempts(ctx context.Context, input IncrementPasswordResetAttemptsInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPasswordResetAttempts", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementPasswordResetAttempts indicates an expected call of IncrementPasswordResetAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementPasswordResetAttempts(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPasswordResetAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementPasswordResetAttempts), ctx, input)
+}
+
+// IncrementPhoneVerificationAttempts mocks base method.
+func (m *MockRepositoryInterface) IncrementPhoneVerificationAttempts(ctx context.Context, input IncrementPhoneVerificationAttemptsInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPhoneVerificationAttempts", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementPhoneVerificationAttempts indicates an expected call of IncrementPhoneVerificationAttempts.
+func (mr *MockRepositoryInterfaceMockRecorder) IncrementPhoneVerificationAttempts(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPhoneVerificationAttempts", reflect.TypeOf((*MockRepositoryInterface)(nil).IncrementPhoneVerificationAttempts), ctx, input)
+}
+
+// InsertLoginEvent mocks base method.
+func (m *MockRepositoryInterface) InsertLoginEvent(ctx context.Context, input InsertLoginEventInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertLoginEvent", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertLoginEvent indicates an expected call of InsertLoginEvent.
+func (mr *MockRepositoryInterfaceMockRecorder) InsertLoginEvent(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertLoginEvent", reflect.TypeOf((*MockRepositoryInterface)(nil).InsertLoginEvent), ctx, input)
+}
+
+// InsertRefreshToken mocks base method.
+func (m *MockRepositoryInterface) InsertRefreshToken(ctx context.Context, input InsertRefreshTokenInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertRefreshToken", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertRefreshToken indicates an expected call of InsertRefreshToken.
+func (mr *MockRepositoryInterfaceMockRecorder) InsertRefreshToken(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertRefreshToken", reflect.TypeOf((*MockRepositoryInterface)(nil).InsertRefreshToken), ctx, input)
+}
+
 // InsertUser mocks base method.
 func (m *MockRepositoryInterface) InsertUser(ctx context.Context, input InsertUserInput) error {
 	m.ctrl.T.Helper()
@@ -78,6 +237,177 @@ func (mr *MockRepositoryInterfaceMockRecorder) InsertUser(ctx, input interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUser", reflect.TypeOf((*MockRepositoryInterface)(nil).InsertUser), ctx, input)
 }
 
+// InsertUserSession mocks base method.
+func (m *MockRepositoryInterface) InsertUserSession(ctx context.Context, input InsertUserSessionInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertUserSession", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertUserSession indicates an expected call of InsertUserSession.
+func (mr *MockRepositoryInterfaceMockRecorder) InsertUserSession(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertUserSession", reflect.TypeOf((*MockRepositoryInterface)(nil).InsertUserSession), ctx, input)
+}
+
+// ListLoginEvents mocks base method.
+func (m *MockRepositoryInterface) ListLoginEvents(ctx context.Context, input ListLoginEventsInput) (ListLoginEventsOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLoginEvents", ctx, input)
+	ret0, _ := ret[0].(ListLoginEventsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLoginEvents indicates an expected call of ListLoginEvents.
+func (mr *MockRepositoryInterfaceMockRecorder) ListLoginEvents(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLoginEvents", reflect.TypeOf((*MockRepositoryInterface)(nil).ListLoginEvents), ctx, input)
+}
+
+// ListUserSessions mocks base method.
+func (m *MockRepositoryInterface) ListUserSessions(ctx context.Context, input ListUserSessionsInput) (ListUserSessionsOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserSessions", ctx, input)
+	ret0, _ := ret[0].(ListUserSessionsOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserSessions indicates an expected call of ListUserSessions.
+func (mr *MockRepositoryInterfaceMockRecorder) ListUserSessions(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserSessions", reflect.TypeOf((*MockRepositoryInterface)(nil).ListUserSessions), ctx, input)
+}
+
+// MarkRefreshTokenUsed mocks base method.
+func (m *MockRepositoryInterface) MarkRefreshTokenUsed(ctx context.Context, input MarkRefreshTokenUsedInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkRefreshTokenUsed", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkRefreshTokenUsed indicates an expected call of MarkRefreshTokenUsed.
+func (mr *MockRepositoryInterfaceMockRecorder) MarkRefreshTokenUsed(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkRefreshTokenUsed", reflect.TypeOf((*MockRepositoryInterface)(nil).MarkRefreshTokenUsed), ctx, input)
+}
+
+// Ping mocks base method.
+func (m *MockRepositoryInterface) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockRepositoryInterfaceMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockRepositoryInterface)(nil).Ping), ctx)
+}
+
+// RecordFailedLogin mocks base method.
+func (m *MockRepositoryInterface) RecordFailedLogin(ctx context.Context, input RecordFailedLoginInput) (RecordFailedLoginOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordFailedLogin", ctx, input)
+	ret0, _ := ret[0].(RecordFailedLoginOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RecordFailedLogin indicates an expected call of RecordFailedLogin.
+func (mr *MockRepositoryInterfaceMockRecorder) RecordFailedLogin(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordFailedLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).RecordFailedLogin), ctx, input)
+}
+
+// RehashUserPassword mocks base method.
+func (m *MockRepositoryInterface) RehashUserPassword(ctx context.Context, input RehashUserPasswordInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RehashUserPassword", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RehashUserPassword indicates an expected call of RehashUserPassword.
+func (mr *MockRepositoryInterfaceMockRecorder) RehashUserPassword(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RehashUserPassword", reflect.TypeOf((*MockRepositoryInterface)(nil).RehashUserPassword), ctx, input)
+}
+
+// ResetUserPassword mocks base method.
+func (m *MockRepositoryInterface) ResetUserPassword(ctx context.Context, input ResetUserPasswordInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetUserPassword", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ResetUserPassword indicates an expected call of ResetUserPassword.
+func (mr *MockRepositoryInterfaceMockRecorder) ResetUserPassword(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetUserPassword", reflect.TypeOf((*MockRepositoryInterface)(nil).ResetUserPassword), ctx, input)
+}
+
+// RevokeRefreshTokenFamily mocks base method.
+func (m *MockRepositoryInterface) RevokeRefreshTokenFamily(ctx context.Context, input RevokeRefreshTokenFamilyInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeRefreshTokenFamily", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeRefreshTokenFamily indicates an expected call of RevokeRefreshTokenFamily.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeRefreshTokenFamily(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeRefreshTokenFamily", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeRefreshTokenFamily), ctx, input)
+}
+
+// RevokeUserRefreshTokens mocks base method.
+func (m *MockRepositoryInterface) RevokeUserRefreshTokens(ctx context.Context, input RevokeUserRefreshTokensInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserRefreshTokens", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserRefreshTokens indicates an expected call of RevokeUserRefreshTokens.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeUserRefreshTokens(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserRefreshTokens", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeUserRefreshTokens), ctx, input)
+}
+
+// RevokeUserSession mocks base method.
+func (m *MockRepositoryInterface) RevokeUserSession(ctx context.Context, input RevokeUserSessionInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSession", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSession indicates an expected call of RevokeUserSession.
+func (mr *MockRepositoryInterfaceMockRecorder) RevokeUserSession(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSession", reflect.TypeOf((*MockRepositoryInterface)(nil).RevokeUserSession), ctx, input)
+}
+
+// TouchUserSession mocks base method.
+func (m *MockRepositoryInterface) TouchUserSession(ctx context.Context, input TouchUserSessionInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchUserSession", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchUserSession indicates an expected call of TouchUserSession.
+func (mr *MockRepositoryInterfaceMockRecorder) TouchUserSession(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchUserSession", reflect.TypeOf((*MockRepositoryInterface)(nil).TouchUserSession), ctx, input)
+}
+
 // UpdateUser mocks base method.
 func (m *MockRepositoryInterface) UpdateUser(ctx context.Context, input UpdateUserInput) error {
 	m.ctrl.T.Helper()
@@ -92,16 +422,115 @@ func (mr *MockRepositoryInterfaceMockRecorder) UpdateUser(ctx, input interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUser), ctx, input)
 }
 
-// UpsertUserLogin mocks base method.
-func (m *MockRepositoryInterface) UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) error {
+// UpdateUserMFALastUsedStep mocks base method.
+func (m *MockRepositoryInterface) UpdateUserMFALastUsedStep(ctx context.Context, input UpdateUserMFALastUsedStepInput) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpsertUserLogin", ctx, input)
+	ret := m.ctrl.Call(m, "UpdateUserMFALastUsedStep", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateUserMFALastUsedStep indicates an expected call of UpdateUserMFALastUsedStep.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserMFALastUsedStep(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserMFALastUsedStep", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserMFALastUsedStep), ctx, input)
+}
+
+// UpdateUserPassword mocks base method.
+func (m *MockRepositoryInterface) UpdateUserPassword(ctx context.Context, input UpdateUserPasswordInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUserPassword", ctx, input)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// UpdateUserPassword indicates an expected call of UpdateUserPassword.
+func (mr *MockRepositoryInterfaceMockRecorder) UpdateUserPassword(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUserPassword", reflect.TypeOf((*MockRepositoryInterface)(nil).UpdateUserPassword), ctx, input)
+}
+
+// UpsertPasswordReset mocks base method.
+func (m *MockRepositoryInterface) UpsertPasswordReset(ctx context.Context, input UpsertPasswordResetInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertPasswordReset", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpsertPasswordReset indicates an expected call of UpsertPasswordReset.
+func (mr *MockRepositoryInterfaceMockRecorder) UpsertPasswordReset(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertPasswordReset", reflect.TypeOf((*MockRepositoryInterface)(nil).UpsertPasswordReset), ctx, input)
+}
+
+// UpsertPhoneVerification mocks base method.
+func (m *MockRepositoryInterface) UpsertPhoneVerification(ctx context.Context, input UpsertPhoneVerificationInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertPhoneVerification", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpsertPhoneVerification indicates an expected call of UpsertPhoneVerification.
+func (mr *MockRepositoryInterfaceMockRecorder) UpsertPhoneVerification(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertPhoneVerification", reflect.TypeOf((*MockRepositoryInterface)(nil).UpsertPhoneVerification), ctx, input)
+}
+
+// UpsertUserLogin mocks base method.
+func (m *MockRepositoryInterface) UpsertUserLogin(ctx context.Context, input UpsertUserLoginInput) (UpsertUserLoginOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertUserLogin", ctx, input)
+	ret0, _ := ret[0].(UpsertUserLoginOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // UpsertUserLogin indicates an expected call of UpsertUserLogin.
 func (mr *MockRepositoryInterfaceMockRecorder) UpsertUserLogin(ctx, input interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertUserLogin", reflect.TypeOf((*MockRepositoryInterface)(nil).UpsertUserLogin), ctx, input)
 }
+
+// UpsertUserMFA mocks base method.
+func (m *MockRepositoryInterface) UpsertUserMFA(ctx context.Context, input UpsertUserMFAInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpsertUserMFA", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpsertUserMFA indicates an expected call of UpsertUserMFA.
+func (mr *MockRepositoryInterfaceMockRecorder) UpsertUserMFA(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpsertUserMFA", reflect.TypeOf((*MockRepositoryInterface)(nil).UpsertUserMFA), ctx, input)
+}
+
+// UseMFARecoveryCode mocks base method.
+func (m *MockRepositoryInterface) UseMFARecoveryCode(ctx context.Context, input UseMFARecoveryCodeInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseMFARecoveryCode", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseMFARecoveryCode indicates an expected call of UseMFARecoveryCode.
+func (mr *MockRepositoryInterfaceMockRecorder) UseMFARecoveryCode(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseMFARecoveryCode", reflect.TypeOf((*MockRepositoryInterface)(nil).UseMFARecoveryCode), ctx, input)
+}
+
+// VerifyUserPhone mocks base method.
+func (m *MockRepositoryInterface) VerifyUserPhone(ctx context.Context, input VerifyUserPhoneInput) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyUserPhone", ctx, input)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyUserPhone indicates an expected call of VerifyUserPhone.
+func (mr *MockRepositoryInterfaceMockRecorder) VerifyUserPhone(ctx, input interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyUserPhone", reflect.TypeOf((*MockRepositoryInterface)(nil).VerifyUserPhone), ctx, input)
+}
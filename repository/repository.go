@@ -1,16 +1,45 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/lib/pq"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dityuiri/UserServiceTest/common"
+)
+
+// SQLSTATE of a unique constraint violation
+const uniqueViolationCode = "23505"
+
+// Delays between the pings while waiting for the database, doubling from the first to the longest
+const (
+	waitFirstDelay   = 100 * time.Millisecond
+	waitLongestDelay = 5 * time.Second
 )
 
+// Passwords kept per user to prevent their reuse, including the current one
+const defaultPasswordHistoryDepth = 5
+
 type Repository struct {
 	Db *sql.DB
+
+	// Older password hashes are pruned every time a password is set
+	PasswordHistoryDepth int
 }
 
 type NewRepositoryOptions struct {
 	Dsn string
+
+	// Connection pool, the database/sql defaults are kept for the settings left at zero
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	PasswordHistoryDepth int
 }
 
 func NewRepository(opts NewRepositoryOptions) *Repository {
@@ -18,7 +47,76 @@ func NewRepository(opts NewRepositoryOptions) *Repository {
 	if err != nil {
 		panic(err)
 	}
+
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+
+	if opts.PasswordHistoryDepth <= 0 {
+		opts.PasswordHistoryDepth = defaultPasswordHistoryDepth
+	}
+
 	return &Repository{
-		Db: db,
+		Db:                   db,
+		PasswordHistoryDepth: opts.PasswordHistoryDepth,
+	}
+}
+
+// Ping checks the database is reachable, sql.Open alone never connects
+func (r *Repository) Ping(ctx context.Context) (err error) {
+	return r.Db.PingContext(ctx)
+}
+
+// WaitForDatabase pings the database until it answers, backing off exponentially between the attempts, so the
+// service can start along with it instead of failing the first requests. onRetry is told about every failed attempt
+// and how long until the next one. The last error is returned once the context is done.
+func (r *Repository) WaitForDatabase(ctx context.Context, onRetry func(err error, delay time.Duration)) (err error) {
+	delay := waitFirstDelay
+	for {
+		if err = r.Ping(ctx); err == nil {
+			return
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if onRetry != nil {
+			onRetry(err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > waitLongestDelay {
+			delay = waitLongestDelay
+		}
 	}
 }
+
+// translateError turns the Postgres errors callers have to handle into the errors of the common package
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolationCode {
+		return &common.UniqueViolationError{Constraint: pqErr.Constraint}
+	}
+
+	return err
+}
@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,8 +22,80 @@ func TestNewRepository(t *testing.T) {
 
 		assert.NotNil(t, repository)
 		assert.NotNil(t, repository.Db)
+		assert.Equal(t, defaultPasswordHistoryDepth, repository.PasswordHistoryDepth)
 		defer func(db *sql.DB) {
 			_ = db.Close()
 		}(repository.Db)
 	})
+
+	t.Run("connection pool", func(t *testing.T) {
+		repository := NewRepository(NewRepositoryOptions{Dsn: "valid_dsn", MaxOpenConns: 7})
+		defer func(db *sql.DB) {
+			_ = db.Close()
+		}(repository.Db)
+
+		assert.Equal(t, 7, repository.Db.Stats().MaxOpenConnections)
+	})
+}
+
+func newPingMockRepository(t *testing.T) (*Repository, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return &Repository{Db: db}, mock
+}
+
+func TestRepository_Ping(t *testing.T) {
+	t.Run("positive", func(t *testing.T) {
+		repo, mock := newPingMockRepository(t)
+		mock.ExpectPing()
+
+		assert.Nil(t, repo.Ping(context.Background()))
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		repo, mock := newPingMockRepository(t)
+		mock.ExpectPing().WillReturnError(errors.New("error"))
+
+		assert.EqualError(t, repo.Ping(context.Background()), "error")
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestRepository_WaitForDatabase(t *testing.T) {
+	t.Run("retries with backoff until the database answers", func(t *testing.T) {
+		repo, mock := newPingMockRepository(t)
+		mock.ExpectPing().WillReturnError(errors.New("error"))
+		mock.ExpectPing().WillReturnError(errors.New("error"))
+		mock.ExpectPing()
+
+		var delays []time.Duration
+		err := repo.WaitForDatabase(context.Background(), func(err error, delay time.Duration) {
+			assert.EqualError(t, err, "error")
+			delays = append(delays, delay)
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Duration{waitFirstDelay, 2 * waitFirstDelay}, delays)
+		assert.Nil(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("gives up with the last error", func(t *testing.T) {
+		repo, mock := newPingMockRepository(t)
+		for i := 0; i < 3; i++ {
+			mock.ExpectPing().WillReturnError(errors.New("error"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*waitFirstDelay)
+		defer cancel()
+
+		err := repo.WaitForDatabase(ctx, nil)
+		assert.EqualError(t, err, "error")
+	})
 }
@@ -3,6 +3,8 @@ package repository
 
 import (
 	"database/sql"
+	"time"
+
 	"github.com/google/uuid"
 )
 
@@ -22,25 +24,272 @@ type GetUserByIdInput struct {
 }
 
 type GetUserByIdOutput struct {
-	Id          uuid.UUID
-	Name        string
-	PhoneNumber string
+	Id                   uuid.UUID
+	Name                 string
+	PhoneNumber          string
+	Password             string
+	PhoneVerifiedAt      sql.NullTime
+	NumOfSuccessfulLogin sql.NullInt32
+	NumOfFailedLogin     sql.NullInt32
+	LastFailedLoginAt    sql.NullTime
+
+	// Incremented on every change to the profile
+	Version int32
 }
 
 type GetUserByPhoneNumberOutput struct {
 	Id                   uuid.UUID
 	Name                 string
 	Password             string
+	PhoneVerifiedAt      sql.NullTime
 	NumOfSuccessfulLogin sql.NullInt32
+	NumOfFailedLogin     sql.NullInt32
+	LastFailedLoginAt    sql.NullTime
 }
 
 type UpsertUserLoginInput struct {
-	UserId               uuid.UUID
+	UserId uuid.UUID
+}
+
+type UpsertUserLoginOutput struct {
 	NumOfSuccessfulLogin int32
 }
 
+type InsertLoginEventInput struct {
+	UserId     uuid.UUID
+	Successful bool
+	Reason     string
+	IpAddress  string
+	UserAgent  string
+}
+
+type ListLoginEventsInput struct {
+	UserId   uuid.UUID
+	BeforeId int64
+	Limit    int
+}
+
+type ListLoginEventsOutput struct {
+	Events []LoginEvent
+}
+
+type LoginEvent struct {
+	Id         int64
+	Successful bool
+	Reason     string
+	IpAddress  string
+	UserAgent  string
+	CreatedAt  time.Time
+}
+
+// RecordFailedLoginInput counts a failed login, starting over when the previous failure happened before WindowStart
+type RecordFailedLoginInput struct {
+	UserId      uuid.UUID
+	FailedAt    time.Time
+	WindowStart time.Time
+}
+
+type RecordFailedLoginOutput struct {
+	NumOfFailedLogin int32
+}
+
+// UpdateUserInput updates the profile, only when it's still at Version
 type UpdateUserInput struct {
 	Id          string
 	PhoneNumber string
 	Name        string
+	Version     int32
+}
+
+type UpdateUserPasswordInput struct {
+	Id       string
+	Password string //hashed
+}
+
+// RehashUserPasswordInput replaces the hash of an unchanged password, only while it's still CurrentPassword
+type RehashUserPasswordInput struct {
+	Id              uuid.UUID
+	CurrentPassword string //hashed
+	Password        string //hashed
+}
+
+type InsertRefreshTokenInput struct {
+	Id        uuid.UUID
+	UserId    uuid.UUID
+	FamilyId  uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+}
+
+type GetRefreshTokenByHashInput struct {
+	TokenHash string
+}
+
+type GetRefreshTokenByHashOutput struct {
+	Id        uuid.UUID
+	UserId    uuid.UUID
+	FamilyId  uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	RevokedAt sql.NullTime
+}
+
+type MarkRefreshTokenUsedInput struct {
+	Id uuid.UUID
+}
+
+type RevokeRefreshTokenFamilyInput struct {
+	FamilyId uuid.UUID
+}
+
+type RevokeUserRefreshTokensInput struct {
+	UserId uuid.UUID
+}
+
+// InsertUserSessionInput starts a session, identified by the family of the refresh tokens issued within it
+type InsertUserSessionInput struct {
+	Id        uuid.UUID
+	UserId    uuid.UUID
+	UserAgent string
+	IpAddress string
+}
+
+type TouchUserSessionInput struct {
+	Id        uuid.UUID
+	IpAddress string
+}
+
+type ListUserSessionsInput struct {
+	UserId        uuid.UUID
+	LastSeenAfter time.Time
+}
+
+type ListUserSessionsOutput struct {
+	Sessions []UserSession
+}
+
+type UserSession struct {
+	Id         uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+type RevokeUserSessionInput struct {
+	Id     uuid.UUID
+	UserId uuid.UUID
+}
+
+type UpsertUserMFAInput struct {
+	UserId             uuid.UUID
+	EncryptedSecret    string
+	RecoveryCodeHashes []string
+}
+
+type GetUserMFAInput struct {
+	UserId uuid.UUID
+}
+
+type GetUserMFAOutput struct {
+	UserId          uuid.UUID
+	EncryptedSecret string
+	ConfirmedAt     sql.NullTime
+	LastUsedStep    int64
+}
+
+type ConfirmUserMFAInput struct {
+	UserId uuid.UUID
+	Step   int64
+}
+
+type UpdateUserMFALastUsedStepInput struct {
+	UserId uuid.UUID
+	Step   int64
+}
+
+type UseMFARecoveryCodeInput struct {
+	UserId   uuid.UUID
+	CodeHash string
+}
+
+type DeleteUserMFAInput struct {
+	UserId uuid.UUID
+}
+
+// UpsertPhoneVerificationInput replaces the pending verification of the user,
+// unless the previous code was sent after LastSentBefore
+type UpsertPhoneVerificationInput struct {
+	UserId         uuid.UUID
+	PhoneNumber    string
+	CodeHash       string
+	ExpiresAt      time.Time
+	SentAt         time.Time
+	LastSentBefore time.Time
+}
+
+type GetPhoneVerificationInput struct {
+	UserId uuid.UUID
+}
+
+type GetPhoneVerificationOutput struct {
+	UserId      uuid.UUID
+	PhoneNumber string
+	CodeHash    string
+	Attempts    int32
+	ExpiresAt   time.Time
+	SentAt      time.Time
+}
+
+type IncrementPhoneVerificationAttemptsInput struct {
+	UserId      uuid.UUID
+	MaxAttempts int32
+}
+
+type VerifyUserPhoneInput struct {
+	UserId      uuid.UUID
+	PhoneNumber string
+}
+
+// UpsertPasswordResetInput replaces the pending password reset of the user,
+// unless the previous code was sent after LastSentBefore
+type UpsertPasswordResetInput struct {
+	UserId         uuid.UUID
+	CodeHash       string
+	ExpiresAt      time.Time
+	SentAt         time.Time
+	LastSentBefore time.Time
+}
+
+type GetPasswordResetInput struct {
+	UserId uuid.UUID
+}
+
+type GetPasswordResetOutput struct {
+	UserId    uuid.UUID
+	CodeHash  string
+	Attempts  int32
+	ExpiresAt time.Time
+	SentAt    time.Time
+}
+
+type IncrementPasswordResetAttemptsInput struct {
+	UserId      uuid.UUID
+	MaxAttempts int32
+}
+
+// ResetUserPasswordInput consumes the password reset identified by CodeHash and sets the new password
+type ResetUserPasswordInput struct {
+	UserId   uuid.UUID
+	CodeHash string
+	Password string //hashed
+}
+
+type GetPasswordHistoryInput struct {
+	UserId uuid.UUID
+}
+
+// GetPasswordHistoryOutput holds the hashes of the user's latest passwords, the most recent first
+type GetPasswordHistoryOutput struct {
+	PasswordHashes []string
 }
@@ -0,0 +1,12 @@
+package revocation
+
+import "context"
+
+// Store keeps track of access tokens that must be rejected before they expire
+type Store interface {
+	RevokeToken(ctx context.Context, input RevokeTokenInput) (err error)
+	RevokeUserTokens(ctx context.Context, input RevokeUserTokensInput) (err error)
+	RevokeSession(ctx context.Context, input RevokeSessionInput) (err error)
+	IsRevoked(ctx context.Context, input IsRevokedInput) (revoked bool, err error)
+	PruneExpired(ctx context.Context) (err error)
+}
@@ -0,0 +1,97 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type userRevocation struct {
+	revokedAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-process Store, only suitable for tests and single instance deployments
+type MemoryStore struct {
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	users    map[string]userRevocation
+	sessions map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:   make(map[string]time.Time),
+		users:    make(map[string]userRevocation),
+		sessions: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryStore) RevokeToken(_ context.Context, input RevokeTokenInput) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[input.TokenId] = input.ExpiresAt
+	return
+}
+
+func (s *MemoryStore) RevokeUserTokens(_ context.Context, input RevokeUserTokensInput) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[input.UserId] = userRevocation{revokedAt: input.RevokedAt, expiresAt: input.ExpiresAt}
+	return
+}
+
+func (s *MemoryStore) RevokeSession(_ context.Context, input RevokeSessionInput) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[input.SessionId] = input.ExpiresAt
+	return
+}
+
+func (s *MemoryStore) IsRevoked(_ context.Context, input IsRevokedInput) (revoked bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.tokens[input.TokenId]; ok {
+		return true, nil
+	}
+
+	if user, ok := s.users[input.UserId]; ok && input.IssuedAt.Before(user.revokedAt) {
+		return true, nil
+	}
+
+	if _, ok := s.sessions[input.SessionId]; ok && input.SessionId != "" {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (s *MemoryStore) PruneExpired(_ context.Context) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for tokenId, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, tokenId)
+		}
+	}
+
+	for userId, user := range s.users {
+		if user.expiresAt.Before(now) {
+			delete(s.users, userId)
+		}
+	}
+
+	for sessionId, expiresAt := range s.sessions {
+		if expiresAt.Before(now) {
+			delete(s.sessions, sessionId)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,107 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore_RevokeToken(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		err := store.RevokeToken(ctx, RevokeTokenInput{TokenId: "jti", ExpiresAt: time.Now().Add(time.Minute)})
+		assert.Nil(t, err)
+
+		revoked, err := store.IsRevoked(ctx, IsRevokedInput{TokenId: "jti", UserId: "user", IssuedAt: time.Now()})
+		assert.Nil(t, err)
+		assert.True(t, revoked)
+
+		revoked, err = store.IsRevoked(ctx, IsRevokedInput{TokenId: "other", UserId: "user", IssuedAt: time.Now()})
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+	})
+}
+
+func TestMemoryStore_RevokeUserTokens(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		var (
+			store     = NewMemoryStore()
+			revokedAt = time.Now()
+		)
+
+		err := store.RevokeUserTokens(ctx, RevokeUserTokensInput{UserId: "user", RevokedAt: revokedAt,
+			ExpiresAt: revokedAt.Add(time.Minute)})
+		assert.Nil(t, err)
+
+		// Issued before the revocation
+		revoked, _ := store.IsRevoked(ctx, IsRevokedInput{TokenId: "a", UserId: "user", IssuedAt: revokedAt.Add(-time.Second)})
+		assert.True(t, revoked)
+
+		// Issued after the revocation
+		revoked, _ = store.IsRevoked(ctx, IsRevokedInput{TokenId: "b", UserId: "user", IssuedAt: revokedAt.Add(time.Second)})
+		assert.False(t, revoked)
+
+		// Issued at the time of the revocation
+		revoked, _ = store.IsRevoked(ctx, IsRevokedInput{TokenId: "d", UserId: "user", IssuedAt: revokedAt})
+		assert.False(t, revoked)
+
+		// Other user
+		revoked, _ = store.IsRevoked(ctx, IsRevokedInput{TokenId: "c", UserId: "other", IssuedAt: revokedAt.Add(-time.Second)})
+		assert.False(t, revoked)
+	})
+}
+
+func TestMemoryStore_RevokeSession(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		err := store.RevokeSession(ctx, RevokeSessionInput{SessionId: "session", ExpiresAt: time.Now().Add(time.Minute)})
+		assert.Nil(t, err)
+
+		revoked, err := store.IsRevoked(ctx, IsRevokedInput{TokenId: "a", UserId: "user", SessionId: "session", IssuedAt: time.Now()})
+		assert.Nil(t, err)
+		assert.True(t, revoked)
+
+		// Other session of the same user
+		revoked, _ = store.IsRevoked(ctx, IsRevokedInput{TokenId: "b", UserId: "user", SessionId: "other", IssuedAt: time.Now()})
+		assert.False(t, revoked)
+
+		// Token issued before sessions were introduced
+		revoked, _ = store.IsRevoked(ctx, IsRevokedInput{TokenId: "c", UserId: "user", IssuedAt: time.Now()})
+		assert.False(t, revoked)
+	})
+}
+
+func TestMemoryStore_PruneExpired(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		store := NewMemoryStore()
+		_ = store.RevokeToken(ctx, RevokeTokenInput{TokenId: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+		_ = store.RevokeToken(ctx, RevokeTokenInput{TokenId: "active", ExpiresAt: time.Now().Add(time.Minute)})
+		_ = store.RevokeUserTokens(ctx, RevokeUserTokensInput{UserId: "expired", RevokedAt: time.Now().Add(-time.Hour),
+			ExpiresAt: time.Now().Add(-time.Minute)})
+		_ = store.RevokeUserTokens(ctx, RevokeUserTokensInput{UserId: "active", RevokedAt: time.Now(),
+			ExpiresAt: time.Now().Add(time.Minute)})
+		_ = store.RevokeSession(ctx, RevokeSessionInput{SessionId: "expired", ExpiresAt: time.Now().Add(-time.Minute)})
+		_ = store.RevokeSession(ctx, RevokeSessionInput{SessionId: "active", ExpiresAt: time.Now().Add(time.Minute)})
+
+		err := store.PruneExpired(ctx)
+		assert.Nil(t, err)
+		assert.Len(t, store.tokens, 1)
+		assert.Contains(t, store.tokens, "active")
+		assert.Len(t, store.users, 1)
+		assert.Contains(t, store.users, "active")
+		assert.Len(t, store.sessions, 1)
+		assert.Contains(t, store.sessions, "active")
+	})
+}
@@ -0,0 +1,85 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresStore is a Store shared between every instance of the service.
+// The times are kept in UTC, the columns don't store the time zone.
+type PostgresStore struct {
+	Db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{Db: db}
+}
+
+func (s *PostgresStore) RevokeToken(ctx context.Context, input RevokeTokenInput) (err error) {
+	var query = `
+		INSERT INTO revoked_access_token (token_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (token_id) DO NOTHING
+	`
+
+	_, err = s.Db.ExecContext(ctx, query, input.TokenId, input.ExpiresAt.UTC())
+	return
+}
+
+func (s *PostgresStore) RevokeUserTokens(ctx context.Context, input RevokeUserTokensInput) (err error) {
+	var query = `
+		INSERT INTO revoked_user_access_token (user_id, revoked_at, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id)
+		DO UPDATE
+		SET revoked_at = EXCLUDED.revoked_at, expires_at = EXCLUDED.expires_at
+	`
+
+	_, err = s.Db.ExecContext(ctx, query, input.UserId, input.RevokedAt.UTC(), input.ExpiresAt.UTC())
+	return
+}
+
+func (s *PostgresStore) RevokeSession(ctx context.Context, input RevokeSessionInput) (err error) {
+	var query = `
+		INSERT INTO revoked_session (session_id, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (session_id) DO NOTHING
+	`
+
+	_, err = s.Db.ExecContext(ctx, query, input.SessionId, input.ExpiresAt.UTC())
+	return
+}
+
+func (s *PostgresStore) IsRevoked(ctx context.Context, input IsRevokedInput) (revoked bool, err error) {
+	var query = `
+		SELECT
+			EXISTS (SELECT 1 FROM revoked_access_token WHERE token_id = $1)
+			OR EXISTS (SELECT 1 FROM revoked_user_access_token WHERE user_id = $2 AND revoked_at > $3)
+			OR EXISTS (SELECT 1 FROM revoked_session WHERE session_id = $4)
+	`
+
+	// Tokens issued before sessions were introduced have no session ID, which can't be compared to a UUID
+	sessionId := sql.NullString{String: input.SessionId, Valid: input.SessionId != ""}
+
+	err = s.Db.QueryRowContext(ctx, query, input.TokenId, input.UserId, input.IssuedAt.UTC(), sessionId).Scan(&revoked)
+	return
+}
+
+func (s *PostgresStore) PruneExpired(ctx context.Context) (err error) {
+	var queries = []string{
+		`DELETE FROM revoked_access_token WHERE expires_at < $1`,
+		`DELETE FROM revoked_user_access_token WHERE expires_at < $1`,
+		`DELETE FROM revoked_session WHERE expires_at < $1`,
+	}
+
+	// Rather than NOW(), which is in the time zone of the database session
+	now := time.Now().UTC()
+	for _, query := range queries {
+		if _, err = s.Db.ExecContext(ctx, query, now); err != nil {
+			return
+		}
+	}
+
+	return
+}
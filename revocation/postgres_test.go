@@ -0,0 +1,208 @@
+package revocation
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// The times are given in another time zone than the database's, UTC
+var testTimeZone = time.FixedZone("WIB", 7*60*60)
+
+// utcNow matches the current time in UTC
+type utcNow struct{}
+
+func (utcNow) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	return ok && t.Location() == time.UTC && time.Since(t).Abs() < time.Second
+}
+
+func TestPostgresStore_RevokeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	expectedQuery := "INSERT INTO revoked_access_token (.+) ON CONFLICT \\(token_id\\) DO NOTHING"
+	input := RevokeTokenInput{TokenId: "jti", ExpiresAt: time.Now().In(testTimeZone)}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.TokenId, input.ExpiresAt.UTC()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := store.RevokeToken(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.TokenId, input.ExpiresAt.UTC()).
+			WillReturnError(errors.New("error"))
+
+		err := store.RevokeToken(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestPostgresStore_RevokeUserTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	expectedQuery := "INSERT INTO revoked_user_access_token (.+) ON CONFLICT \\(user_id\\) DO UPDATE (.+)"
+	input := RevokeUserTokensInput{UserId: "user", RevokedAt: time.Now().In(testTimeZone), ExpiresAt: time.Now().In(testTimeZone).Add(time.Minute)}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.RevokedAt.UTC(), input.ExpiresAt.UTC()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := store.RevokeUserTokens(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.UserId, input.RevokedAt.UTC(), input.ExpiresAt.UTC()).
+			WillReturnError(errors.New("error"))
+
+		err := store.RevokeUserTokens(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestPostgresStore_RevokeSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	expectedQuery := "INSERT INTO revoked_session (.+) ON CONFLICT \\(session_id\\) DO NOTHING"
+	input := RevokeSessionInput{SessionId: "session", ExpiresAt: time.Now().In(testTimeZone)}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.SessionId, input.ExpiresAt.UTC()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := store.RevokeSession(ctx, input)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec(expectedQuery).
+			WithArgs(input.SessionId, input.ExpiresAt.UTC()).
+			WillReturnError(errors.New("error"))
+
+		err := store.RevokeSession(ctx, input)
+		assert.EqualError(t, err, "error")
+	})
+}
+
+func TestPostgresStore_IsRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+	expectedQuery := "SELECT EXISTS (.+) OR EXISTS (.+) OR EXISTS (.+)"
+	input := IsRevokedInput{TokenId: "jti", UserId: "user", SessionId: "session", IssuedAt: time.Now().In(testTimeZone)}
+	sessionId := sql.NullString{String: input.SessionId, Valid: true}
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenId, input.UserId, input.IssuedAt.UTC(), sessionId).
+			WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(true))
+
+		revoked, err := store.IsRevoked(ctx, input)
+		assert.Nil(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("token without session", func(t *testing.T) {
+		input := IsRevokedInput{TokenId: "jti", UserId: "user", IssuedAt: time.Now().In(testTimeZone)}
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenId, input.UserId, input.IssuedAt.UTC(), sql.NullString{}).
+			WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(false))
+
+		revoked, err := store.IsRevoked(ctx, input)
+		assert.Nil(t, err)
+		assert.False(t, revoked)
+	})
+
+	t.Run("query row context returns error", func(t *testing.T) {
+		mock.ExpectQuery(expectedQuery).
+			WithArgs(input.TokenId, input.UserId, input.IssuedAt.UTC(), sessionId).
+			WillReturnError(errors.New("error"))
+
+		revoked, err := store.IsRevoked(ctx, input)
+		assert.EqualError(t, err, "error")
+		assert.False(t, revoked)
+	})
+}
+
+func TestPostgresStore_PruneExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Error creating mock database: %v", err)
+	}
+
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	ctx := context.Background()
+	store := NewPostgresStore(db)
+
+	t.Run("positive", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM revoked_access_token WHERE expires_at < \\$1").WithArgs(utcNow{}).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("DELETE FROM revoked_user_access_token WHERE expires_at < \\$1").WithArgs(utcNow{}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM revoked_session WHERE expires_at < \\$1").WithArgs(utcNow{}).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		err := store.PruneExpired(ctx)
+		assert.Nil(t, err)
+	})
+
+	t.Run("exec context returns error", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM revoked_access_token WHERE expires_at < \\$1").WithArgs(utcNow{}).
+			WillReturnError(errors.New("error"))
+
+		err := store.PruneExpired(ctx)
+		assert.EqualError(t, err, "error")
+	})
+}
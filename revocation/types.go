@@ -0,0 +1,31 @@
+// This file contains types that are used by the revocation stores.
+package revocation
+
+import "time"
+
+type RevokeTokenInput struct {
+	TokenId   string
+	ExpiresAt time.Time
+}
+
+// RevokeUserTokensInput revokes every token of the user issued before RevokedAt.
+// ExpiresAt should be at least RevokedAt plus the access token TTL, after which all of them are expired anyway.
+type RevokeUserTokensInput struct {
+	UserId    string
+	RevokedAt time.Time
+	ExpiresAt time.Time
+}
+
+// RevokeSessionInput revokes every token issued within the session.
+// ExpiresAt should be at least the time of revocation plus the access token TTL.
+type RevokeSessionInput struct {
+	SessionId string
+	ExpiresAt time.Time
+}
+
+type IsRevokedInput struct {
+	TokenId   string
+	UserId    string
+	SessionId string
+	IssuedAt  time.Time
+}
@@ -0,0 +1,8 @@
+package sms
+
+import "context"
+
+// SMSSender delivers text messages to phone numbers
+type SMSSender interface {
+	SendSMS(ctx context.Context, input SendSMSInput) (err error)
+}
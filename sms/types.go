@@ -0,0 +1,7 @@
+// This file contains types that are used by the SMS senders.
+package sms
+
+type SendSMSInput struct {
+	PhoneNumber string
+	Message     string
+}
@@ -0,0 +1,39 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSender writes every message as a line to the writer instead of delivering it,
+// only suitable for development and tests
+type WriterSender struct {
+	mu     sync.Mutex
+	writer io.Writer
+}
+
+func NewWriterSender(writer io.Writer) *WriterSender {
+	return &WriterSender{writer: writer}
+}
+
+// NewFileSender appends the messages to the file, creating it if needed
+func NewFileSender(path string) (*WriterSender, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterSender(file), nil
+}
+
+func (s *WriterSender) SendSMS(_ context.Context, input SendSMSInput) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = fmt.Fprintf(s.writer, "%s SMS to %s: %s\n", time.Now().Format(time.RFC3339), input.PhoneNumber, input.Message)
+	return
+}
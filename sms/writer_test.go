@@ -0,0 +1,55 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriterSender_SendSMS(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		var buffer bytes.Buffer
+		sender := NewWriterSender(&buffer)
+
+		err := sender.SendSMS(ctx, SendSMSInput{PhoneNumber: "+62123456789", Message: "Your code is 123456"})
+		assert.Nil(t, err)
+
+		err = sender.SendSMS(ctx, SendSMSInput{PhoneNumber: "+62987654321", Message: "Your code is 654321"})
+		assert.Nil(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+		assert.Len(t, lines, 2)
+		assert.Contains(t, lines[0], "SMS to +62123456789: Your code is 123456")
+		assert.Contains(t, lines[1], "SMS to +62987654321: Your code is 654321")
+	})
+}
+
+func TestNewFileSender(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("positive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "outbox.log")
+
+		sender, err := NewFileSender(path)
+		assert.Nil(t, err)
+
+		err = sender.SendSMS(ctx, SendSMSInput{PhoneNumber: "+62123456789", Message: "Your code is 123456"})
+		assert.Nil(t, err)
+
+		content, err := os.ReadFile(path)
+		assert.Nil(t, err)
+		assert.Contains(t, string(content), "SMS to +62123456789: Your code is 123456")
+	})
+
+	t.Run("negative - directory doesn't exist", func(t *testing.T) {
+		_, err := NewFileSender(filepath.Join(t.TempDir(), "missing", "outbox.log"))
+		assert.NotNil(t, err)
+	})
+}
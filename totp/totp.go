@@ -0,0 +1,96 @@
+// Package totp implements time-based one-time passwords as described in RFC 6238,
+// compatible with common authenticator apps (HMAC-SHA1, 6 digits, 30 seconds period).
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretSize is the recommended secret length in bytes, matching the HMAC-SHA1 output size
+	SecretSize = 20
+
+	Digits = 6
+	Period = 30 * time.Second
+
+	// Number of steps before and after the current one that are still accepted, to allow for clock drift
+	skew = 1
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodeSecret encodes the secret the way authenticator apps expect it to be typed in
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// Step returns the time step the given time falls in
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the one-time password for the given time
+func Code(secret []byte, t time.Time) string {
+	return hotp(secret, uint64(Step(t)), Digits)
+}
+
+// Validate checks the code against the steps around the given time.
+// It returns the matching step so callers can reject a code that has been used before.
+func Validate(secret []byte, code string, t time.Time) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+	for i := current - skew; i <= current+skew; i++ {
+		expected := hotp(secret, uint64(i), Digits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth:// URI to be rendered as QR code for authenticator apps
+func ProvisioningURI(issuer string, accountName string, secret []byte) string {
+	query := url.Values{}
+	query.Set("secret", EncodeSecret(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int(Period/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// hotp implements the HMAC-based one-time password algorithm of RFC 4226
+func hotp(secret []byte, counter uint64, digits int) string {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%modulo)
+}
@@ -0,0 +1,81 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rfcSecret = []byte("12345678901234567890")
+
+func TestHotp(t *testing.T) {
+	// Test vectors from RFC 4226 appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range expected {
+		assert.Equal(t, code, hotp(rfcSecret, uint64(counter), 6))
+	}
+}
+
+func TestCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B (SHA1), truncated to 8 digits
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+
+	for unix, code := range vectors {
+		assert.Equal(t, code, hotp(rfcSecret, uint64(Step(time.Unix(unix, 0))), 8))
+		assert.Equal(t, code[2:], Code(rfcSecret, time.Unix(unix, 0)))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	t.Run("current step", func(t *testing.T) {
+		step, ok := Validate(rfcSecret, Code(rfcSecret, now), now)
+		assert.True(t, ok)
+		assert.Equal(t, Step(now), step)
+	})
+
+	t.Run("previous and next step within skew", func(t *testing.T) {
+		step, ok := Validate(rfcSecret, Code(rfcSecret, now.Add(-Period)), now)
+		assert.True(t, ok)
+		assert.Equal(t, Step(now)-1, step)
+
+		step, ok = Validate(rfcSecret, Code(rfcSecret, now.Add(Period)), now)
+		assert.True(t, ok)
+		assert.Equal(t, Step(now)+1, step)
+	})
+
+	t.Run("outside skew", func(t *testing.T) {
+		_, ok := Validate(rfcSecret, Code(rfcSecret, now.Add(-2*Period)), now)
+		assert.False(t, ok)
+	})
+
+	t.Run("malformed code", func(t *testing.T) {
+		_, ok := Validate(rfcSecret, "12345", now)
+		assert.False(t, ok)
+
+		_, ok = Validate(rfcSecret, "abcdef", now)
+		assert.False(t, ok)
+	})
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("User Service", "+628123456789", rfcSecret)
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/User%20Service:+628123456789?"))
+	assert.Contains(t, uri, "secret="+EncodeSecret(rfcSecret))
+	assert.Contains(t, uri, "issuer=User+Service")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}